@@ -0,0 +1,335 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	fledgedv1alpha3 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	clientset "github.com/senthilrch/kube-fledged/pkg/client/clientset/versioned"
+	informers "github.com/senthilrch/kube-fledged/pkg/client/informers/externalversions/kubefledged/v1alpha3"
+	listers "github.com/senthilrch/kube-fledged/pkg/client/listers/kubefledged/v1alpha3"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+// Reasons reported in the status of image tasks
+const (
+	ReasonImageNotPresent  = "ImageNotPresent"
+	ReasonErrImageInspect  = "ErrImageInspect"
+	ReasonErrImagePull     = "ErrImagePull"
+	ReasonErrImageRemove   = "ErrImageRemove"
+	ReasonDeadlineExceeded = "DeadlineExceeded"
+	ReasonUnsupported      = "UnsupportedAction"
+)
+
+// Agent pulls and removes images on its node through the container runtime,
+// as asked by the image tasks created for the node by kubefledged-controller
+type Agent struct {
+	nodeName         string
+	kubeclientset    kubernetes.Interface
+	fledgedclientset clientset.Interface
+	tasksLister      listers.ImageTaskLister
+	tasksSynced      cache.InformerSynced
+	images           ImageService
+	workqueue        workqueue.RateLimitingInterface
+	// running holds the cancel functions of the tasks being carried out, guarded by lock
+	running map[types.UID]context.CancelFunc
+	lock    sync.Mutex
+}
+
+// NewAgent returns a new agent for the node. The informer should only list the
+// image tasks of the node.
+func NewAgent(
+	kubeclientset kubernetes.Interface,
+	fledgedclientset clientset.Interface,
+	taskInformer informers.ImageTaskInformer,
+	images ImageService,
+	nodeName string) *Agent {
+
+	agent := &Agent{
+		nodeName:         nodeName,
+		kubeclientset:    kubeclientset,
+		fledgedclientset: fledgedclientset,
+		tasksLister:      taskInformer.Lister(),
+		tasksSynced:      taskInformer.Informer().HasSynced,
+		images:           images,
+		workqueue:        workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ImageTasks"),
+		running:          map[types.UID]context.CancelFunc{},
+	}
+	taskInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: agent.enqueueTask,
+		UpdateFunc: func(old, new interface{}) {
+			agent.enqueueTask(new)
+		},
+		DeleteFunc: func(obj interface{}) {
+			task, ok := obj.(*fledgedv1alpha3.ImageTask)
+			if !ok {
+				tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+				if !ok {
+					return
+				}
+				if task, ok = tombstone.Obj.(*fledgedv1alpha3.ImageTask); !ok {
+					return
+				}
+			}
+			agent.cancelTask(task)
+		},
+	})
+	return agent
+}
+
+// enqueueTask adds an image task which has not been carried out to the work queue
+func (a *Agent) enqueueTask(obj interface{}) {
+	task, ok := obj.(*fledgedv1alpha3.ImageTask)
+	if !ok || task.Status.Phase != "" || task.Spec.NodeName != a.nodeName {
+		return
+	}
+	key, err := cache.MetaNamespaceKeyFunc(task)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	a.workqueue.Add(key)
+}
+
+// cancelTask stops the pull or removal of an image task which got deleted,
+// e.g. because the sync of its image cache was cancelled
+func (a *Agent) cancelTask(task *fledgedv1alpha3.ImageTask) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if cancel, ok := a.running[task.UID]; ok {
+		klog.InfoS("Image task deleted, cancelling it", "task", klog.KObj(task), "image", task.Spec.Image)
+		cancel()
+	}
+}
+
+// Run lists the images of the node, which tells that the container runtime can
+// be reached, and starts the workers carrying out the image tasks
+func (a *Agent) Run(workers int, stopCh <-chan struct{}) error {
+	defer runtime.HandleCrash()
+	defer a.workqueue.ShutDown()
+
+	klog.InfoS("Starting kubefledged agent", "node", a.nodeName)
+	images, err := a.images.ListImages(context.Background())
+	if err != nil {
+		return fmt.Errorf("error listing images through the container runtime: %v", err)
+	}
+	klog.InfoS("Connected to the container runtime", "images", len(images))
+
+	klog.InfoS("Waiting for informer caches to sync")
+	if ok := cache.WaitForCacheSync(stopCh, a.tasksSynced); !ok {
+		return fmt.Errorf("failed to wait for caches to sync")
+	}
+	for i := 0; i < workers; i++ {
+		go wait.Until(a.runWorker, time.Second, stopCh)
+	}
+	klog.InfoS("Started workers", "workers", workers)
+	<-stopCh
+	klog.InfoS("Shutting down workers")
+	return nil
+}
+
+// runWorker processes image tasks until the work queue is shut down
+func (a *Agent) runWorker() {
+	for a.processNextWorkItem() {
+	}
+}
+
+// processNextWorkItem carries out the next image task of the work queue
+func (a *Agent) processNextWorkItem() bool {
+	obj, shutdown := a.workqueue.Get()
+	if shutdown {
+		return false
+	}
+	defer a.workqueue.Done(obj)
+	key, ok := obj.(string)
+	if !ok {
+		a.workqueue.Forget(obj)
+		runtime.HandleError(fmt.Errorf("expected string in workqueue but got %#v", obj))
+		return true
+	}
+	if err := a.syncHandler(key); err != nil {
+		a.workqueue.AddRateLimited(key)
+		runtime.HandleError(fmt.Errorf("error syncing '%s': %s, requeuing", key, err.Error()))
+		return true
+	}
+	a.workqueue.Forget(obj)
+	return true
+}
+
+// syncHandler carries out the image task and records its result in the status
+func (a *Agent) syncHandler(key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		runtime.HandleError(fmt.Errorf("invalid resource key: %s", key))
+		return nil
+	}
+	task, err := a.tasksLister.ImageTasks(namespace).Get(name)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if task.Status.Phase != "" {
+		// Carried out already, e.g. before a restart of the agent
+		return nil
+	}
+	status := a.runTask(task)
+	if status == nil {
+		return nil
+	}
+	return a.updateStatus(task, *status)
+}
+
+// runTask pulls or removes the image of the task. It returns nil if the task
+// was deleted while it was carried out.
+func (a *Agent) runTask(task *fledgedv1alpha3.ImageTask) *fledgedv1alpha3.ImageTaskStatus {
+	start := metav1.Now()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if d := task.Spec.ActiveDeadlineSeconds; d != nil {
+		ctx, cancel = context.WithDeadline(ctx, task.CreationTimestamp.Add(time.Duration(*d)*time.Second))
+		defer cancel()
+	}
+	a.lock.Lock()
+	a.running[task.UID] = cancel
+	a.lock.Unlock()
+	defer func() {
+		a.lock.Lock()
+		delete(a.running, task.UID)
+		a.lock.Unlock()
+	}()
+
+	status := &fledgedv1alpha3.ImageTaskStatus{StartTime: &start}
+	var err error
+	switch task.Spec.Action {
+	case fledgedv1alpha3.ImageTaskActionPull:
+		status.ImageRef, status.Reason, err = a.pullImage(ctx, task)
+	case fledgedv1alpha3.ImageTaskActionRemove:
+		status.Reason, err = a.removeImage(ctx, task)
+	default:
+		status.Reason, err = ReasonUnsupported, fmt.Errorf("unsupported action %q", task.Spec.Action)
+	}
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return nil
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) && err != nil {
+		status.Reason = ReasonDeadlineExceeded
+	}
+	completion := metav1.Now()
+	status.CompletionTime = &completion
+	if err != nil {
+		status.Phase = fledgedv1alpha3.ImageTaskPhaseFailed
+		status.Message = err.Error()
+		klog.InfoS("Image task failed", "task", klog.KObj(task), "action", task.Spec.Action, "image", task.Spec.Image,
+			"reason", status.Reason, "message", status.Message)
+		return status
+	}
+	status.Phase = fledgedv1alpha3.ImageTaskPhaseSucceeded
+	klog.InfoS("Image task succeeded", "task", klog.KObj(task), "action", task.Spec.Action, "image", task.Spec.Image,
+		"reason", status.Reason, "duration", completion.Sub(start.Time))
+	return status
+}
+
+// pullImage pulls the image of the task unless the pull policy allows using the
+// image present on the node. It returns the reference of the image and the
+// reason of a failure, or why nothing had to be done.
+func (a *Agent) pullImage(ctx context.Context, task *fledgedv1alpha3.ImageTask) (string, string, error) {
+	if task.Spec.ImagePullPolicy != corev1.PullAlways {
+		image, err := a.images.ImageStatus(ctx, task.Spec.Image)
+		if err != nil {
+			return "", ReasonErrImageInspect, err
+		}
+		if image != nil {
+			return image.Id, fledgedv1alpha3.ImageCacheReasonImageAlreadyPresent, nil
+		}
+	}
+	secrets := make([]*corev1.Secret, 0, len(task.Spec.ImagePullSecrets))
+	for _, ref := range task.Spec.ImagePullSecrets {
+		secret, err := a.kubeclientset.CoreV1().Secrets(task.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			// Like the kubelet, pull without the secret
+			klog.ErrorS(err, "Error getting image pull secret", "task", klog.KObj(task), "secret", ref.Name)
+			continue
+		}
+		secrets = append(secrets, secret)
+	}
+	auth, err := pullAuth(task.Spec.Image, secrets)
+	if err != nil {
+		return "", ReasonErrImagePull, err
+	}
+	ref, err := a.images.PullImage(ctx, task.Spec.Image, auth)
+	if err != nil {
+		return "", ReasonErrImagePull, err
+	}
+	return ref, "", nil
+}
+
+// removeImage removes the image of the task if it is present on the node. It
+// returns the reason of a failure, or why nothing had to be done.
+func (a *Agent) removeImage(ctx context.Context, task *fledgedv1alpha3.ImageTask) (string, error) {
+	image, err := a.images.ImageStatus(ctx, task.Spec.Image)
+	if err != nil {
+		return ReasonErrImageInspect, err
+	}
+	if image == nil {
+		return ReasonImageNotPresent, nil
+	}
+	if err := a.images.RemoveImage(ctx, image.Id); err != nil {
+		return ReasonErrImageRemove, err
+	}
+	return "", nil
+}
+
+// updateStatus records the result of the task. A task which got deleted in
+// the meantime is left alone.
+func (a *Agent) updateStatus(task *fledgedv1alpha3.ImageTask, status fledgedv1alpha3.ImageTaskStatus) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		taskCopy := task.DeepCopy()
+		taskCopy.Status = status
+		_, err := a.fledgedclientset.KubefledgedV1alpha3().ImageTasks(task.Namespace).
+			UpdateStatus(context.TODO(), taskCopy, metav1.UpdateOptions{})
+		if apierrors.IsConflict(err) {
+			latest, getErr := a.fledgedclientset.KubefledgedV1alpha3().ImageTasks(task.Namespace).
+				Get(context.TODO(), task.Name, metav1.GetOptions{})
+			if getErr != nil {
+				return getErr
+			}
+			task = latest
+		}
+		return err
+	})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
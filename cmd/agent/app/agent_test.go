@@ -0,0 +1,279 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	fledgedv1alpha3 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	fledgedfake "github.com/senthilrch/kube-fledged/pkg/client/clientset/versioned/fake"
+	informers "github.com/senthilrch/kube-fledged/pkg/client/informers/externalversions"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakeclientset "k8s.io/client-go/kubernetes/fake"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+	critesting "k8s.io/cri-api/pkg/apis/testing"
+)
+
+const nodeName = "node-1"
+
+// fakeImageService adapts the fake CRI image service of cri-api to the agent.
+// Calls fail once the deadline of the task has passed.
+type fakeImageService struct {
+	*critesting.FakeImageService
+}
+
+func (f fakeImageService) ListImages(ctx context.Context) ([]*runtimeapi.Image, error) {
+	return f.FakeImageService.ListImages(nil)
+}
+
+func (f fakeImageService) ImageStatus(ctx context.Context, image string) (*runtimeapi.Image, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	resp, err := f.FakeImageService.ImageStatus(&runtimeapi.ImageSpec{Image: image}, false)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Image, nil
+}
+
+func (f fakeImageService) PullImage(ctx context.Context, image string, auth *runtimeapi.AuthConfig) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return f.FakeImageService.PullImage(&runtimeapi.ImageSpec{Image: image}, auth, nil)
+}
+
+func (f fakeImageService) RemoveImage(ctx context.Context, image string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return f.FakeImageService.RemoveImage(&runtimeapi.ImageSpec{Image: image})
+}
+
+func TestSyncHandler(t *testing.T) {
+	regcred := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "regcred", Namespace: "kube-fledged"},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{corev1.DockerConfigJsonKey: []byte(
+			`{"auths":{"https://index.docker.io/v1/":{"username":"foo","password":"bar"}}}`)},
+	}
+	deadline := int64(60)
+	tests := []struct {
+		name            string
+		action          fledgedv1alpha3.ImageTaskAction
+		pullPolicy      corev1.PullPolicy
+		present         bool
+		created         time.Time
+		status          fledgedv1alpha3.ImageTaskStatus
+		criError        string
+		expectedCalls   []string
+		expectedAuth    *runtimeapi.AuthConfig
+		expectedPhase   fledgedv1alpha3.ImageTaskPhase
+		expectedReason  string
+		expectedMessage string
+	}{
+		{
+			name:          "#1: Successful - image pulled with the credentials of the pull secret",
+			action:        fledgedv1alpha3.ImageTaskActionPull,
+			expectedCalls: []string{"ImageStatus", "PullImage"},
+			expectedAuth:  &runtimeapi.AuthConfig{Username: "foo", Password: "bar", ServerAddress: "docker.io"},
+			expectedPhase: fledgedv1alpha3.ImageTaskPhaseSucceeded,
+		},
+		{
+			name:           "#2: Successful - image already present",
+			action:         fledgedv1alpha3.ImageTaskActionPull,
+			present:        true,
+			expectedCalls:  []string{"ImageStatus"},
+			expectedPhase:  fledgedv1alpha3.ImageTaskPhaseSucceeded,
+			expectedReason: fledgedv1alpha3.ImageCacheReasonImageAlreadyPresent,
+		},
+		{
+			name:          "#3: Successful - image present but always pulled",
+			action:        fledgedv1alpha3.ImageTaskActionPull,
+			pullPolicy:    corev1.PullAlways,
+			present:       true,
+			expectedCalls: []string{"PullImage"},
+			expectedAuth:  &runtimeapi.AuthConfig{Username: "foo", Password: "bar", ServerAddress: "docker.io"},
+			expectedPhase: fledgedv1alpha3.ImageTaskPhaseSucceeded,
+		},
+		{
+			name:            "#4: Unsuccessful - image pull failed",
+			action:          fledgedv1alpha3.ImageTaskActionPull,
+			criError:        "PullImage",
+			expectedCalls:   []string{"ImageStatus", "PullImage"},
+			expectedPhase:   fledgedv1alpha3.ImageTaskPhaseFailed,
+			expectedReason:  ReasonErrImagePull,
+			expectedMessage: "fake PullImage error",
+		},
+		{
+			name:            "#5: Unsuccessful - deadline exceeded",
+			action:          fledgedv1alpha3.ImageTaskActionPull,
+			created:         time.Now().Add(-time.Hour),
+			expectedCalls:   []string{},
+			expectedPhase:   fledgedv1alpha3.ImageTaskPhaseFailed,
+			expectedReason:  ReasonDeadlineExceeded,
+			expectedMessage: context.DeadlineExceeded.Error(),
+		},
+		{
+			name:          "#6: Successful - image removed",
+			action:        fledgedv1alpha3.ImageTaskActionRemove,
+			present:       true,
+			expectedCalls: []string{"ImageStatus", "RemoveImage"},
+			expectedPhase: fledgedv1alpha3.ImageTaskPhaseSucceeded,
+		},
+		{
+			name:           "#7: Successful - image to remove not present",
+			action:         fledgedv1alpha3.ImageTaskActionRemove,
+			expectedCalls:  []string{"ImageStatus"},
+			expectedPhase:  fledgedv1alpha3.ImageTaskPhaseSucceeded,
+			expectedReason: ReasonImageNotPresent,
+		},
+		{
+			name:            "#8: Unsuccessful - image removal failed",
+			action:          fledgedv1alpha3.ImageTaskActionRemove,
+			present:         true,
+			criError:        "RemoveImage",
+			expectedCalls:   []string{"ImageStatus", "RemoveImage"},
+			expectedPhase:   fledgedv1alpha3.ImageTaskPhaseFailed,
+			expectedReason:  ReasonErrImageRemove,
+			expectedMessage: "fake RemoveImage error",
+		},
+		{
+			name:          "#9: Image task finished already",
+			action:        fledgedv1alpha3.ImageTaskActionPull,
+			status:        fledgedv1alpha3.ImageTaskStatus{Phase: fledgedv1alpha3.ImageTaskPhaseSucceeded},
+			expectedCalls: []string{},
+			expectedPhase: fledgedv1alpha3.ImageTaskPhaseSucceeded,
+		},
+	}
+	for _, test := range tests {
+		created := test.created
+		if created.IsZero() {
+			created = time.Now()
+		}
+		task := &fledgedv1alpha3.ImageTask{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo-abcde", Namespace: "kube-fledged", CreationTimestamp: metav1.NewTime(created)},
+			Spec: fledgedv1alpha3.ImageTaskSpec{
+				NodeName:              nodeName,
+				Action:                test.action,
+				Image:                 "foo:1.0",
+				ImagePullPolicy:       test.pullPolicy,
+				ImagePullSecrets:      []corev1.LocalObjectReference{{Name: "regcred"}},
+				ActiveDeadlineSeconds: &deadline,
+			},
+			Status: test.status,
+		}
+		criService := critesting.NewFakeImageService()
+		if test.present {
+			criService.SetFakeImages([]string{"foo:1.0"})
+		}
+		if test.criError != "" {
+			criService.InjectError(test.criError, fmt.Errorf("fake %s error", test.criError))
+		}
+		fledgedclientset := fledgedfake.NewSimpleClientset(task)
+		fledgedInformerFactory := informers.NewSharedInformerFactory(fledgedclientset, 0)
+		taskInformer := fledgedInformerFactory.Kubefledged().V1alpha3().ImageTasks()
+		taskInformer.Informer().GetIndexer().Add(task)
+		agent := NewAgent(fakeclientset.NewSimpleClientset(regcred), fledgedclientset, taskInformer,
+			fakeImageService{criService}, nodeName)
+
+		if err := agent.syncHandler("kube-fledged/foo-abcde"); err != nil {
+			t.Errorf("Test: %s failed: err=%v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(criService.Called, test.expectedCalls) && !(len(criService.Called) == 0 && len(test.expectedCalls) == 0) {
+			t.Errorf("Test: %s failed: expected calls=%v, actual=%v", test.name, test.expectedCalls, criService.Called)
+		}
+		if test.expectedAuth != nil {
+			criService.AssertImagePulledWithAuth(t, &runtimeapi.ImageSpec{Image: "foo:1.0"}, test.expectedAuth, test.name)
+		}
+		updated, err := fledgedclientset.KubefledgedV1alpha3().ImageTasks("kube-fledged").Get(context.Background(), "foo-abcde", metav1.GetOptions{})
+		if err != nil {
+			t.Errorf("Test: %s failed: err=%v", test.name, err)
+			continue
+		}
+		if updated.Status.Phase != test.expectedPhase || updated.Status.Reason != test.expectedReason ||
+			updated.Status.Message != test.expectedMessage {
+			t.Errorf("Test: %s failed: expected phase=%s, reason=%s, message=%s, actual phase=%s, reason=%s, message=%s",
+				test.name, test.expectedPhase, test.expectedReason, test.expectedMessage,
+				updated.Status.Phase, updated.Status.Reason, updated.Status.Message)
+		}
+		if test.status.Phase == "" && (updated.Status.StartTime == nil || updated.Status.CompletionTime == nil) {
+			t.Errorf("Test: %s failed: start and completion time not recorded", test.name)
+		}
+	}
+}
+
+func TestPullAuth(t *testing.T) {
+	dockerconfigjson := &corev1.Secret{
+		Type: corev1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{corev1.DockerConfigJsonKey: []byte(
+			`{"auths":{"https://index.docker.io/v1/":{"auth":"Zm9vOmJhcg=="},"registry.example.com":{"username":"foo","password":"bar"}}}`)},
+	}
+	dockercfg := &corev1.Secret{
+		Type: corev1.SecretTypeDockercfg,
+		Data: map[string][]byte{corev1.DockerConfigKey: []byte(
+			`{"https://ghcr.io":{"username":"baz","password":"qux"}}`)},
+	}
+	opaque := &corev1.Secret{Type: corev1.SecretTypeOpaque}
+	tests := []struct {
+		name     string
+		image    string
+		secrets  []*corev1.Secret
+		expected *runtimeapi.AuthConfig
+	}{
+		{
+			name:     "#1: Docker Hub image",
+			image:    "foo/bar:1.0",
+			secrets:  []*corev1.Secret{opaque, dockerconfigjson},
+			expected: &runtimeapi.AuthConfig{Auth: "Zm9vOmJhcg==", ServerAddress: "docker.io"},
+		},
+		{
+			name:     "#2: Image of a private registry",
+			image:    "registry.example.com/foo/bar@sha256:abcd",
+			secrets:  []*corev1.Secret{dockerconfigjson},
+			expected: &runtimeapi.AuthConfig{Username: "foo", Password: "bar", ServerAddress: "registry.example.com"},
+		},
+		{
+			name:     "#3: Legacy docker config",
+			image:    "ghcr.io/foo/bar",
+			secrets:  []*corev1.Secret{dockerconfigjson, dockercfg},
+			expected: &runtimeapi.AuthConfig{Username: "baz", Password: "qux", ServerAddress: "ghcr.io"},
+		},
+		{
+			name:    "#4: No credentials for the registry",
+			image:   "quay.io/foo/bar",
+			secrets: []*corev1.Secret{dockerconfigjson, dockercfg},
+		},
+	}
+	for _, test := range tests {
+		auth, err := pullAuth(test.image, test.secrets)
+		if err != nil {
+			t.Errorf("Test: %s failed: err=%v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(auth, test.expected) {
+			t.Errorf("Test: %s failed: expected=%+v, actual=%+v", test.name, test.expected, auth)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/senthilrch/kube-fledged/pkg/images"
+	corev1 "k8s.io/api/core/v1"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+// dockerConfigEntry holds the credentials of a registry in a docker config
+type dockerConfigEntry struct {
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty"`
+	Auth          string `json:"auth,omitempty"`
+	IdentityToken string `json:"identitytoken,omitempty"`
+	RegistryToken string `json:"registrytoken,omitempty"`
+}
+
+// dockerConfigJSON is the content of a secret of type kubernetes.io/dockerconfigjson
+type dockerConfigJSON struct {
+	Auths map[string]dockerConfigEntry `json:"auths"`
+}
+
+// registryHost returns the host of a registry key of a docker config, e.g.
+// docker.io for https://index.docker.io/v1/
+func registryHost(key string) string {
+	host := strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://")
+	if i := strings.Index(host, "/"); i >= 0 {
+		host = host[:i]
+	}
+	if host == "index.docker.io" || host == "registry-1.docker.io" {
+		host = "docker.io"
+	}
+	return host
+}
+
+// pullAuth returns the credentials for the registry of the image from the
+// first of the pull secrets which has some, nil if none has
+func pullAuth(image string, secrets []*corev1.Secret) (*runtimeapi.AuthConfig, error) {
+	name, _, _ := images.NormalizeImageName(image)
+	registry := name[:strings.Index(name, "/")]
+	for _, secret := range secrets {
+		var cfg dockerConfigJSON
+		switch secret.Type {
+		case corev1.SecretTypeDockerConfigJson:
+			if err := json.Unmarshal(secret.Data[corev1.DockerConfigJsonKey], &cfg); err != nil {
+				return nil, fmt.Errorf("error parsing secret %s/%s: %v", secret.Namespace, secret.Name, err)
+			}
+		case corev1.SecretTypeDockercfg:
+			if err := json.Unmarshal(secret.Data[corev1.DockerConfigKey], &cfg.Auths); err != nil {
+				return nil, fmt.Errorf("error parsing secret %s/%s: %v", secret.Namespace, secret.Name, err)
+			}
+		default:
+			continue
+		}
+		for key, entry := range cfg.Auths {
+			if registryHost(key) != registry {
+				continue
+			}
+			return &runtimeapi.AuthConfig{
+				Username:      entry.Username,
+				Password:      entry.Password,
+				Auth:          entry.Auth,
+				ServerAddress: registry,
+				IdentityToken: entry.IdentityToken,
+				RegistryToken: entry.RegistryToken,
+			}, nil
+		}
+	}
+	return nil, nil
+}
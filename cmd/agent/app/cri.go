@@ -0,0 +1,100 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+// maxMsgSize is the largest response accepted from the container runtime,
+// the list of images of a node can get long
+const maxMsgSize = 16 * 1024 * 1024
+
+// ImageService is the part of the CRI image service used by the agent
+type ImageService interface {
+	// ListImages lists the images present on the node
+	ListImages(ctx context.Context) ([]*runtimeapi.Image, error)
+	// ImageStatus returns the image, nil if it is not present on the node
+	ImageStatus(ctx context.Context, image string) (*runtimeapi.Image, error)
+	// PullImage pulls the image and returns its reference
+	PullImage(ctx context.Context, image string, auth *runtimeapi.AuthConfig) (string, error)
+	// RemoveImage removes the image, it succeeds if the image is not present
+	RemoveImage(ctx context.Context, image string) error
+}
+
+// remoteImageService talks to the image service of the container runtime over its socket
+type remoteImageService struct {
+	client  runtimeapi.ImageServiceClient
+	timeout time.Duration
+}
+
+// NewRemoteImageService connects to the CRI image service listening on the unix
+// socket. Calls other than pulls time out after timeout.
+func NewRemoteImageService(socketPath string, timeout time.Duration) (ImageService, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, "unix://"+socketPath,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(maxMsgSize)),
+		grpc.WithBlock())
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to cri socket %s: %v", socketPath, err)
+	}
+	return &remoteImageService{client: runtimeapi.NewImageServiceClient(conn), timeout: timeout}, nil
+}
+
+func (r *remoteImageService) ListImages(ctx context.Context) ([]*runtimeapi.Image, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	resp, err := r.client.ListImages(ctx, &runtimeapi.ListImagesRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Images, nil
+}
+
+func (r *remoteImageService) ImageStatus(ctx context.Context, image string) (*runtimeapi.Image, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	resp, err := r.client.ImageStatus(ctx, &runtimeapi.ImageStatusRequest{Image: &runtimeapi.ImageSpec{Image: image}})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Image, nil
+}
+
+// PullImage is bounded by the deadline of ctx only, pulls of large images take long
+func (r *remoteImageService) PullImage(ctx context.Context, image string, auth *runtimeapi.AuthConfig) (string, error) {
+	resp, err := r.client.PullImage(ctx, &runtimeapi.PullImageRequest{Image: &runtimeapi.ImageSpec{Image: image}, Auth: auth})
+	if err != nil {
+		return "", err
+	}
+	return resp.ImageRef, nil
+}
+
+func (r *remoteImageService) RemoveImage(ctx context.Context, image string) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	_, err := r.client.RemoveImage(ctx, &runtimeapi.RemoveImageRequest{Image: &runtimeapi.ImageSpec{Image: image}})
+	return err
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+
+	"github.com/senthilrch/kube-fledged/cmd/agent/app"
+	clientset "github.com/senthilrch/kube-fledged/pkg/client/clientset/versioned"
+	informers "github.com/senthilrch/kube-fledged/pkg/client/informers/externalversions"
+	"github.com/senthilrch/kube-fledged/pkg/images"
+	"github.com/senthilrch/kube-fledged/pkg/signals"
+)
+
+var (
+	kubeconfig        string
+	masterURL         string
+	nodeName          string
+	criSocketPath     string
+	criRequestTimeout time.Duration
+	concurrentTasks   int
+)
+
+func main() {
+	klog.InitFlags(nil)
+	flag.Parse()
+	defer klog.Flush()
+
+	if nodeName == "" {
+		fatal(nil, "Node name must be set with --node-name or the NODE_NAME environment variable")
+	}
+
+	// set up signals so we handle the first shutdown signal gracefully
+	stopCh := signals.SetupSignalHandler()
+
+	cfg, err := clientcmd.BuildConfigFromFlags(masterURL, kubeconfig)
+	if err != nil {
+		fatal(err, "Error building kubeconfig")
+	}
+
+	kubeClient, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		fatal(err, "Error building kubernetes clientset")
+	}
+
+	fledgedClient, err := clientset.NewForConfig(cfg)
+	if err != nil {
+		fatal(err, "Error building fledged clientset")
+	}
+
+	// Image tasks are labelled with the hostname of the node, which is short
+	// enough for a label value unlike some node names
+	node, err := kubeClient.CoreV1().Nodes().Get(context.Background(), nodeName, metav1.GetOptions{})
+	if err != nil {
+		fatal(err, "Error getting node", "node", nodeName)
+	}
+
+	imageService, err := app.NewRemoteImageService(criSocketPath, criRequestTimeout)
+	if err != nil {
+		fatal(err, "Error connecting to the container runtime")
+	}
+
+	// Only the image tasks of this node are watched
+	fledgedInformerFactory := informers.NewSharedInformerFactoryWithOptions(fledgedClient, time.Second*30,
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = labels.Set{images.ImageTaskNodeLabel: images.NodeHostname(node)}.String()
+		}))
+
+	agent := app.NewAgent(kubeClient, fledgedClient,
+		fledgedInformerFactory.Kubefledged().V1alpha3().ImageTasks(),
+		imageService, nodeName)
+
+	go fledgedInformerFactory.Start(stopCh)
+
+	if err = agent.Run(concurrentTasks, stopCh); err != nil {
+		fatal(err, "Error running agent")
+	}
+}
+
+func fatal(err error, msg string, keysAndValues ...interface{}) {
+	klog.ErrorS(err, msg, keysAndValues...)
+	klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+}
+
+func init() {
+	flag.StringVar(&kubeconfig, "kubeconfig", "",
+		"Path to a kubeconfig. Only required if out-of-cluster.")
+	flag.StringVar(&masterURL, "master", "",
+		"The address of the Kubernetes API server. Overrides any value in kubeconfig. Only required if out-of-cluster.")
+	flag.StringVar(&nodeName, "node-name", os.Getenv("NODE_NAME"), "Name of the node on which the agent runs. Default value is the NODE_NAME environment variable")
+	flag.StringVar(&criSocketPath, "cri-socket-path", "/run/containerd/containerd.sock", "Path to the cri socket on the node e.g. /var/run/crio/crio.sock. Default value: /run/containerd/containerd.sock")
+	flag.DurationVar(&criRequestTimeout, "cri-request-timeout", time.Minute*2, "Timeout of requests to the container runtime other than image pulls, which are bounded by the pull deadline of the image. Default value: 2m")
+	flag.IntVar(&concurrentTasks, "concurrent-tasks", 2, "Number of image pulls and removals carried out at the same time. Default value: 2")
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"sync"
+
+	"github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// imageCacheCancelAnnotationKey cancels the sync action of the image cache in progress
+const imageCacheCancelAnnotationKey = "kubefledged.io/cancel"
+
+// activeSyncs tracks the sync action in progress of every image cache. It is
+// accessed from the workers, hence guarded by lock.
+type activeSyncs struct {
+	lock    sync.Mutex
+	syncIDs map[string]string
+}
+
+func newActiveSyncs() *activeSyncs {
+	return &activeSyncs{syncIDs: map[string]string{}}
+}
+
+// start records the sync action dispatched for the image cache
+func (a *activeSyncs) start(key, syncID string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.syncIDs[key] = syncID
+}
+
+// finish forgets the sync action of the image cache, unless a later one has started
+func (a *activeSyncs) finish(key, syncID string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.syncIDs[key] == syncID {
+		delete(a.syncIDs, key)
+	}
+}
+
+// get returns the sync action in progress of the image cache
+func (a *activeSyncs) get(key string) (string, bool) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	syncID, ok := a.syncIDs[key]
+	return syncID, ok
+}
+
+// cancelImageCache cancels the sync action of the image cache in progress and
+// removes the cancel annotation. The image manager reports the cancelled
+// requests with the results of the sync action, which then finalizes the
+// status as aborted.
+func (c *Controller) cancelImageCache(ctx context.Context, key, namespace, name string, logValues []interface{}) error {
+	imageCache, err := c.kubefledgedclientset.KubefledgedV1alpha3().ImageCaches(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		klog.ErrorS(err, "Error getting imagecache", logValues...)
+		return err
+	}
+	syncID, ok := c.activeSyncs.get(key)
+	if ok && imageCache.Status.Status == v1alpha3.ImageCacheActionStatusProcessing {
+		cancelled := c.imageManager.CancelSync(syncID)
+		klog.InfoS("Sync action of image cache cancelled", append(logValues, "syncID", syncID, "cancelled", cancelled)...)
+		c.recorder.Event(imageCache, corev1.EventTypeNormal, v1alpha3.ImageCacheReasonImageCacheCancelled, "Cancelling image cache processing")
+	} else {
+		klog.InfoS("No sync action of image cache in progress, nothing to cancel", logValues...)
+	}
+	if err := c.removeAnnotation(imageCache, imageCacheCancelAnnotationKey); err != nil {
+		klog.ErrorS(err, "Error removing annotation from imagecache", append(logValues, "annotation", imageCacheCancelAnnotationKey)...)
+		return err
+	}
+	return nil
+}
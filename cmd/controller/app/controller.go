@@ -19,21 +19,28 @@ package app
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"reflect"
+	"sync"
 	"time"
 
-	"github.com/golang/glog"
 	v1alpha3 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha3"
 	clientset "github.com/senthilrch/kube-fledged/pkg/client/clientset/versioned"
 	fledgedscheme "github.com/senthilrch/kube-fledged/pkg/client/clientset/versioned/scheme"
 	informers "github.com/senthilrch/kube-fledged/pkg/client/informers/externalversions/kubefledged/v1alpha3"
 	listers "github.com/senthilrch/kube-fledged/pkg/client/listers/kubefledged/v1alpha3"
+	"github.com/senthilrch/kube-fledged/pkg/config"
 	"github.com/senthilrch/kube-fledged/pkg/images"
+	"github.com/senthilrch/kube-fledged/pkg/notify"
+	"github.com/senthilrch/kube-fledged/pkg/tracing"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/selection"
 	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/uuid"
 	"k8s.io/apimachinery/pkg/util/wait"
 	coreinformers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
@@ -43,6 +50,7 @@ import (
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
 )
 
 const controllerAgentName = "kubefledged-controller"
@@ -71,6 +79,7 @@ type Controller struct {
 	fledgedNameSpace  string
 	nodesLister       corelisters.NodeLister
 	nodesSynced       cache.InformerSynced
+	namespacesSynced  cache.InformerSynced
 	imageCachesLister listers.ImageCacheLister
 	imageCachesSynced cache.InformerSynced
 
@@ -84,60 +93,84 @@ type Controller struct {
 	imageManager   *images.ImageManager
 	// recorder is an event recorder for recording Event resources to the
 	// Kubernetes API.
-	recorder                   record.EventRecorder
-	imageCacheRefreshFrequency time.Duration
-
-	// TODO(gaocegege): Should we use concurrent map?
-	nodesCache map[string]bool
+	recorder record.EventRecorder
+
+	// cfg is the current configuration, guarded by cfgLock. refreshChanged
+	// wakes up the refresh loop when the refresh frequency changes.
+	cfg            config.ControllerConfiguration
+	cfgLock        sync.RWMutex
+	refreshChanged chan struct{}
+
+	// scope restricts the namespaces whose ImageCaches are handled
+	scope *namespaceScope
+
+	// nodeWarmups tracks the warm-up of nodes which became ready
+	nodeWarmups *nodeWarmupTracker
+	// startTime is when the controller was created. Nodes which were ready
+	// before are not warmed up.
+	startTime time.Time
+	// activeSyncs tracks the sync action in progress of every image cache
+	activeSyncs *activeSyncs
+	// pendingUpdates tracks the spec changes made while image caches are under processing
+	pendingUpdates *pendingUpdates
+	// notifier pushes the final status of syncs to the notification sinks
+	notifier *notify.Notifier
+	// startupTaint is kept on new nodes until critical image caches are warm, nil if disabled
+	startupTaint *corev1.Taint
 }
 
-// NewController returns a new fledged controller
+// NewController returns a new fledged controller. namespaceInformer is only
+// required when a namespace selector is configured and may be nil otherwise.
 func NewController(
 	kubeclientset kubernetes.Interface,
 	kubefledgedclientset clientset.Interface,
-	namespace string,
 	nodeInformer coreinformers.NodeInformer,
+	namespaceInformer coreinformers.NamespaceInformer,
 	imageCacheInformer informers.ImageCacheInformer,
-	imageCacheRefreshFrequency time.Duration,
-	imagePullDeadlineDuration time.Duration,
-	criClientImage string,
-	busyboxImage string,
-	imagePullPolicy string,
-	serviceAccountName string,
-	imageDeleteJobHostNetwork bool,
-	jobPriorityClassName string,
-	canDeleteJob bool,
-	criSocketPath string) *Controller {
+	cfg *config.ControllerConfiguration) *Controller {
 
 	runtime.Must(fledgedscheme.AddToScheme(scheme.Scheme))
-	glog.V(4).Info("Creating event broadcaster")
+	klog.V(4).InfoS("Creating event broadcaster")
 	eventBroadcaster := record.NewBroadcaster()
-	eventBroadcaster.StartLogging(glog.Infof)
+	eventBroadcaster.StartStructuredLogging(0)
 	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeclientset.CoreV1().Events("")})
 	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: controllerAgentName})
 
 	controller := &Controller{
-		kubeclientset:              kubeclientset,
-		kubefledgedclientset:       kubefledgedclientset,
-		fledgedNameSpace:           namespace,
-		nodesLister:                nodeInformer.Lister(),
-		nodesCache:                 map[string]bool{},
-		nodesSynced:                nodeInformer.Informer().HasSynced,
-		imageCachesLister:          imageCacheInformer.Lister(),
-		imageCachesSynced:          imageCacheInformer.Informer().HasSynced,
-		workqueue:                  workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ImageCaches"),
-		imageworkqueue:             workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ImagePullerStatus"),
-		recorder:                   recorder,
-		imageCacheRefreshFrequency: imageCacheRefreshFrequency,
+		kubeclientset:        kubeclientset,
+		kubefledgedclientset: kubefledgedclientset,
+		fledgedNameSpace:     cfg.Namespace,
+		nodesLister:          nodeInformer.Lister(),
+		nodeWarmups:          newNodeWarmupTracker(),
+		startTime:            time.Now(),
+		activeSyncs:          newActiveSyncs(),
+		pendingUpdates:       newPendingUpdates(),
+		notifier:             notify.NewNotifier(&http.Client{}),
+		startupTaint:         cfg.StartupNodeTaint(),
+		nodesSynced:          nodeInformer.Informer().HasSynced,
+		imageCachesLister:    imageCacheInformer.Lister(),
+		imageCachesSynced:    imageCacheInformer.Informer().HasSynced,
+		workqueue:            workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ImageCaches"),
+		imageworkqueue:       workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ImagePullerStatus"),
+		recorder:             recorder,
+		cfg:                  *cfg,
+		refreshChanged:       make(chan struct{}, 1),
+	}
+	if namespaceInformer != nil {
+		controller.scope = newNamespaceScope(cfg, namespaceInformer.Lister())
+		controller.namespacesSynced = namespaceInformer.Informer().HasSynced
+		namespaceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			UpdateFunc: controller.handleNamespaceUpdate,
+		})
+	} else {
+		controller.scope = newNamespaceScope(cfg, nil)
 	}
 
 	imageManager, _ := images.NewImageManager(controller.workqueue, controller.imageworkqueue,
-		controller.kubeclientset, controller.fledgedNameSpace, imagePullDeadlineDuration,
-		criClientImage, busyboxImage, imagePullPolicy, serviceAccountName, imageDeleteJobHostNetwork,
-		jobPriorityClassName, canDeleteJob, criSocketPath)
+		controller.kubeclientset, controller.kubefledgedclientset, cfg, nil)
 	controller.imageManager = imageManager
 
-	glog.Info("Setting up event handlers")
+	klog.InfoS("Setting up event handlers")
 	// Set up an event handler for when ImageCache resources change
 	imageCacheInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
@@ -157,6 +190,7 @@ func NewController(
 		},
 		UpdateFunc: func(old, new interface{}) {
 			controller.enqueueNode(new, "update")
+			controller.handleNodeImagesChange(old, new)
 		},
 		DeleteFunc: func(obj interface{}) {
 			controller.enqueueNode(obj, "delete")
@@ -165,6 +199,28 @@ func NewController(
 	return controller
 }
 
+// handleNamespaceUpdate queues the ImageCaches of a namespace whose labels now
+// match the namespace selector. Their events were ignored while out of scope.
+func (c *Controller) handleNamespaceUpdate(old, new interface{}) {
+	oldNamespace := old.(*corev1.Namespace)
+	newNamespace := new.(*corev1.Namespace)
+	if c.scope.selector == nil || reflect.DeepEqual(oldNamespace.Labels, newNamespace.Labels) {
+		return
+	}
+	if c.scope.selector.Matches(labels.Set(oldNamespace.Labels)) || !c.scope.contains(newNamespace.Name) {
+		return
+	}
+	ics, err := c.imageCachesLister.ImageCaches(newNamespace.Name).List(labels.Everything())
+	if err != nil {
+		klog.ErrorS(err, "Error listing ImageCaches", "namespace", newNamespace.Name)
+		return
+	}
+	klog.InfoS("Namespace entered the watch scope", "namespace", newNamespace.Name, "imagecaches", len(ics))
+	for _, ic := range ics {
+		c.enqueueImageCache(images.ImageCacheCreate, nil, ic)
+	}
+}
+
 func (c *Controller) enqueueNode(obj interface{}, operation string) {
 	switch operation {
 	case "delete":
@@ -172,59 +228,32 @@ func (c *Controller) enqueueNode(obj interface{}, operation string) {
 		if !ok {
 			tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
 			if !ok {
-				glog.Errorf("Couldn't get object from tombstone %#v", obj)
+				klog.ErrorS(nil, "Couldn't get object from tombstone", "object", obj)
 				return
 			}
 			node, ok = tombstone.Obj.(*corev1.Node)
 			if !ok {
-				glog.Errorf("Tombstone contained object that is not a Node %#v", obj)
+				klog.ErrorS(nil, "Tombstone contained object that is not a Node", "object", obj)
 				return
 			}
 		}
-		delete(c.nodesCache, node.Name)
+		c.nodeWarmups.remove(node.Name)
 	case "add", "update":
 		node, ok := obj.(*corev1.Node)
 		if !ok {
 			tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
 			if !ok {
-				glog.Errorf("Couldn't get object from tombstone %#v", obj)
+				klog.ErrorS(nil, "Couldn't get object from tombstone", "object", obj)
 				return
 			}
 			node, ok = tombstone.Obj.(*corev1.Node)
 			if !ok {
-				glog.Errorf("Tombstone contained object that is not a Node %#v", obj)
+				klog.ErrorS(nil, "Tombstone contained object that is not a Node", "object", obj)
 				return
 			}
 		}
 		if IsNodeReady(node) {
-			if _, ok := c.nodesCache[node.Name]; !ok {
-				c.nodesCache[node.Name] = true
-				glog.V(4).Infof("Node %s updated and ready", node.Name)
-				ics, err := c.imageCachesLister.ImageCaches(c.fledgedNameSpace).List(labels.Everything())
-				if err != nil {
-					glog.Errorf("Error listing ImageCaches: %s", err.Error())
-					return
-				}
-
-				// Wait for defaultNodeLatency before enqueuing ImageCaches to make kubernetes api server happy.
-				ticker := time.NewTicker(defaultNodeLatency)
-				quit := make(chan struct{})
-				go func() {
-					for {
-						select {
-						case <-ticker.C:
-							glog.V(4).Infof("Enqueuing ImageCaches for node %s", node.Name)
-							for _, ic := range ics {
-								c.enqueueImageCache(images.ImageCacheRefresh, ic, ic)
-							}
-							close(quit)
-						case <-quit:
-							ticker.Stop()
-							return
-						}
-					}
-				}()
-			}
+			c.trackNode(node)
 		}
 	}
 }
@@ -239,11 +268,21 @@ func IsNodeReady(node *corev1.Node) bool {
 	return false
 }
 
-// PreFlightChecks performs pre-flight checks and actions before the controller is started
-func (c *Controller) PreFlightChecks() error {
+// PreFlightChecks performs pre-flight checks and actions before the controller is started.
+// The namespace informer must have been started, the namespace selector is evaluated
+// against its cache.
+func (c *Controller) PreFlightChecks(stopCh <-chan struct{}) error {
+	if c.namespacesSynced != nil {
+		if ok := cache.WaitForCacheSync(stopCh, c.namespacesSynced); !ok {
+			return fmt.Errorf("failed to wait for namespace cache to sync")
+		}
+	}
 	if err := c.danglingJobs(); err != nil {
 		return err
 	}
+	if err := c.danglingImageTasks(); err != nil {
+		return err
+	}
 	if err := c.danglingImageCaches(); err != nil {
 		return err
 	}
@@ -257,27 +296,66 @@ func (c *Controller) danglingJobs() error {
 	labelSelector := labels.NewSelector()
 	labelSelector = labelSelector.Add(*appEqKubefledged, *kubefledgedEqImagemanager)
 
-	joblist, err := c.kubeclientset.BatchV1().Jobs("").List(context.TODO(), metav1.ListOptions{
+	joblist, err := c.kubeclientset.BatchV1().Jobs(c.scope.single).List(context.TODO(), metav1.ListOptions{
 		LabelSelector: labelSelector.String(),
 	})
 	if err != nil {
-		glog.Errorf("Error listing jobs: %v", err)
+		klog.ErrorS(err, "Error listing jobs")
 		return err
 	}
 
 	if joblist == nil || len(joblist.Items) == 0 {
-		glog.Info("No dangling or stuck jobs found...")
+		klog.InfoS("No dangling or stuck jobs found")
 		return nil
 	}
 	deletePropagation := metav1.DeletePropagationBackground
 	for _, job := range joblist.Items {
+		// Jobs of image caches outside the scope belong to other controller instances
+		if !c.scope.contains(job.Namespace) {
+			continue
+		}
 		err := c.kubeclientset.BatchV1().Jobs(job.Namespace).
 			Delete(context.TODO(), job.Name, metav1.DeleteOptions{PropagationPolicy: &deletePropagation})
 		if err != nil {
-			glog.Errorf("Error deleting job(%s): %v", job.Name, err)
+			klog.ErrorS(err, "Error deleting job", "job", klog.KObj(&job))
+			return err
+		}
+		klog.InfoS("Dangling job deleted", "job", klog.KObj(&job))
+	}
+	return nil
+}
+
+// danglingImageTasks finds and removes dangling or stuck image tasks
+func (c *Controller) danglingImageTasks() error {
+	appEqKubefledged, _ := labels.NewRequirement("app", selection.Equals, []string{"kubefledged"})
+	kubefledgedEqImagemanager, _ := labels.NewRequirement("kubefledged", selection.Equals, []string{"kubefledged-image-manager"})
+	labelSelector := labels.NewSelector()
+	labelSelector = labelSelector.Add(*appEqKubefledged, *kubefledgedEqImagemanager)
+
+	tasklist, err := c.kubefledgedclientset.KubefledgedV1alpha3().ImageTasks(c.scope.single).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: labelSelector.String(),
+	})
+	if err != nil {
+		klog.ErrorS(err, "Error listing image tasks")
+		return err
+	}
+
+	if tasklist == nil || len(tasklist.Items) == 0 {
+		klog.InfoS("No dangling or stuck image tasks found")
+		return nil
+	}
+	for _, task := range tasklist.Items {
+		// Image tasks of image caches outside the scope belong to other controller instances
+		if !c.scope.contains(task.Namespace) {
+			continue
+		}
+		err := c.kubefledgedclientset.KubefledgedV1alpha3().ImageTasks(task.Namespace).
+			Delete(context.TODO(), task.Name, metav1.DeleteOptions{})
+		if err != nil {
+			klog.ErrorS(err, "Error deleting image task", "imagetask", klog.KObj(&task))
 			return err
 		}
-		glog.Infof("Dangling Job(%s) deleted", job.Name)
+		klog.InfoS("Dangling image task deleted", "imagetask", klog.KObj(&task))
 	}
 	return nil
 }
@@ -286,14 +364,14 @@ func (c *Controller) danglingJobs() error {
 // image caches will get refreshed in the next cycle
 func (c *Controller) danglingImageCaches() error {
 	dangling := false
-	imagecachelist, err := c.kubefledgedclientset.KubefledgedV1alpha3().ImageCaches("").List(context.TODO(), metav1.ListOptions{})
+	imagecachelist, err := c.kubefledgedclientset.KubefledgedV1alpha3().ImageCaches(c.scope.single).List(context.TODO(), metav1.ListOptions{})
 	if err != nil {
-		glog.Errorf("Error listing imagecaches: %v", err)
+		klog.ErrorS(err, "Error listing imagecaches")
 		return err
 	}
 
 	if imagecachelist == nil || len(imagecachelist.Items) == 0 {
-		glog.Info("No dangling or stuck imagecaches found...")
+		klog.InfoS("No dangling or stuck imagecaches found")
 		return nil
 	}
 	status := &v1alpha3.ImageCacheStatus{
@@ -303,20 +381,23 @@ func (c *Controller) danglingImageCaches() error {
 		Message:  v1alpha3.ImageCacheMessageImagePullAborted,
 	}
 	for _, imagecache := range imagecachelist.Items {
+		if !c.scope.contains(imagecache.Namespace) {
+			continue
+		}
 		if imagecache.Status.Status == v1alpha3.ImageCacheActionStatusProcessing {
 			status.StartTime = imagecache.Status.StartTime
-			err := c.updateImageCacheStatus(&imagecache, status)
+			err := c.updateImageCacheStatus(context.Background(), &imagecache, status)
 			if err != nil {
-				glog.Errorf("Error updating ImageCache(%s) status to '%s': %v", imagecache.Name, v1alpha3.ImageCacheActionStatusAborted, err)
+				klog.ErrorS(err, "Error updating imagecache status", "imagecache", imagecache.Name, "namespace", imagecache.Namespace, "status", v1alpha3.ImageCacheActionStatusAborted)
 				return err
 			}
 			dangling = true
-			glog.Infof("Dangling Image cache(%s) status changed to '%s'", imagecache.Name, v1alpha3.ImageCacheActionStatusAborted)
+			klog.InfoS("Dangling imagecache status changed", "imagecache", imagecache.Name, "namespace", imagecache.Namespace, "status", v1alpha3.ImageCacheActionStatusAborted)
 		}
 	}
 
 	if !dangling {
-		glog.Info("No dangling or stuck imagecaches found...")
+		klog.InfoS("No dangling or stuck imagecaches found")
 	}
 	return nil
 }
@@ -331,33 +412,36 @@ func (c *Controller) Run(threadiness int, stopCh <-chan struct{}) error {
 	defer c.imageworkqueue.ShutDown()
 
 	// Start the informer factories to begin populating the informer caches
-	glog.Info("Starting kubefledged-controller")
+	klog.InfoS("Starting kubefledged-controller")
 
 	// Wait for the caches to be synced before starting workers
-	if ok := cache.WaitForCacheSync(stopCh, c.nodesSynced, c.imageCachesSynced); !ok {
+	cacheSyncs := []cache.InformerSynced{c.nodesSynced, c.imageCachesSynced}
+	if c.namespacesSynced != nil {
+		cacheSyncs = append(cacheSyncs, c.namespacesSynced)
+	}
+	if ok := cache.WaitForCacheSync(stopCh, cacheSyncs...); !ok {
 		return fmt.Errorf("failed to wait for caches to sync")
 	}
-	glog.Info("Informer caches synched successfull")
+	klog.InfoS("Informer caches synced successfully")
 
 	// Launch workers to process ImageCache resources
 	for i := 0; i < threadiness; i++ {
 		go wait.Until(c.runWorker, time.Second, stopCh)
 	}
-	glog.Info("Image cache worker started")
+	klog.InfoS("Image cache worker started")
 
-	if c.imageCacheRefreshFrequency.Nanoseconds() != int64(0) {
-		go wait.Until(c.runRefreshWorker, c.imageCacheRefreshFrequency, stopCh)
-		glog.Info("Image cache refresh worker started")
-	}
+	go c.runRefreshLoop(stopCh)
+	klog.InfoS("Image cache refresh worker started")
 
 	c.imageManager.Run(stopCh)
 	if err := c.imageManager.Run(stopCh); err != nil {
-		glog.Fatalf("Error running image manager: %s", err.Error())
+		klog.ErrorS(err, "Error running image manager")
+		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
 	}
-	glog.Info("Image manager started")
+	klog.InfoS("Image manager started")
 
 	<-stopCh
-	glog.Info("Shutting down workers")
+	klog.InfoS("Shutting down workers")
 
 	return nil
 }
@@ -385,11 +469,30 @@ func (c *Controller) enqueueImageCache(workType images.WorkType, old, new interf
 		oldImageCache := old.(*v1alpha3.ImageCache)
 		newImageCache := new.(*v1alpha3.ImageCache)
 
+		// Cancelling is accepted while the image cache is under processing
+		if _, exists := newImageCache.Annotations[imageCacheCancelAnnotationKey]; exists {
+			if _, exists := oldImageCache.Annotations[imageCacheCancelAnnotationKey]; !exists {
+				workType = images.ImageCacheCancel
+				break
+			}
+		}
+		// A spec change is reconciled once the sync action in progress completes
 		if oldImageCache.Status.Status == v1alpha3.ImageCacheActionStatusProcessing {
 			if !reflect.DeepEqual(newImageCache.Spec, oldImageCache.Spec) {
-				glog.Warningf("Received image cache update/purge/delete for '%s' while it is under processing, so ignoring.", oldImageCache.Name)
-				return false
+				klog.InfoS("Received image cache update while it is under processing, so deferring", "imagecache", oldImageCache.Name, "namespace", oldImageCache.Namespace)
+				workType = images.ImageCachePendingUpdate
+				break
+			}
+		}
+		// Removing the plan annotation applies the planned changes
+		if isPlanned(oldImageCache) && !isPlanned(newImageCache) && newImageCache.Status.Plan != nil {
+			workType = images.ImageCacheUpdate
+			if _, exists := newImageCache.Annotations[imageCachePurgeAnnotationKey]; exists {
+				workType = images.ImageCachePurge
+			} else if _, exists := newImageCache.Annotations[imageCacheRefreshAnnotationKey]; exists {
+				workType = images.ImageCacheRefresh
 			}
+			break
 		}
 		if _, exists := newImageCache.Annotations[imageCachePurgeAnnotationKey]; exists {
 			if _, exists := oldImageCache.Annotations[imageCachePurgeAnnotationKey]; !exists {
@@ -407,25 +510,32 @@ func (c *Controller) enqueueImageCache(workType images.WorkType, old, new interf
 			return false
 		}
 	case images.ImageCacheDelete:
-		return false
+		obj = old
+		if obj == nil {
+			return false
+		}
 
 	case images.ImageCacheRefresh:
 		obj = old
 	}
 
-	if key, err = cache.MetaNamespaceKeyFunc(obj); err != nil {
+	if key, err = cache.DeletionHandlingMetaNamespaceKeyFunc(obj); err != nil {
 		runtime.HandleError(err)
 		return false
 	}
+	if namespace, _, _ := cache.SplitMetaNamespaceKey(key); !c.scope.contains(namespace) {
+		klog.V(4).InfoS("ImageCache outside of the watched namespaces, ignoring", "imagecache", key)
+		return false
+	}
 	wqKey.WorkType = workType
 	wqKey.ObjKey = key
-	if workType == images.ImageCacheUpdate {
+	if workType == images.ImageCacheUpdate || workType == images.ImageCachePendingUpdate {
 		oldImageCache := old.(*v1alpha3.ImageCache)
 		wqKey.OldImageCache = oldImageCache
 	}
 
 	c.workqueue.AddRateLimited(wqKey)
-	glog.V(4).Infof("enqueueImageCache::ImageCache resource queued for work type %s", workType)
+	klog.V(4).InfoS("ImageCache resource queued", "imagecache", key, "workType", workType)
 	return true
 }
 
@@ -440,7 +550,6 @@ func (c *Controller) runWorker() {
 // processNextWorkItem will read a single work item off the workqueue and
 // attempt to process it, by calling the syncHandler.
 func (c *Controller) processNextWorkItem() bool {
-	//glog.Info("processNextWorkItem::Beginning...")
 	obj, shutdown := c.workqueue.Get()
 
 	if shutdown {
@@ -474,13 +583,12 @@ func (c *Controller) processNextWorkItem() bool {
 		// Run the syncHandler, passing it the namespace/name string of the
 		// ImageCache resource to be synced.
 		if err := c.syncHandler(key); err != nil {
-			glog.Errorf("error syncing imagecache: %v", err.Error())
+			klog.ErrorS(err, "Error syncing imagecache", "imagecache", key.ObjKey, "workType", key.WorkType)
 			return fmt.Errorf("error syncing imagecache: %v", err.Error())
 		}
 		// Finally, if no error occurs we Forget this item so it does not
 		// get queued again until another change happens.
 		c.workqueue.Forget(obj)
-		//glog.Infof("Successfully synced '%s' for event '%s'", key.ObjKey, key.WorkType)
 		return nil
 	}(obj)
 
@@ -492,64 +600,216 @@ func (c *Controller) processNextWorkItem() bool {
 	return true
 }
 
+// UpdateConfiguration applies a reloaded configuration. Settings which need a
+// restart are logged and otherwise ignored until then.
+func (c *Controller) UpdateConfiguration(cfg *config.ControllerConfiguration) {
+	c.cfgLock.Lock()
+	for _, setting := range config.RestartRequired(&c.cfg, cfg) {
+		klog.InfoS("Configuration setting changed, restart kubefledged-controller to apply it", "setting", setting)
+	}
+	refreshChanged := c.cfg.ImageCacheRefreshFrequency != cfg.ImageCacheRefreshFrequency
+	namespace, loggingFormat := c.cfg.Namespace, c.cfg.LoggingFormat
+	otlpEndpoint, otlpInsecure := c.cfg.OTLPEndpoint, c.cfg.OTLPInsecure
+	c.cfg = *cfg
+	c.cfg.Namespace, c.cfg.LoggingFormat = namespace, loggingFormat
+	c.cfg.OTLPEndpoint, c.cfg.OTLPInsecure = otlpEndpoint, otlpInsecure
+	applied := c.cfg
+	c.cfgLock.Unlock()
+
+	c.imageManager.UpdateConfiguration(&applied)
+	if refreshChanged {
+		klog.InfoS("Image cache refresh frequency changed", "frequency", applied.ImageCacheRefreshFrequency.Duration)
+		select {
+		case c.refreshChanged <- struct{}{}:
+		default:
+		}
+	}
+	klog.InfoS("Configuration reloaded")
+}
+
+// refreshFrequency returns the currently configured image cache refresh frequency
+func (c *Controller) refreshFrequency() time.Duration {
+	c.cfgLock.RLock()
+	defer c.cfgLock.RUnlock()
+	return c.cfg.ImageCacheRefreshFrequency.Duration
+}
+
+// maintenanceWindowOpensIn returns how long a sync of the image cache has to
+// wait for the next maintenance window, 0 if it can run now. Urgent syncs and
+// plans, which create no jobs, do not wait.
+func (c *Controller) maintenanceWindowOpensIn(imageCache *v1alpha3.ImageCache, urgent bool) time.Duration {
+	if urgent || isPlanned(imageCache) {
+		return 0
+	}
+	c.cfgLock.RLock()
+	cfg := c.cfg
+	c.cfgLock.RUnlock()
+	return images.MaintenanceWindowOpensIn(imageCache, cfg, time.Now())
+}
+
+// isUrgent reports whether the sync is a create or update of an image cache
+// which bypasses the maintenance windows
+func isUrgent(workType images.WorkType, imageCache *v1alpha3.ImageCache) bool {
+	return imageCache.Spec.BypassMaintenanceWindows &&
+		(workType == images.ImageCacheCreate || workType == images.ImageCacheUpdate)
+}
+
+// runRefreshLoop refreshes the image caches at the configured frequency until
+// stopCh is closed. A frequency of 0s disables refresh until it is changed.
+func (c *Controller) runRefreshLoop(stopCh <-chan struct{}) {
+	refresh := true
+	for {
+		frequency := c.refreshFrequency()
+		var timer *time.Timer
+		var tick <-chan time.Time
+		if frequency != 0 {
+			if refresh {
+				c.runRefreshWorker()
+			}
+			timer = time.NewTimer(frequency)
+			tick = timer.C
+		}
+		refresh = false
+		select {
+		case <-stopCh:
+		case <-c.refreshChanged:
+		case <-tick:
+			refresh = true
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		select {
+		case <-stopCh:
+			return
+		default:
+		}
+	}
+}
+
 // runRefreshWorker is resposible of refreshing the image cache
 func (c *Controller) runRefreshWorker() {
 	// List the ImageCache resources
-	imageCaches, err := c.imageCachesLister.ImageCaches("").List(labels.Everything())
+	imageCaches, err := c.imageCachesLister.ImageCaches(c.scope.single).List(labels.Everything())
 	if err != nil {
-		glog.Errorf("Error in listing image caches: %v", err)
+		klog.ErrorS(err, "Error listing image caches")
 		return
 	}
 	for i := range imageCaches {
-		// Do not refresh if status is not yet updated
-		if reflect.DeepEqual(imageCaches[i].Status, v1alpha3.ImageCacheStatus{}) {
-			continue
-		}
-		// Do not refresh if image cache is already under processing
-		if imageCaches[i].Status.Status == v1alpha3.ImageCacheActionStatusProcessing {
+		if !c.scope.contains(imageCaches[i].Namespace) {
 			continue
 		}
-		// Do not refresh image cache if cache spec validation failed
-		if imageCaches[i].Status.Status == v1alpha3.ImageCacheActionStatusFailed &&
-			imageCaches[i].Status.Reason == v1alpha3.ImageCacheReasonCacheSpecValidationFailed {
+		if !isRefreshable(imageCaches[i]) {
 			continue
 		}
-		// Do not refresh if image cache has been purged
-		if imageCaches[i].Status.Reason == v1alpha3.ImageCacheReasonImageCachePurge {
+		// Refresh when the next maintenance window opens. Refreshes of the same
+		// image cache waiting for the window are merged by the work queue.
+		if opensIn := c.maintenanceWindowOpensIn(imageCaches[i], false); opensIn > 0 {
+			if key, err := cache.MetaNamespaceKeyFunc(imageCaches[i]); err == nil {
+				klog.V(4).InfoS("Refresh deferred until maintenance window opens", "imagecache", key, "opensIn", opensIn)
+				c.workqueue.AddAfter(images.WorkQueueKey{WorkType: images.ImageCacheRefresh, ObjKey: key, Deferred: true}, opensIn)
+			}
 			continue
 		}
 		c.enqueueImageCache(images.ImageCacheRefresh, imageCaches[i], nil)
 	}
 }
 
+// isRefreshable reports whether the image cache is to be refreshed
+func isRefreshable(imageCache *v1alpha3.ImageCache) bool {
+	// Do not refresh if status is not yet updated
+	if reflect.DeepEqual(imageCache.Status, v1alpha3.ImageCacheStatus{}) {
+		return false
+	}
+	// Do not refresh if image cache is already under processing
+	if imageCache.Status.Status == v1alpha3.ImageCacheActionStatusProcessing {
+		return false
+	}
+	// Do not refresh image cache if cache spec validation failed
+	if imageCache.Status.Status == v1alpha3.ImageCacheActionStatusFailed &&
+		imageCache.Status.Reason == v1alpha3.ImageCacheReasonCacheSpecValidationFailed {
+		return false
+	}
+	// Do not refresh while changes of the image cache are only planned
+	if isPlanned(imageCache) {
+		return false
+	}
+	// Do not refresh if image cache has been purged
+	return imageCache.Status.Reason != v1alpha3.ImageCacheReasonImageCachePurge
+}
+
 // syncHandler compares the actual state with the desired, and attempts to
 // converge the two. It then updates the Status block of the ImageCache resource
 // with the current status of the resource.
-func (c *Controller) syncHandler(wqKey images.WorkQueueKey) error {
+func (c *Controller) syncHandler(wqKey images.WorkQueueKey) (err error) {
 	status := &v1alpha3.ImageCacheStatus{
 		Failures: map[string]v1alpha3.NodeReasonMessageList{},
 	}
 
+	// A status update continues the trace of the sync action that produced it,
+	// every other work type starts a new trace.
+	ctx, span := tracing.Tracer().Start(tracing.Extract(context.Background(), wqKey.TraceParent), "Controller.syncHandler",
+		trace.WithAttributes(tracing.AttrWorkType.String(string(wqKey.WorkType))))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	// Node warm-ups, drift checks and startup taint timeouts are keyed by the node name
+	switch wqKey.WorkType {
+	case images.NodeWarmup:
+		span.SetAttributes(tracing.AttrNode.String(wqKey.ObjKey))
+		return c.warmupNode(ctx, wqKey.ObjKey)
+	case images.NodeDriftCheck:
+		span.SetAttributes(tracing.AttrNode.String(wqKey.ObjKey))
+		return c.checkNodeDrift(ctx, wqKey.ObjKey)
+	case images.NodeStartupTaintTimeout:
+		span.SetAttributes(tracing.AttrNode.String(wqKey.ObjKey))
+		c.removeStartupTaint(ctx, wqKey.ObjKey, "timeout")
+		return nil
+	case images.NodeWarmupStatusUpdate:
+		span.SetAttributes(tracing.AttrNode.String(wqKey.ObjKey), tracing.AttrSyncID.String(wqKey.SyncID))
+		c.completeNodeWarmup(ctx, wqKey.ObjKey, wqKey.SyncID, *wqKey.Status)
+		return nil
+	}
+
 	// Convert the namespace/name string into a distinct namespace and name
 	namespace, name, err := cache.SplitMetaNamespaceKey(wqKey.ObjKey)
 	if err != nil {
-		glog.Errorf("Error from cache.SplitMetaNamespaceKey(): %v", err)
+		klog.ErrorS(err, "Error splitting imagecache key", "key", wqKey.ObjKey)
 		return err
 	}
+	span.SetAttributes(tracing.AttrImageCache.String(name), tracing.AttrNamespace.String(namespace))
 
-	glog.Infof("Starting to sync image cache %s(%s)", name, wqKey.WorkType)
+	logValues := []interface{}{"imagecache", name, "namespace", namespace, "workType", wqKey.WorkType}
+	klog.InfoS("Starting to sync image cache", logValues...)
 
 	switch wqKey.WorkType {
+	case images.ImageCacheDelete:
+		c.removeImageCacheNodeLabels(ctx, namespace, name)
+
+	case images.ImageCacheCancel:
+		return c.cancelImageCache(ctx, wqKey.ObjKey, namespace, name, logValues)
+
+	case images.ImageCachePendingUpdate:
+		return c.deferUpdate(ctx, wqKey, namespace, name, logValues)
+
 	case images.ImageCacheCreate, images.ImageCacheUpdate, images.ImageCacheRefresh, images.ImageCachePurge:
 
 		startTime := metav1.Now()
 		status.StartTime = &startTime
+		syncID := string(uuid.NewUUID())
+		span.SetAttributes(tracing.AttrSyncID.String(syncID))
+		traceParent := tracing.Inject(ctx)
 		// Get the ImageCache resource with this namespace/name
 		imageCache, err := c.imageCachesLister.ImageCaches(namespace).Get(name)
 		if err != nil {
 			// The ImageCache resource may no longer exist, in which case we stop
 			// processing.
-			glog.Errorf("Error getting imagecache(%s): %v", name, err)
+			klog.ErrorS(err, "Error getting imagecache", logValues...)
 			return err
 		}
 
@@ -558,16 +818,41 @@ func (c *Controller) syncHandler(wqKey images.WorkQueueKey) error {
 			status.Reason = v1alpha3.ImageCacheReasonOldImageCacheNotFound
 			status.Message = v1alpha3.ImageCacheMessageOldImageCacheNotFound
 
-			if err := c.updateImageCacheStatus(imageCache, status); err != nil {
-				glog.Errorf("Error updating imagecache status to %s: %v", status.Status, err)
+			if err := c.updateImageCacheStatus(ctx, imageCache, status); err != nil {
+				klog.ErrorS(err, "Error updating imagecache status", append(logValues, "status", status.Status)...)
 				return err
 			}
-			glog.Errorf("%s: %s", v1alpha3.ImageCacheReasonOldImageCacheNotFound, v1alpha3.ImageCacheMessageOldImageCacheNotFound)
+			c.notifySync(imageCache, syncID, status)
+			klog.ErrorS(nil, v1alpha3.ImageCacheMessageOldImageCacheNotFound, append(logValues, "reason", v1alpha3.ImageCacheReasonOldImageCacheNotFound)...)
 			return fmt.Errorf("%s: %s", v1alpha3.ImageCacheReasonOldImageCacheNotFound, v1alpha3.ImageCacheMessageOldImageCacheNotFound)
 		}
 
+		// The image cache may have changed while the sync waited for the maintenance
+		// window. It is checked again as if the sync was queued just now.
+		if wqKey.Deferred {
+			switch {
+			case wqKey.WorkType == images.ImageCacheRefresh && !isRefreshable(imageCache),
+				wqKey.WorkType == images.ImageCacheCreate && !reflect.DeepEqual(imageCache.Status, v1alpha3.ImageCacheStatus{}):
+				klog.InfoS("Deferred sync of image cache no longer required, dropping", logValues...)
+				return nil
+			case wqKey.WorkType == images.ImageCacheUpdate && imageCache.Status.Status == v1alpha3.ImageCacheActionStatusProcessing:
+				return c.deferUpdate(ctx, wqKey, namespace, name, logValues)
+			}
+		}
+
+		urgent := isUrgent(wqKey.WorkType, imageCache)
+		if opensIn := c.maintenanceWindowOpensIn(imageCache, urgent); opensIn > 0 {
+			klog.InfoS("Sync deferred until maintenance window opens", append(logValues, "opensIn", opensIn)...)
+			c.recorder.Eventf(imageCache, corev1.EventTypeNormal, v1alpha3.ImageCacheReasonMaintenanceWindow,
+				"%s of image cache deferred until the next maintenance window opens at %s", wqKey.WorkType,
+				time.Now().Add(opensIn).UTC().Format(time.RFC3339))
+			wqKey.Deferred = true
+			c.workqueue.AddAfter(wqKey, opensIn)
+			return nil
+		}
+
 		cacheSpec := imageCache.Spec.CacheSpec
-		glog.V(4).Infof("cacheSpec: %+v", cacheSpec)
+		klog.V(4).InfoS("Syncing cache spec", append(logValues, "cacheSpec", cacheSpec)...)
 		var nodes []*corev1.Node
 
 		status.Status = v1alpha3.ImageCacheActionStatusProcessing
@@ -592,30 +877,38 @@ func (c *Controller) syncHandler(wqKey images.WorkQueueKey) error {
 			status.Message = v1alpha3.ImageCacheMessagePurgeCache
 		}
 
-		imageCache, err = c.kubefledgedclientset.KubefledgedV1alpha3().ImageCaches(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		imageCache, err = c.kubefledgedclientset.KubefledgedV1alpha3().ImageCaches(namespace).Get(ctx, name, metav1.GetOptions{})
 		if err != nil {
-			glog.Errorf("Error getting imagecache(%s) from api server: %v", name, err)
+			klog.ErrorS(err, "Error getting imagecache from api server", logValues...)
 			return err
 		}
 
-		if err = c.updateImageCacheStatus(imageCache, status); err != nil {
-			glog.Errorf("Error updating imagecache status to %s: %v", status.Status, err)
-			return err
+		// A planned sync leaves the status as is until the plan is written. Otherwise
+		// the deletions of an earlier plan are applied, the status update clears it.
+		planned := isPlanned(imageCache)
+		var requests []images.ImageWorkRequest
+		if planned {
+			klog.InfoS("Planning sync of image cache", logValues...)
+		} else {
+			requests = c.plannedDeletes(imageCache, imageCache.Status.Plan)
+			for i := range requests {
+				requests[i].SyncID, requests[i].TraceParent = syncID, traceParent
+			}
 		}
 
 		for k, i := range cacheSpec {
 			if len(i.NodeSelector) > 0 {
 				if nodes, err = c.nodesLister.List(labels.Set(i.NodeSelector).AsSelector()); err != nil {
-					glog.Errorf("Error listing nodes using nodeselector %+v: %v", i.NodeSelector, err)
+					klog.ErrorS(err, "Error listing nodes using nodeselector", append(logValues, "nodeSelector", i.NodeSelector)...)
 					return err
 				}
 			} else {
 				if nodes, err = c.nodesLister.List(labels.Everything()); err != nil {
-					glog.Errorf("Error listing nodes using nodeselector labels.Everything(): %v", err)
+					klog.ErrorS(err, "Error listing nodes", logValues...)
 					return err
 				}
 			}
-			glog.V(4).Infof("No. of nodes in %+v is %d", i.NodeSelector, len(nodes))
+			klog.V(4).InfoS("Listed nodes matching nodeselector", append(logValues, "nodeSelector", i.NodeSelector, "nodes", len(nodes))...)
 
 			for _, n := range nodes {
 				for _, image := range i.Images {
@@ -626,14 +919,18 @@ func (c *Controller) syncHandler(wqKey images.WorkQueueKey) error {
 						ContainerRuntimeVersion: n.Status.NodeInfo.ContainerRuntimeVersion,
 						WorkType:                wqKey.WorkType,
 						Imagecache:              imageCache,
+						SyncID:                  syncID,
+						TraceParent:             traceParent,
+						Plan:                    planned,
+						Urgent:                  urgent,
 					}
-					c.imageworkqueue.AddRateLimited(ipr)
+					requests = append(requests, ipr)
 				}
 				if wqKey.WorkType == images.ImageCacheUpdate {
 					for _, oldimage := range wqKey.OldImageCache.Spec.CacheSpec[k].Images {
 						matched := false
 						for _, newimage := range i.Images {
-							if oldimage == newimage {
+							if oldimage.Name == newimage.Name && oldimage.ForceFullCache == newimage.ForceFullCache {
 								matched = true
 								break
 							}
@@ -646,26 +943,47 @@ func (c *Controller) syncHandler(wqKey images.WorkQueueKey) error {
 								ContainerRuntimeVersion: n.Status.NodeInfo.ContainerRuntimeVersion,
 								WorkType:                images.ImageCachePurge,
 								Imagecache:              imageCache,
+								SyncID:                  syncID,
+								TraceParent:             traceParent,
+								Plan:                    planned,
+								Urgent:                  urgent,
 							}
-							c.imageworkqueue.AddRateLimited(ipr)
+							requests = append(requests, ipr)
 						}
 					}
 				}
 			}
 		}
 
+		// The status is written once the requests are known, so that it shows what
+		// the sync action is going to do right from the start
+		if !planned {
+			setRequestCounts(status, requests)
+			if err = c.updateImageCacheStatus(ctx, imageCache, status); err != nil {
+				klog.ErrorS(err, "Error updating imagecache status", append(logValues, "status", status.Status)...)
+				return err
+			}
+		}
+		for _, ipr := range requests {
+			c.imageworkqueue.AddRateLimited(ipr)
+		}
+
 		// We add an empty image pull request to signal the image manager that all
 		// requests for this sync action have been placed in the imageworkqueue
-		c.imageworkqueue.AddRateLimited(images.ImageWorkRequest{WorkType: wqKey.WorkType, Imagecache: imageCache})
+		c.activeSyncs.start(wqKey.ObjKey, syncID)
+		c.imageworkqueue.AddRateLimited(images.ImageWorkRequest{WorkType: wqKey.WorkType, Imagecache: imageCache,
+			SyncID: syncID, TraceParent: traceParent, Plan: planned, Requests: len(requests)})
 
 	case images.ImageCacheStatusUpdate:
-		glog.V(4).Infof("wqKey.Status = %+v", wqKey.Status)
+		klog.V(4).InfoS("Received image work results", append(logValues, "syncID", wqKey.SyncID, "results", len(*wqKey.Status))...)
+		span.SetAttributes(tracing.AttrSyncID.String(wqKey.SyncID))
+		c.activeSyncs.finish(wqKey.ObjKey, wqKey.SyncID)
 		// Finally, we update the status block of the ImageCache resource to reflect the
 		// current state of the world
 		// Get the ImageCache resource with this namespace/name
-		imageCache, err := c.kubefledgedclientset.KubefledgedV1alpha3().ImageCaches(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		imageCache, err := c.kubefledgedclientset.KubefledgedV1alpha3().ImageCaches(namespace).Get(ctx, name, metav1.GetOptions{})
 		if err != nil {
-			glog.Errorf("Error getting image cache %s: %v", name, err)
+			klog.ErrorS(err, "Error getting imagecache", logValues...)
 			return err
 		}
 
@@ -677,8 +995,11 @@ func (c *Controller) syncHandler(wqKey images.WorkQueueKey) error {
 		status.Reason = imageCache.Status.Reason
 		status.Message = v1alpha3.ImageCacheMessageNoImagesPulledOrDeleted
 
-		failures := false
+		failures, cancelled := false, false
 		for _, v := range *wqKey.Status {
+			if v.Status == images.ImageWorkResultStatusCancelled {
+				cancelled = true
+			}
 			if (v.Status == images.ImageWorkResultStatusSucceeded || v.Status == images.ImageWorkResultStatusAlreadyPulled) && !failures {
 				status.Status = v1alpha3.ImageCacheActionStatusSucceeded
 				if v.ImageWorkRequest.WorkType == images.ImageCachePurge {
@@ -696,38 +1017,54 @@ func (c *Controller) syncHandler(wqKey images.WorkQueueKey) error {
 					status.Message = v1alpha3.ImageCacheMessageImagePullFailedForSomeImages
 				}
 			}
-			if v.Status == images.ImageWorkResultStatusFailed || v.Status == images.ImageWorkResultStatusUnknown {
-				status.Failures[v.ImageWorkRequest.Image] = append(
-					status.Failures[v.ImageWorkRequest.Image], v1alpha3.NodeReasonMessage{
-						Node:    v.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"],
-						Reason:  v.Reason,
-						Message: v.Message,
-					})
+			if v.Status == images.ImageWorkResultStatusFailed || v.Status == images.ImageWorkResultStatusUnknown ||
+				v.Status == images.ImageWorkResultStatusCancelled {
+				failure := v1alpha3.NodeReasonMessage{
+					Node:    images.NodeHostname(v.ImageWorkRequest.Node),
+					Reason:  v.Reason,
+					Message: v.Message,
+				}
+				if imageCache.Spec.RetryPolicy != nil {
+					failure.Attempts = v.ImageWorkRequest.Attempts()
+				}
+				status.Failures[v.ImageWorkRequest.Image] = append(status.Failures[v.ImageWorkRequest.Image], failure)
 			}
 		}
+		if cancelled {
+			status.Status = v1alpha3.ImageCacheActionStatusAborted
+			status.Reason = v1alpha3.ImageCacheReasonImageCacheCancelled
+			status.Message = v1alpha3.ImageCacheMessageImageCacheCancelled
+		}
+		// The pending spec change stays visible until its sync action starts
+		status.PendingGeneration = imageCache.Status.PendingGeneration
+		setResultCounts(status, *wqKey.Status, true)
 
-		err = c.updateImageCacheStatus(imageCache, status)
+		err = c.updateImageCacheStatus(ctx, imageCache, status)
 		if err != nil {
-			glog.Errorf("Error updating ImageCache status: %v", err)
+			klog.ErrorS(err, "Error updating imagecache status", append(logValues, "status", status.Status)...)
 			return err
 		}
+		c.syncImageCacheNodeLabels(ctx, imageCache, status, *wqKey.Status)
+		c.recordNodeEvents(*wqKey.Status)
+		c.recordImageCacheRun(ctx, imageCache, wqKey.SyncID, status, *wqKey.Status)
+		c.notifySync(imageCache, wqKey.SyncID, status)
 
 		if imageCache.Status.Reason == v1alpha3.ImageCacheReasonImageCachePurge || imageCache.Status.Reason == v1alpha3.ImageCacheReasonImageCacheRefresh {
-			imageCache, err := c.kubefledgedclientset.KubefledgedV1alpha3().ImageCaches(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+			imageCache, err := c.kubefledgedclientset.KubefledgedV1alpha3().ImageCaches(namespace).Get(ctx, name, metav1.GetOptions{})
 			if err != nil {
-				glog.Errorf("Error getting image cache %s: %v", name, err)
+				klog.ErrorS(err, "Error getting imagecache", logValues...)
 				return err
 			}
 			if imageCache.Status.Reason == v1alpha3.ImageCacheReasonImageCachePurge {
 				if err := c.removeAnnotation(imageCache, imageCachePurgeAnnotationKey); err != nil {
-					glog.Errorf("Error removing Annotation %s from imagecache(%s): %v", imageCachePurgeAnnotationKey, imageCache.Name, err)
+					klog.ErrorS(err, "Error removing annotation from imagecache", append(logValues, "annotation", imageCachePurgeAnnotationKey)...)
 					return err
 				}
 			}
 			if imageCache.Status.Reason == v1alpha3.ImageCacheReasonImageCacheRefresh {
 				if _, ok := imageCache.Annotations[imageCacheRefreshAnnotationKey]; ok {
 					if err := c.removeAnnotation(imageCache, imageCacheRefreshAnnotationKey); err != nil {
-						glog.Errorf("Error removing Annotation %s from imagecache(%s): %v", imageCacheRefreshAnnotationKey, imageCache.Name, err)
+						klog.ErrorS(err, "Error removing annotation from imagecache", append(logValues, "annotation", imageCacheRefreshAnnotationKey)...)
 						return err
 					}
 				}
@@ -738,17 +1075,101 @@ func (c *Controller) syncHandler(wqKey images.WorkQueueKey) error {
 			c.recorder.Event(imageCache, corev1.EventTypeNormal, status.Reason, status.Message)
 		}
 
-		if status.Status == v1alpha3.ImageCacheActionStatusFailed {
+		if status.Status == v1alpha3.ImageCacheActionStatusFailed || status.Status == v1alpha3.ImageCacheActionStatusAborted {
 			c.recorder.Event(imageCache, corev1.EventTypeWarning, status.Reason, status.Message)
 		}
+		c.queuePendingUpdate(wqKey.ObjKey)
+
+	case images.ImageCachePlanStatusUpdate:
+		span.SetAttributes(tracing.AttrSyncID.String(wqKey.SyncID))
+		c.activeSyncs.finish(wqKey.ObjKey, wqKey.SyncID)
+		imageCache, err := c.kubefledgedclientset.KubefledgedV1alpha3().ImageCaches(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			klog.ErrorS(err, "Error getting imagecache", logValues...)
+			return err
+		}
+		status = imageCache.Status.DeepCopy()
+		status.Plan = newImageCachePlan(imageCache, *wqKey.Status)
+		if err = c.updateImageCacheStatus(ctx, imageCache, status); err != nil {
+			klog.ErrorS(err, "Error updating imagecache status", append(logValues, "status", status.Status)...)
+			return err
+		}
+		c.recorder.Event(imageCache, corev1.EventTypeNormal, v1alpha3.ImageCacheReasonImageCachePlan, v1alpha3.ImageCacheMessageImageCachePlanned)
+
+	case images.ImageCacheRetryStatusUpdate:
+		span.SetAttributes(tracing.AttrSyncID.String(wqKey.SyncID))
+		imageCache, err := c.kubefledgedclientset.KubefledgedV1alpha3().ImageCaches(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			klog.ErrorS(err, "Error getting imagecache", logValues...)
+			return err
+		}
+		// The final status of the sync action has already been written
+		if imageCache.Status.Status != v1alpha3.ImageCacheActionStatusProcessing {
+			return nil
+		}
+		status = imageCache.Status.DeepCopy()
+		if status.Failures == nil {
+			status.Failures = map[string]v1alpha3.NodeReasonMessageList{}
+		}
+		status.Message = v1alpha3.ImageCacheMessageImagePullRetryScheduled
+		for _, v := range *wqKey.Status {
+			failure := v1alpha3.NodeReasonMessage{
+				Node:          images.NodeHostname(v.ImageWorkRequest.Node),
+				Reason:        v.Reason,
+				Message:       v.Message,
+				Attempts:      v.ImageWorkRequest.Attempts(),
+				NextRetryTime: v.NextRetryTime,
+			}
+			status.Failures[v.ImageWorkRequest.Image] = setNodeFailure(status.Failures[v.ImageWorkRequest.Image], failure)
+			c.recorder.Eventf(imageCache, corev1.EventTypeWarning, v1alpha3.ImageCacheReasonImagePullRetryScheduled,
+				"Pull of image %s failed on node %s (attempt %d), retrying at %s", v.ImageWorkRequest.Image,
+				failure.Node, failure.Attempts, v.NextRetryTime.Format(time.RFC3339))
+		}
+		if err = c.updateImageCacheStatus(ctx, imageCache, status); err != nil {
+			klog.ErrorS(err, "Error updating imagecache status", append(logValues, "status", status.Status)...)
+			return err
+		}
+		c.recordNodeEvents(*wqKey.Status)
+	case images.ImageCacheProgressStatusUpdate:
+		span.SetAttributes(tracing.AttrSyncID.String(wqKey.SyncID))
+		imageCache, err := c.kubefledgedclientset.KubefledgedV1alpha3().ImageCaches(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			klog.ErrorS(err, "Error getting imagecache", logValues...)
+			return err
+		}
+		// The final status of the sync action has already been written
+		if imageCache.Status.Status != v1alpha3.ImageCacheActionStatusProcessing {
+			return nil
+		}
+		status = imageCache.Status.DeepCopy()
+		status.QueuedRequests = 0
+		for _, v := range *wqKey.Status {
+			if v.Status == images.ImageWorkResultStatusQueued {
+				status.QueuedRequests++
+			}
+		}
+		setResultCounts(status, *wqKey.Status, false)
+		if err = c.updateImageCacheStatus(ctx, imageCache, status); err != nil {
+			klog.ErrorS(err, "Error updating imagecache status", append(logValues, "status", status.Status)...)
+			return err
+		}
 	}
-	glog.Infof("Completed sync actions for image cache %s(%s)", name, wqKey.WorkType)
+	klog.InfoS("Completed sync actions for image cache", logValues...)
 	return nil
 
 }
 
-func (c *Controller) updateImageCacheStatus(imageCache *v1alpha3.ImageCache, status *v1alpha3.ImageCacheStatus) error {
-	imageCacheCopy, err := c.kubefledgedclientset.KubefledgedV1alpha3().ImageCaches(imageCache.Namespace).Get(context.TODO(), imageCache.Name, metav1.GetOptions{})
+func (c *Controller) updateImageCacheStatus(ctx context.Context, imageCache *v1alpha3.ImageCache, status *v1alpha3.ImageCacheStatus) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Controller.updateImageCacheStatus", trace.WithAttributes(
+		tracing.AttrImageCache.String(imageCache.Name), tracing.AttrNamespace.String(imageCache.Namespace)))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+	imageCacheCopy, err := c.kubefledgedclientset.KubefledgedV1alpha3().ImageCaches(imageCache.Namespace).Get(ctx, imageCache.Name, metav1.GetOptions{})
 	if err != nil {
 		return err
 	}
@@ -756,7 +1177,8 @@ func (c *Controller) updateImageCacheStatus(imageCache *v1alpha3.ImageCache, sta
 	// You can use DeepCopy() to make a deep copy of original object and modify this copy
 	// Or create a copy manually for better performance
 	imageCacheCopy.Status = *status
-	if imageCacheCopy.Status.Status != v1alpha3.ImageCacheActionStatusProcessing {
+	// Writing a plan leaves the completion time of the last sync as is
+	if imageCacheCopy.Status.Status != v1alpha3.ImageCacheActionStatusProcessing && status.Plan == nil {
 		completionTime := metav1.Now()
 		imageCacheCopy.Status.CompletionTime = &completionTime
 	}
@@ -764,7 +1186,7 @@ func (c *Controller) updateImageCacheStatus(imageCache *v1alpha3.ImageCache, sta
 	// we must use Update instead of UpdateStatus to update the Status block of the ImageCache resource.
 	// UpdateStatus will not allow changes to the Spec of the resource,
 	// which is ideal for ensuring nothing other than resource status has been updated.
-	_, err = c.kubefledgedclientset.KubefledgedV1alpha3().ImageCaches(imageCache.Namespace).Update(context.TODO(), imageCacheCopy, metav1.UpdateOptions{})
+	_, err = c.kubefledgedclientset.KubefledgedV1alpha3().ImageCaches(imageCache.Namespace).Update(ctx, imageCacheCopy, metav1.UpdateOptions{})
 	return err
 }
 
@@ -773,7 +1195,18 @@ func (c *Controller) removeAnnotation(imageCache *v1alpha3.ImageCache, annotatio
 	delete(imageCacheCopy.Annotations, annotationKey)
 	_, err := c.kubefledgedclientset.KubefledgedV1alpha3().ImageCaches(imageCache.Namespace).Update(context.TODO(), imageCacheCopy, metav1.UpdateOptions{})
 	if err == nil {
-		glog.Infof("Annotation %s removed from imagecache(%s)", annotationKey, imageCache.Name)
+		klog.InfoS("Annotation removed from imagecache", "annotation", annotationKey, "imagecache", imageCache.Name, "namespace", imageCache.Namespace)
 	}
 	return err
 }
+
+// setNodeFailure replaces the failure recorded for the same node, or appends it
+func setNodeFailure(failures v1alpha3.NodeReasonMessageList, failure v1alpha3.NodeReasonMessage) v1alpha3.NodeReasonMessageList {
+	for i := range failures {
+		if failures[i].Node == failure.Node {
+			failures[i] = failure
+			return failures
+		}
+	}
+	return append(failures, failure)
+}
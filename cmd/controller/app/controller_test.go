@@ -17,7 +17,10 @@ limitations under the License.
 package app
 
 import (
+	"context"
 	"fmt"
+	"reflect"
+	"sort"
 	"strings"
 	"testing"
 	"time"
@@ -27,17 +30,22 @@ import (
 	kubefledgedclientsetfake "github.com/senthilrch/kube-fledged/pkg/client/clientset/versioned/fake"
 	informers "github.com/senthilrch/kube-fledged/pkg/client/informers/externalversions"
 	kubefledgedinformers "github.com/senthilrch/kube-fledged/pkg/client/informers/externalversions/kubefledged/v1alpha3"
+	"github.com/senthilrch/kube-fledged/pkg/config"
 	"github.com/senthilrch/kube-fledged/pkg/images"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
 	kubeinformers "k8s.io/client-go/informers"
 	coreinformers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
 	fakeclientset "k8s.io/client-go/kubernetes/fake"
+	corelisters "k8s.io/client-go/listers/core/v1"
 	core "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 )
 
 const fledgedNameSpace = "kube-fledged"
@@ -58,16 +66,16 @@ func newTestController(kubeclientset kubernetes.Interface, fledgedclientset clie
 	fledgedInformerFactory := informers.NewSharedInformerFactory(fledgedclientset, noResyncPeriodFunc())
 	nodeInformer := kubeInformerFactory.Core().V1().Nodes()
 	imagecacheInformer := fledgedInformerFactory.Kubefledged().V1alpha3().ImageCaches()
-	imageCacheRefreshFrequency := time.Second * 0
-	imagePullDeadlineDuration := time.Second * 5
-	criClientImage := "senthilrch/fledged-docker-client:latest"
-	busyboxImage := "busybox:latest"
-	imagePullPolicy := "IfNotPresent"
-	serviceAccountName := "sa-kube-fledged"
-	imageDeleteJobHostNetwork := false
-	jobPriorityClassName := "priority-class-kube-fledged"
-	canDelete := false
-	socketPath := ""
+	cfg := &config.ControllerConfiguration{
+		Namespace:                 fledgedNameSpace,
+		ImagePullDeadlineDuration: metav1.Duration{Duration: time.Second * 5},
+		CRIClientImage:            "senthilrch/fledged-docker-client:latest",
+		BusyboxImage:              "busybox:latest",
+		ImagePullPolicy:           "IfNotPresent",
+		ServiceAccountName:        "sa-kube-fledged",
+		JobPriorityClassName:      "priority-class-kube-fledged",
+		JobRetentionPolicy:        config.JobRetentionPolicyRetain,
+	}
 
 	/* 	startInformers := true
 	   	if startInformers {
@@ -77,11 +85,7 @@ func newTestController(kubeclientset kubernetes.Interface, fledgedclientset clie
 	   		fledgedInformerFactory.Start(stopCh)
 	   	} */
 
-	controller := NewController(kubeclientset,
-		fledgedclientset, fledgedNameSpace, nodeInformer, imagecacheInformer,
-		imageCacheRefreshFrequency, imagePullDeadlineDuration, criClientImage,
-		busyboxImage, imagePullPolicy, serviceAccountName, imageDeleteJobHostNetwork,
-		jobPriorityClassName, canDelete, socketPath)
+	controller := NewController(kubeclientset, fledgedclientset, nodeInformer, nil, imagecacheInformer, cfg)
 	controller.nodesSynced = func() bool { return true }
 	controller.imageCachesSynced = func() bool { return true }
 	return controller, nodeInformer, imagecacheInformer
@@ -96,6 +100,9 @@ func TestPreFlightChecks(t *testing.T) {
 		imageCacheList        *kubefledgedv1alpha3.ImageCacheList
 		imageCacheListError   error
 		imageCacheUpdateError error
+		imageTaskList         *kubefledgedv1alpha3.ImageTaskList
+		imageTaskListError    error
+		imageTaskDeleteError  error
 		expectErr             bool
 		errorString           string
 	}{
@@ -224,6 +231,53 @@ func TestPreFlightChecks(t *testing.T) {
 			expectErr:             true,
 			errorString:           "Internal error occurred: fake error",
 		},
+		{
+			name:           "#8: One dangling image task. Successful list and delete",
+			jobList:        &batchv1.JobList{Items: []batchv1.Job{}},
+			imageCacheList: &kubefledgedv1alpha3.ImageCacheList{Items: []kubefledgedv1alpha3.ImageCache{}},
+			imageTaskList: &kubefledgedv1alpha3.ImageTaskList{
+				Items: []kubefledgedv1alpha3.ImageTask{
+					{
+						ObjectMeta: metav1.ObjectMeta{
+							Name: "foo",
+							Labels: map[string]string{
+								"app":         "kubefledged",
+								"kubefledged": "kubefledged-image-manager",
+							},
+						},
+					},
+				},
+			},
+			expectErr:   false,
+			errorString: "",
+		},
+		{
+			name:               "#9: Unsuccessful listing of image tasks",
+			jobList:            &batchv1.JobList{Items: []batchv1.Job{}},
+			imageTaskListError: fmt.Errorf("fake error"),
+			expectErr:          true,
+			errorString:        "Internal error occurred: fake error",
+		},
+		{
+			name:    "#10: One dangling image task. Successful list. Unsuccessful delete",
+			jobList: &batchv1.JobList{Items: []batchv1.Job{}},
+			imageTaskList: &kubefledgedv1alpha3.ImageTaskList{
+				Items: []kubefledgedv1alpha3.ImageTask{
+					{
+						ObjectMeta: metav1.ObjectMeta{
+							Name: "foo",
+							Labels: map[string]string{
+								"app":         "kubefledged",
+								"kubefledged": "kubefledged-image-manager",
+							},
+						},
+					},
+				},
+			},
+			imageTaskDeleteError: fmt.Errorf("fake error"),
+			expectErr:            true,
+			errorString:          "Internal error occurred: fake error",
+		},
 	}
 	for _, test := range tests {
 		fakekubeclientset := &fakeclientset.Clientset{}
@@ -270,9 +324,26 @@ func TestPreFlightChecks(t *testing.T) {
 			})
 		}
 
+		if test.imageTaskListError != nil {
+			listError := apierrors.NewInternalError(test.imageTaskListError)
+			fakefledgedclientset.AddReactor("list", "imagetasks", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+				return true, nil, listError
+			})
+		} else if test.imageTaskList != nil {
+			fakefledgedclientset.AddReactor("list", "imagetasks", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+				return true, test.imageTaskList, nil
+			})
+		}
+		if test.imageTaskDeleteError != nil {
+			deleteError := apierrors.NewInternalError(test.imageTaskDeleteError)
+			fakefledgedclientset.AddReactor("delete", "imagetasks", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+				return true, nil, deleteError
+			})
+		}
+
 		controller, _, _ := newTestController(fakekubeclientset, fakefledgedclientset)
 
-		err := controller.PreFlightChecks()
+		err := controller.PreFlightChecks(nil)
 		if test.expectErr {
 			if !(err != nil && strings.HasPrefix(err.Error(), test.errorString)) {
 				t.Errorf("Test: %s failed", test.name)
@@ -286,6 +357,43 @@ func TestPreFlightChecks(t *testing.T) {
 	t.Logf("%d tests passed", len(tests))
 }
 
+func TestPreFlightChecksNamespaceSelector(t *testing.T) {
+	jobLabels := map[string]string{"app": "kubefledged", "kubefledged": "kubefledged-image-manager"}
+	fakekubeclientset := fakeclientset.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "tenant-a", Labels: map[string]string{"tenant": "a"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "tenant-b", Labels: map[string]string{"tenant": "b"}}},
+		&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "tenant-a", Labels: jobLabels}},
+		&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "tenant-b", Labels: jobLabels}},
+	)
+	fakefledgedclientset := kubefledgedclientsetfake.NewSimpleClientset()
+	kubeInformerFactory := kubeinformers.NewSharedInformerFactory(fakekubeclientset, noResyncPeriodFunc())
+	fledgedInformerFactory := informers.NewSharedInformerFactory(fakefledgedclientset, noResyncPeriodFunc())
+	cfg := &config.ControllerConfiguration{
+		Namespace:                 fledgedNameSpace,
+		WatchNamespaceSelector:    "tenant=a",
+		ImagePullDeadlineDuration: metav1.Duration{Duration: time.Second * 5},
+		JobRetentionPolicy:        config.JobRetentionPolicyRetain,
+	}
+	controller := NewController(fakekubeclientset, fakefledgedclientset, kubeInformerFactory.Core().V1().Nodes(),
+		kubeInformerFactory.Core().V1().Namespaces(), fledgedInformerFactory.Kubefledged().V1alpha3().ImageCaches(), cfg)
+
+	// Same order as the controller's main: the informers are started before the checks
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	kubeInformerFactory.Start(stopCh)
+	if err := controller.PreFlightChecks(stopCh); err != nil {
+		t.Fatalf("Test: pre-flight checks with namespace selector failed: err=%v", err)
+	}
+
+	for namespace, expectDeleted := range map[string]bool{"tenant-a": true, "tenant-b": false} {
+		_, err := fakekubeclientset.BatchV1().Jobs(namespace).Get(context.TODO(), "foo", metav1.GetOptions{})
+		if deleted := apierrors.IsNotFound(err); deleted != expectDeleted {
+			t.Errorf("Test: pre-flight checks with namespace selector failed: namespace=%s, expectDeleted=%t, actual=%t",
+				namespace, expectDeleted, deleted)
+		}
+	}
+}
+
 func TestRunRefreshWorker(t *testing.T) {
 	tests := []struct {
 		name                string
@@ -415,25 +523,958 @@ func TestRunRefreshWorker(t *testing.T) {
 			workqueueItems:      0,
 		},
 	}
-
+
+	for _, test := range tests {
+		if test.workqueueItems > 0 {
+			//TODO: How to check if workqueue contains the added item?
+			continue
+		}
+		fakekubeclientset := &fakeclientset.Clientset{}
+		fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+
+		controller, _, imagecacheInformer := newTestController(fakekubeclientset, fakefledgedclientset)
+		if test.imageCacheList != nil && len(test.imageCacheList.Items) > 0 {
+			for _, imagecache := range test.imageCacheList.Items {
+				imagecacheInformer.Informer().GetIndexer().Add(&imagecache)
+			}
+		}
+		controller.runRefreshWorker()
+		if test.workqueueItems == controller.workqueue.Len() {
+		} else {
+			t.Errorf("Test: %s failed: expected %d, actual %d", test.name, test.workqueueItems, controller.workqueue.Len())
+		}
+	}
+}
+
+func TestUpdateConfiguration(t *testing.T) {
+	fakekubeclientset := &fakeclientset.Clientset{}
+	fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+	controller, _, _ := newTestController(fakekubeclientset, fakefledgedclientset)
+
+	cfg := controller.cfg
+	cfg.Namespace = "other"
+	cfg.ImageCacheRefreshFrequency = metav1.Duration{Duration: time.Minute}
+	cfg.ImagePullPolicy = "Always"
+	controller.UpdateConfiguration(&cfg)
+
+	if controller.cfg.Namespace != fledgedNameSpace {
+		t.Errorf("Test: UpdateConfiguration failed: namespace changed without a restart: %s", controller.cfg.Namespace)
+	}
+	if controller.cfg.ImagePullPolicy != "Always" {
+		t.Errorf("Test: UpdateConfiguration failed: expected imagePullPolicy=Always, actual=%s", controller.cfg.ImagePullPolicy)
+	}
+	if controller.refreshFrequency() != time.Minute {
+		t.Errorf("Test: UpdateConfiguration failed: expected refresh frequency=%s, actual=%s", time.Minute, controller.refreshFrequency())
+	}
+	select {
+	case <-controller.refreshChanged:
+	default:
+		t.Errorf("Test: UpdateConfiguration failed: refresh loop not notified")
+	}
+}
+
+func TestNamespaceScope(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, ns := range []corev1.Namespace{
+		{ObjectMeta: metav1.ObjectMeta{Name: "tenant-a", Labels: map[string]string{"tenant": "a"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "tenant-b", Labels: map[string]string{"tenant": "b"}}},
+	} {
+		ns := ns
+		indexer.Add(&ns)
+	}
+	namespacesLister := corelisters.NewNamespaceLister(indexer)
+
+	tests := []struct {
+		name           string
+		cfg            config.ControllerConfiguration
+		namespace      string
+		expectContains bool
+		expectSingle   string
+	}{
+		{
+			name:           "#1: All namespaces by default",
+			namespace:      "tenant-a",
+			expectContains: true,
+			expectSingle:   metav1.NamespaceAll,
+		},
+		{
+			name:           "#2: Namespace not in watch list",
+			cfg:            config.ControllerConfiguration{WatchNamespaces: []string{"tenant-a"}},
+			namespace:      "tenant-b",
+			expectContains: false,
+			expectSingle:   "tenant-a",
+		},
+		{
+			name:           "#3: Namespace in watch list",
+			cfg:            config.ControllerConfiguration{WatchNamespaces: []string{"tenant-a", "tenant-b"}},
+			namespace:      "tenant-b",
+			expectContains: true,
+			expectSingle:   metav1.NamespaceAll,
+		},
+		{
+			name:           "#4: Namespace labels match selector",
+			cfg:            config.ControllerConfiguration{WatchNamespaceSelector: "tenant=a"},
+			namespace:      "tenant-a",
+			expectContains: true,
+			expectSingle:   metav1.NamespaceAll,
+		},
+		{
+			name:           "#5: Namespace labels do not match selector",
+			cfg:            config.ControllerConfiguration{WatchNamespaceSelector: "tenant=a"},
+			namespace:      "tenant-b",
+			expectContains: false,
+			expectSingle:   metav1.NamespaceAll,
+		},
+		{
+			name:           "#6: Unknown namespace with selector",
+			cfg:            config.ControllerConfiguration{WatchNamespaceSelector: "tenant"},
+			namespace:      "tenant-c",
+			expectContains: false,
+			expectSingle:   metav1.NamespaceAll,
+		},
+	}
+	for _, test := range tests {
+		scope := newNamespaceScope(&test.cfg, namespacesLister)
+		if actual := scope.contains(test.namespace); actual != test.expectContains {
+			t.Errorf("Test: %s failed: expectContains=%t, actual=%t", test.name, test.expectContains, actual)
+		}
+		if scope.single != test.expectSingle {
+			t.Errorf("Test: %s failed: expectSingle=%q, actual=%q", test.name, test.expectSingle, scope.single)
+		}
+	}
+}
+
+func TestEnqueueImageCacheOutOfScope(t *testing.T) {
+	fakekubeclientset := &fakeclientset.Clientset{}
+	fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+	controller, _, _ := newTestController(fakekubeclientset, fakefledgedclientset)
+	controller.scope = newNamespaceScope(&config.ControllerConfiguration{WatchNamespaces: []string{"tenant-a"}}, nil)
+
+	imageCache := &kubefledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "tenant-b"},
+	}
+	if controller.enqueueImageCache(images.ImageCacheCreate, nil, imageCache) {
+		t.Errorf("Test: ImageCache outside of the watched namespaces was queued")
+	}
+	imageCache.Namespace = "tenant-a"
+	if !controller.enqueueImageCache(images.ImageCacheCreate, nil, imageCache) {
+		t.Errorf("Test: ImageCache in a watched namespace was not queued")
+	}
+}
+
+// warmupSyncID returns the id of the warm-up sync of an image cache on the node
+func warmupSyncID(controller *Controller, node, imageCache string) string {
+	controller.nodeWarmups.lock.Lock()
+	defer controller.nodeWarmups.lock.Unlock()
+	for syncID, ic := range controller.nodeWarmups.nodes[node].syncs {
+		if ic.Name == imageCache {
+			return syncID
+		}
+	}
+	return ""
+}
+
+func TestNodeWarmup(t *testing.T) {
+	worker := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker1", Labels: map[string]string{"zone": "a"}},
+	}
+	fakekubeclientset := fakeclientset.NewSimpleClientset(worker)
+	fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+	controller, nodeInformer, imagecacheInformer := newTestController(fakekubeclientset, fakefledgedclientset)
+	nodeInformer.Informer().GetIndexer().Add(worker)
+	for i, nodeSelector := range []map[string]string{{"zone": "a"}, {"zone": "b"}, nil} {
+		imagecacheInformer.Informer().GetIndexer().Add(&kubefledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("cache%d", i), Namespace: fledgedNameSpace},
+			Spec: kubefledgedv1alpha3.ImageCacheSpec{
+				CacheSpec: []kubefledgedv1alpha3.CacheSpecImages{
+					{Images: []kubefledgedv1alpha3.Image{{Name: "foo"}}, NodeSelector: nodeSelector},
+				},
+			},
+		})
+	}
+
+	controller.trackNode(worker)
+	if state, _ := controller.nodeWarmups.state("worker1"); state != NodeWarmupPending {
+		t.Fatalf("Test: node warm-up failed: expected state=%s, actual=%s", NodeWarmupPending, state)
+	}
+	if err := controller.warmupNode(context.Background(), "worker1"); err != nil {
+		t.Fatalf("Test: node warm-up failed: err=%v", err)
+	}
+	// Only cache0 and cache2 select the node
+	if state, _ := controller.nodeWarmups.state("worker1"); state != NodeWarmupWarming {
+		t.Errorf("Test: node warm-up failed: expected state=%s, actual=%s", NodeWarmupWarming, state)
+	}
+	controller.completeNodeWarmup(context.Background(), "worker1", warmupSyncID(controller, "worker1", "cache0"),
+		map[string]images.ImageWorkResult{"job1": {Status: images.ImageWorkResultStatusSucceeded}})
+	if state, _ := controller.nodeWarmups.state("worker1"); state != NodeWarmupWarming {
+		t.Errorf("Test: node warm-up failed: expected state=%s, actual=%s", NodeWarmupWarming, state)
+	}
+	controller.completeNodeWarmup(context.Background(), "worker1", warmupSyncID(controller, "worker1", "cache2"),
+		map[string]images.ImageWorkResult{"job2": {Status: images.ImageWorkResultStatusFailed}})
+	if state, _ := controller.nodeWarmups.state("worker1"); state != NodeWarmupFailed {
+		t.Errorf("Test: node warm-up failed: expected state=%s, actual=%s", NodeWarmupFailed, state)
+	}
+	annotated, err := fakekubeclientset.CoreV1().Nodes().Get(context.Background(), "worker1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Test: node warm-up failed: err=%v", err)
+	}
+	if actual := annotated.Annotations[nodeWarmupAnnotationKey]; actual != string(NodeWarmupFailed) {
+		t.Errorf("Test: node warm-up failed: expected annotation=%s, actual=%s", NodeWarmupFailed, actual)
+	}
+	if _, ok := annotated.Labels[imageCacheNodeLabel(fledgedNameSpace, "cache0")]; !ok {
+		t.Errorf("Test: node warm-up failed: node not labelled with warm image cache cache0")
+	}
+	if _, ok := annotated.Labels[imageCacheNodeLabel(fledgedNameSpace, "cache2")]; ok {
+		t.Errorf("Test: node warm-up failed: node labelled with failed image cache cache2")
+	}
+
+	// A node which is already warm is not warmed up again
+	warm := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker2",
+		Annotations: map[string]string{nodeWarmupAnnotationKey: string(NodeWarmupWarm)}}}
+	controller.trackNode(warm)
+	if state, _ := controller.nodeWarmups.state("worker2"); state != NodeWarmupWarm {
+		t.Errorf("Test: node warm-up failed: expected state=%s, actual=%s", NodeWarmupWarm, state)
+	}
+	if err := controller.warmupNode(context.Background(), "worker2"); err != nil {
+		t.Errorf("Test: node warm-up failed: err=%v", err)
+	}
+}
+
+func TestStartupTaint(t *testing.T) {
+	worker := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker1"}}
+	fakekubeclientset := fakeclientset.NewSimpleClientset(worker)
+	fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+	controller, nodeInformer, imagecacheInformer := newTestController(fakekubeclientset, fakefledgedclientset)
+	controller.startupTaint = &corev1.Taint{Key: "kubefledged.io/warming", Effect: corev1.TaintEffectNoSchedule}
+	for i, critical := range []bool{true, false} {
+		imagecacheInformer.Informer().GetIndexer().Add(&kubefledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("cache%d", i), Namespace: fledgedNameSpace},
+			Spec: kubefledgedv1alpha3.ImageCacheSpec{
+				CacheSpec: []kubefledgedv1alpha3.CacheSpecImages{{Images: []kubefledgedv1alpha3.Image{{Name: "foo"}}}},
+				Critical:  critical,
+			},
+		})
+	}
+	// syncNode copies the node from the api server to the informer cache
+	syncNode := func() *corev1.Node {
+		n, err := fakekubeclientset.CoreV1().Nodes().Get(context.Background(), worker.Name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("Test: startup taint failed: err=%v", err)
+		}
+		nodeInformer.Informer().GetIndexer().Update(n)
+		return n
+	}
+
+	controller.trackNode(worker)
+	if !controller.hasStartupTaint(syncNode()) {
+		t.Fatalf("Test: startup taint failed: new node not tainted")
+	}
+	if err := controller.warmupNode(context.Background(), worker.Name); err != nil {
+		t.Fatalf("Test: startup taint failed: err=%v", err)
+	}
+	controller.completeNodeWarmup(context.Background(), worker.Name, warmupSyncID(controller, worker.Name, "cache1"),
+		map[string]images.ImageWorkResult{"job1": {Status: images.ImageWorkResultStatusSucceeded}})
+	if !controller.hasStartupTaint(syncNode()) {
+		t.Errorf("Test: startup taint failed: taint removed before critical image cache is warm")
+	}
+	// All images of the critical image cache were already present on the node
+	controller.completeNodeWarmup(context.Background(), worker.Name, warmupSyncID(controller, worker.Name, "cache0"),
+		map[string]images.ImageWorkResult{})
+	if controller.hasStartupTaint(syncNode()) {
+		t.Errorf("Test: startup taint failed: taint not removed after critical image cache is warm")
+	}
+
+	// The taint is removed on timeout even though the critical image cache failed
+	controller.nodeWarmups.remove(worker.Name)
+	tainted := syncNode().DeepCopy()
+	delete(tainted.Annotations, nodeWarmupAnnotationKey)
+	controller.trackNode(tainted)
+	if !controller.hasStartupTaint(syncNode()) {
+		t.Fatalf("Test: startup taint failed: new node not tainted")
+	}
+	if err := controller.syncHandler(images.WorkQueueKey{WorkType: images.NodeStartupTaintTimeout, ObjKey: worker.Name}); err != nil {
+		t.Fatalf("Test: startup taint failed: err=%v", err)
+	}
+	if controller.hasStartupTaint(syncNode()) {
+		t.Errorf("Test: startup taint failed: taint not removed after timeout")
+	}
+}
+
+func TestNodeWarmupExistingNode(t *testing.T) {
+	// readyNode returns a node which became ready at the given time
+	readyNode := func(name string, since time.Time) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{
+				{Type: corev1.NodeReady, Status: corev1.ConditionTrue, LastTransitionTime: metav1.NewTime(since)},
+			}},
+		}
+	}
+	existing := readyNode("worker1", time.Now().Add(-time.Hour))
+	joined := readyNode("worker2", time.Now().Add(time.Hour))
+	annotated := readyNode("worker3", time.Now().Add(-time.Hour))
+	annotated.Annotations = map[string]string{nodeWarmupAnnotationKey: string(NodeWarmupWarm)}
+	fakekubeclientset := fakeclientset.NewSimpleClientset(existing, joined, annotated)
+	fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+	controller, _, _ := newTestController(fakekubeclientset, fakefledgedclientset)
+	controller.startupTaint = &corev1.Taint{Key: "kubefledged.io/warming", Effect: corev1.TaintEffectNoSchedule}
+
+	tests := []struct {
+		name            string
+		node            *corev1.Node
+		expectState     NodeWarmupState
+		expectTainted   bool
+		expectPatched   bool
+		expectAnnotated NodeWarmupState
+	}{
+		{
+			name:            "#1: Node ready before the controller started is warm",
+			node:            existing,
+			expectState:     NodeWarmupWarm,
+			expectTainted:   false,
+			expectPatched:   true,
+			expectAnnotated: NodeWarmupWarm,
+		},
+		{
+			name:            "#2: Node ready after the controller started is warmed up",
+			node:            joined,
+			expectState:     NodeWarmupPending,
+			expectTainted:   true,
+			expectPatched:   true,
+			expectAnnotated: NodeWarmupPending,
+		},
+		{
+			name:            "#3: Node already annotated as warm is not patched",
+			node:            annotated,
+			expectState:     NodeWarmupWarm,
+			expectTainted:   false,
+			expectPatched:   false,
+			expectAnnotated: NodeWarmupWarm,
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset.ClearActions()
+		// The initial list of the node informer sends an add for every node
+		controller.enqueueNode(test.node, "add")
+		if state, _ := controller.nodeWarmups.state(test.node.Name); state != test.expectState {
+			t.Errorf("Test: %s failed: expected state=%s, actual=%s", test.name, test.expectState, state)
+		}
+		patched := false
+		for _, action := range fakekubeclientset.Actions() {
+			if patch, ok := action.(core.PatchAction); ok && patch.GetName() == test.node.Name &&
+				strings.Contains(string(patch.GetPatch()), nodeWarmupAnnotationKey) {
+				patched = true
+			}
+		}
+		if patched != test.expectPatched {
+			t.Errorf("Test: %s failed: expectPatched=%t, actual=%t", test.name, test.expectPatched, patched)
+		}
+		n, err := fakekubeclientset.CoreV1().Nodes().Get(context.Background(), test.node.Name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("Test: %s failed: err=%v", test.name, err)
+		}
+		if tainted := controller.hasStartupTaint(n); tainted != test.expectTainted {
+			t.Errorf("Test: %s failed: expectTainted=%t, actual=%t", test.name, test.expectTainted, tainted)
+		}
+		if annotation := NodeWarmupState(n.Annotations[nodeWarmupAnnotationKey]); annotation != test.expectAnnotated {
+			t.Errorf("Test: %s failed: expectAnnotated=%s, actual=%s", test.name, test.expectAnnotated, annotation)
+		}
+	}
+}
+
+func TestImageCacheNodeLabel(t *testing.T) {
+	tests := []struct {
+		name          string
+		namespace     string
+		imageCache    string
+		expectedLabel string
+	}{
+		{
+			name:          "#1: Short name",
+			namespace:     "ml",
+			imageCache:    "ml-runtime",
+			expectedLabel: "cache.kubefledged.io/ml.ml-runtime",
+		},
+		{
+			name:          "#2: Name exceeding the label name length is hashed",
+			namespace:     "kube-fledged",
+			imageCache:    strings.Repeat("a", 60),
+			expectedLabel: "cache.kubefledged.io/kube-fledged." + strings.Repeat("a", 39) + "-",
+		},
+	}
+	for _, test := range tests {
+		label := imageCacheNodeLabel(test.namespace, test.imageCache)
+		if !strings.HasPrefix(label, test.expectedLabel) {
+			t.Errorf("Test: %s failed: expectedLabel=%s, actual=%s", test.name, test.expectedLabel, label)
+		}
+		if errs := validation.IsQualifiedName(label); len(errs) > 0 {
+			t.Errorf("Test: %s failed: invalid label %s: %v", test.name, label, errs)
+		}
+	}
+	if imageCacheNodeLabel("ns", strings.Repeat("a", 70)) == imageCacheNodeLabel("ns", strings.Repeat("a", 71)) {
+		t.Errorf("Test: hashed image cache node labels are not unique")
+	}
+}
+
+func TestSyncImageCacheNodeLabels(t *testing.T) {
+	label := imageCacheNodeLabel(fledgedNameSpace, "foo")
+	nodes := []*corev1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "worker1", Labels: map[string]string{"kubernetes.io/hostname": "worker1", "zone": "a"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "worker2", Labels: map[string]string{"kubernetes.io/hostname": "worker2", "zone": "a"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "worker3", Labels: map[string]string{"kubernetes.io/hostname": "worker3", label: "warm"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "worker4", Labels: map[string]string{"kubernetes.io/hostname": "worker4", "zone": "a"}}},
+	}
+	imageCache := &kubefledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace},
+		Spec: kubefledgedv1alpha3.ImageCacheSpec{
+			CacheSpec: []kubefledgedv1alpha3.CacheSpecImages{
+				{Images: []kubefledgedv1alpha3.Image{{Name: "foo"}, {Name: "bar"}}, NodeSelector: map[string]string{"zone": "a"}},
+			},
+		},
+	}
+	// result returns the result of pulling the image to the node
+	result := func(node *corev1.Node, image, status string) images.ImageWorkResult {
+		return images.ImageWorkResult{ImageWorkRequest: images.ImageWorkRequest{Image: image, Node: node}, Status: status}
+	}
+	results := map[string]images.ImageWorkResult{
+		"job1": result(nodes[0], "foo", images.ImageWorkResultStatusSucceeded),
+		"job2": result(nodes[0], "bar", images.ImageWorkResultStatusAlreadyPulled),
+		"job3": result(nodes[1], "foo", images.ImageWorkResultStatusSucceeded),
+		"job4": result(nodes[1], "bar", images.ImageWorkResultStatusFailed),
+	}
+	tests := []struct {
+		name           string
+		status         kubefledgedv1alpha3.ImageCacheStatus
+		results        map[string]images.ImageWorkResult
+		deleted        bool
+		expectedLabels map[string]bool
+	}{
+		{
+			name:           "#1: Nodes whose results all succeeded are labelled",
+			results:        results,
+			expectedLabels: map[string]bool{"worker1": true, "worker2": false, "worker3": false, "worker4": false},
+		},
+		{
+			name:           "#2: Purge unlabels all nodes",
+			status:         kubefledgedv1alpha3.ImageCacheStatus{Reason: kubefledgedv1alpha3.ImageCacheReasonImageCachePurge},
+			results:        results,
+			expectedLabels: map[string]bool{"worker1": false, "worker2": false, "worker3": false, "worker4": false},
+		},
+		{
+			name:           "#3: Deletion unlabels all nodes",
+			deleted:        true,
+			expectedLabels: map[string]bool{"worker1": false, "worker2": false, "worker3": false, "worker4": false},
+		},
+		{
+			name: "#4: Nodes with pending or unknown results are not labelled",
+			results: map[string]images.ImageWorkResult{
+				"job1": result(nodes[0], "foo", images.ImageWorkResultStatusJobCreated),
+				"job2": result(nodes[1], "foo", images.ImageWorkResultStatusUnknown),
+				"job3": result(nodes[3], "foo", images.ImageWorkResultStatusSucceeded),
+			},
+			expectedLabels: map[string]bool{"worker1": false, "worker2": false, "worker3": false, "worker4": true},
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := fakeclientset.NewSimpleClientset()
+		fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+		controller, nodeInformer, _ := newTestController(fakekubeclientset, fakefledgedclientset)
+		for _, node := range nodes {
+			fakekubeclientset.CoreV1().Nodes().Create(context.Background(), node, metav1.CreateOptions{})
+			nodeInformer.Informer().GetIndexer().Add(node)
+		}
+		if test.deleted {
+			controller.removeImageCacheNodeLabels(context.Background(), imageCache.Namespace, imageCache.Name)
+		} else {
+			controller.syncImageCacheNodeLabels(context.Background(), imageCache, &test.status, test.results)
+		}
+		for nodeName, expected := range test.expectedLabels {
+			node, _ := fakekubeclientset.CoreV1().Nodes().Get(context.Background(), nodeName, metav1.GetOptions{})
+			if actual := node.Labels[label] == imageCacheNodeLabelWarm; actual != expected {
+				t.Errorf("Test: %s failed: node=%s, expectedLabel=%t, actual=%t", test.name, nodeName, expected, actual)
+			}
+		}
+	}
+}
+
+func TestImageCachePlan(t *testing.T) {
+	worker1 := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker1", Labels: map[string]string{"kubernetes.io/hostname": "worker1"}}}
+	worker2 := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker2", Labels: map[string]string{"kubernetes.io/hostname": "worker2"}}}
+	imageCache := &kubefledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace},
+		Spec: kubefledgedv1alpha3.ImageCacheSpec{
+			CacheSpec: []kubefledgedv1alpha3.CacheSpecImages{{Images: []kubefledgedv1alpha3.Image{{Name: "foo"}}}},
+		},
+		Status: kubefledgedv1alpha3.ImageCacheStatus{
+			// An earlier planned change removed the image "old" from the spec
+			Plan: &kubefledgedv1alpha3.ImageCachePlan{Images: map[string]kubefledgedv1alpha3.NodePlannedActionList{
+				"old": {{Node: "worker2", Action: kubefledgedv1alpha3.PlannedActionDelete}},
+				"foo": {{Node: "worker1", Action: kubefledgedv1alpha3.PlannedActionPull}},
+			}},
+		},
+	}
+	results := map[string]images.ImageWorkResult{
+		"job1": {Status: images.ImageWorkResultStatusPlanned,
+			ImageWorkRequest: images.ImageWorkRequest{Image: "foo", Node: worker2, WorkType: images.ImageCacheUpdate}},
+		"job2": {Status: images.ImageWorkResultStatusAlreadyPulled,
+			ImageWorkRequest: images.ImageWorkRequest{Image: "foo", Node: worker1, WorkType: images.ImageCacheUpdate}},
+		"job3": {Status: images.ImageWorkResultStatusPlanned,
+			ImageWorkRequest: images.ImageWorkRequest{Image: "bar", Node: worker1, WorkType: images.ImageCachePurge}},
+	}
+	expected := map[string]kubefledgedv1alpha3.NodePlannedActionList{
+		"foo": {
+			{Node: "worker1", Action: kubefledgedv1alpha3.PlannedActionSkip, Reason: kubefledgedv1alpha3.ImageCacheReasonImageAlreadyPresent},
+			{Node: "worker2", Action: kubefledgedv1alpha3.PlannedActionPull},
+		},
+		"bar": {{Node: "worker1", Action: kubefledgedv1alpha3.PlannedActionDelete}},
+		"old": {{Node: "worker2", Action: kubefledgedv1alpha3.PlannedActionDelete}},
+	}
+	plan := newImageCachePlan(imageCache, results)
+	if !reflect.DeepEqual(plan.Images, expected) {
+		t.Errorf("Test: image cache plan failed: expected=%+v, actual=%+v", expected, plan.Images)
+	}
+
+	// Applying the plan deletes the images removed from the spec
+	fakekubeclientset := &fakeclientset.Clientset{}
+	fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+	controller, nodeInformer, _ := newTestController(fakekubeclientset, fakefledgedclientset)
+	nodeInformer.Informer().GetIndexer().Add(worker1)
+	nodeInformer.Informer().GetIndexer().Add(worker2)
+	iwrs := controller.plannedDeletes(imageCache, plan)
+	if len(iwrs) != 2 {
+		t.Fatalf("Test: image cache plan failed: expected 2 planned deletes, actual=%d", len(iwrs))
+	}
+	for _, iwr := range iwrs {
+		if iwr.WorkType != images.ImageCachePurge || iwr.Image == "foo" {
+			t.Errorf("Test: image cache plan failed: unexpected request image=%s, workType=%s", iwr.Image, iwr.WorkType)
+		}
+	}
+}
+
+func TestCancelImageCache(t *testing.T) {
+	worker := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker1", Labels: map[string]string{"kubernetes.io/hostname": "worker1"}}}
+	imageCache := &kubefledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace,
+			Annotations: map[string]string{imageCacheCancelAnnotationKey: ""}},
+		Spec: kubefledgedv1alpha3.ImageCacheSpec{
+			CacheSpec: []kubefledgedv1alpha3.CacheSpecImages{{Images: []kubefledgedv1alpha3.Image{{Name: "foo"}, {Name: "bar"}}}},
+		},
+		Status: kubefledgedv1alpha3.ImageCacheStatus{Status: kubefledgedv1alpha3.ImageCacheActionStatusProcessing},
+	}
+	fakekubeclientset := fakeclientset.NewSimpleClientset()
+	fakefledgedclientset := kubefledgedclientsetfake.NewSimpleClientset(imageCache)
+	controller, _, _ := newTestController(fakekubeclientset, fakefledgedclientset)
+	key := fledgedNameSpace + "/foo"
+	controller.activeSyncs.start(key, "sync1")
+
+	if err := controller.syncHandler(images.WorkQueueKey{WorkType: images.ImageCacheCancel, ObjKey: key}); err != nil {
+		t.Fatalf("Test: cancel image cache failed: err=%v", err)
+	}
+	cancelled, err := fakefledgedclientset.KubefledgedV1alpha3().ImageCaches(fledgedNameSpace).Get(context.Background(), "foo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Test: cancel image cache failed: err=%v", err)
+	}
+	if _, ok := cancelled.Annotations[imageCacheCancelAnnotationKey]; ok {
+		t.Errorf("Test: cancel image cache failed: cancel annotation not removed")
+	}
+
+	// The results of the cancelled sync action abort the image cache
+	results := map[string]images.ImageWorkResult{
+		"job1": {Status: images.ImageWorkResultStatusSucceeded,
+			ImageWorkRequest: images.ImageWorkRequest{Image: "foo", Node: worker, WorkType: images.ImageCacheCreate}},
+		"job2": {Status: images.ImageWorkResultStatusCancelled,
+			Reason:           kubefledgedv1alpha3.ImageCacheReasonImageCacheCancelled,
+			Message:          kubefledgedv1alpha3.ImageCacheMessageJobCancelled,
+			ImageWorkRequest: images.ImageWorkRequest{Image: "bar", Node: worker, WorkType: images.ImageCacheCreate}},
+	}
+	if err := controller.syncHandler(images.WorkQueueKey{WorkType: images.ImageCacheStatusUpdate, ObjKey: key,
+		SyncID: "sync1", Status: &results}); err != nil {
+		t.Fatalf("Test: cancel image cache failed: err=%v", err)
+	}
+	aborted, err := fakefledgedclientset.KubefledgedV1alpha3().ImageCaches(fledgedNameSpace).Get(context.Background(), "foo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Test: cancel image cache failed: err=%v", err)
+	}
+	if aborted.Status.Status != kubefledgedv1alpha3.ImageCacheActionStatusAborted || aborted.Status.Reason != kubefledgedv1alpha3.ImageCacheReasonImageCacheCancelled {
+		t.Errorf("Test: cancel image cache failed: expected status=%s reason=%s, actual status=%s reason=%s",
+			kubefledgedv1alpha3.ImageCacheActionStatusAborted, kubefledgedv1alpha3.ImageCacheReasonImageCacheCancelled,
+			aborted.Status.Status, aborted.Status.Reason)
+	}
+	expected := kubefledgedv1alpha3.NodeReasonMessageList{{Node: "worker1",
+		Reason: kubefledgedv1alpha3.ImageCacheReasonImageCacheCancelled, Message: kubefledgedv1alpha3.ImageCacheMessageJobCancelled}}
+	if !reflect.DeepEqual(aborted.Status.Failures["bar"], expected) || len(aborted.Status.Failures) != 1 {
+		t.Errorf("Test: cancel image cache failed: expected failures=%+v, actual=%+v", expected, aborted.Status.Failures)
+	}
+	if _, ok := controller.activeSyncs.get(key); ok {
+		t.Errorf("Test: cancel image cache failed: sync action still in progress")
+	}
+}
+
+func TestPendingUpdate(t *testing.T) {
+	worker := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker1", Labels: map[string]string{"kubernetes.io/hostname": "worker1"}}}
+	oldImageCache := &kubefledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace, Generation: 1},
+		Spec: kubefledgedv1alpha3.ImageCacheSpec{
+			CacheSpec: []kubefledgedv1alpha3.CacheSpecImages{{Images: []kubefledgedv1alpha3.Image{{Name: "foo"}}}},
+		},
+		Status: kubefledgedv1alpha3.ImageCacheStatus{Status: kubefledgedv1alpha3.ImageCacheActionStatusProcessing},
+	}
+	imageCache := oldImageCache.DeepCopy()
+	imageCache.Generation = 2
+	imageCache.Spec.CacheSpec[0].Images = append(imageCache.Spec.CacheSpec[0].Images, kubefledgedv1alpha3.Image{Name: "bar"})
+	key := fledgedNameSpace + "/foo"
+	results := map[string]images.ImageWorkResult{
+		"job1": {Status: images.ImageWorkResultStatusSucceeded,
+			ImageWorkRequest: images.ImageWorkRequest{Image: "foo", Node: worker, WorkType: images.ImageCacheCreate}},
+	}
+	tests := []struct {
+		name       string
+		processing bool
+	}{
+		{name: "#1: Spec changed while under processing, queued once the sync completes", processing: true},
+		{name: "#2: Sync completed before the change was deferred, queued right away"},
+	}
+	for _, test := range tests {
+		current := imageCache.DeepCopy()
+		if !test.processing {
+			current.Status.Status = kubefledgedv1alpha3.ImageCacheActionStatusSucceeded
+		}
+		fakefledgedclientset := kubefledgedclientsetfake.NewSimpleClientset(current)
+		controller, _, _ := newTestController(fakeclientset.NewSimpleClientset(), fakefledgedclientset)
+		if !controller.enqueueImageCache(images.ImageCacheUpdate, oldImageCache, imageCache) {
+			t.Fatalf("Test: %s failed: update not queued", test.name)
+		}
+		wqKey, _ := controller.workqueue.Get()
+		controller.workqueue.Done(wqKey)
+		if err := controller.syncHandler(wqKey.(images.WorkQueueKey)); err != nil {
+			t.Fatalf("Test: %s failed: err=%v", test.name, err)
+		}
+		if test.processing {
+			if controller.workqueue.Len() != 0 {
+				t.Errorf("Test: %s failed: update queued while under processing", test.name)
+			}
+			if err := controller.syncHandler(images.WorkQueueKey{WorkType: images.ImageCacheStatusUpdate, ObjKey: key,
+				Status: &results}); err != nil {
+				t.Fatalf("Test: %s failed: err=%v", test.name, err)
+			}
+			updated, err := fakefledgedclientset.KubefledgedV1alpha3().ImageCaches(fledgedNameSpace).Get(context.Background(), "foo", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("Test: %s failed: err=%v", test.name, err)
+			}
+			if updated.Status.PendingGeneration != 2 || updated.Status.Status != kubefledgedv1alpha3.ImageCacheActionStatusSucceeded {
+				t.Errorf("Test: %s failed: expected pendingGeneration=2 status=%s, actual pendingGeneration=%d status=%s", test.name,
+					kubefledgedv1alpha3.ImageCacheActionStatusSucceeded, updated.Status.PendingGeneration, updated.Status.Status)
+			}
+		}
+		// The update is rate limited, so it becomes ready a little later
+		for i := 0; i < 100 && controller.workqueue.Len() == 0; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if controller.workqueue.Len() != 1 {
+			t.Fatalf("Test: %s failed: expected 1 queued update, actual=%d", test.name, controller.workqueue.Len())
+		}
+		queued, _ := controller.workqueue.Get()
+		if k := queued.(images.WorkQueueKey); k.WorkType != images.ImageCacheUpdate || k.OldImageCache != oldImageCache {
+			t.Errorf("Test: %s failed: expected update against the spec under processing, actual workType=%s", test.name, k.WorkType)
+		}
+	}
+}
+
+func TestRecordNodeEvents(t *testing.T) {
+	worker := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker1"}}
+	imageCache := &kubefledgedv1alpha3.ImageCache{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace}}
+	results := map[string]images.ImageWorkResult{
+		"job1": {Status: images.ImageWorkResultStatusSucceeded,
+			ImageWorkRequest: images.ImageWorkRequest{Image: "foo", Node: worker, WorkType: images.ImageCacheCreate, Imagecache: imageCache}},
+		"job2": {Status: images.ImageWorkResultStatusFailed, Reason: "ErrImagePull", Message: "not found",
+			ImageWorkRequest: images.ImageWorkRequest{Image: "bar", Node: worker, WorkType: images.ImageCacheCreate, Imagecache: imageCache}},
+		"job3": {Status: images.ImageWorkResultStatusAlreadyPulled,
+			ImageWorkRequest: images.ImageWorkRequest{Image: "baz", Node: worker, WorkType: images.ImageCacheCreate, Imagecache: imageCache}},
+	}
+	pulled := "Normal ImagePulled Pulled image foo of image cache kube-fledged/foo"
+	failed := "Warning ImagePullFailed Failed to pull image bar of image cache kube-fledged/foo: ErrImagePull: not found"
+	tests := []struct {
+		name       string
+		nodeEvents string
+		expected   []string
+	}{
+		{name: "#1: All events", nodeEvents: config.NodeEventsAll, expected: []string{pulled, failed}},
+		{name: "#2: Failures only", nodeEvents: config.NodeEventsFailures, expected: []string{failed}},
+		{name: "#3: No events", nodeEvents: config.NodeEventsNone},
+	}
+	for _, test := range tests {
+		controller, _, _ := newTestController(&fakeclientset.Clientset{}, &kubefledgedclientsetfake.Clientset{})
+		recorder := record.NewFakeRecorder(10)
+		controller.recorder = recorder
+		controller.cfg.NodeEvents = test.nodeEvents
+		controller.recordNodeEvents(results)
+		close(recorder.Events)
+		var actual []string
+		for event := range recorder.Events {
+			actual = append(actual, event)
+		}
+		sort.Strings(actual)
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Test: %s failed: expected=%q, actual=%q", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestRecordImageCacheRun(t *testing.T) {
+	worker1 := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker1", Labels: map[string]string{"kubernetes.io/hostname": "worker1"}}}
+	worker2 := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker2", Labels: map[string]string{"kubernetes.io/hostname": "worker2"}}}
+	imageCache := &kubefledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace, UID: "uid-foo"},
+		Status:     kubefledgedv1alpha3.ImageCacheStatus{Reason: kubefledgedv1alpha3.ImageCacheReasonImageCacheRefresh},
+	}
+	other := &kubefledgedv1alpha3.ImageCache{ObjectMeta: metav1.ObjectMeta{Name: "bar", Namespace: fledgedNameSpace, UID: "uid-bar"}}
+	run := func(owner *kubefledgedv1alpha3.ImageCache, name string, age time.Duration) *kubefledgedv1alpha3.ImageCacheRun {
+		completionTime := metav1.NewTime(time.Now().Add(-age))
+		return &kubefledgedv1alpha3.ImageCacheRun{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: fledgedNameSpace, Labels: map[string]string{"imagecache": owner.Name},
+				OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(owner, kubefledgedv1alpha3.SchemeGroupVersion.WithKind("ImageCache"))}},
+			Status: kubefledgedv1alpha3.ImageCacheRunStatus{CompletionTime: &completionTime},
+		}
+	}
+	fakefledgedclientset := kubefledgedclientsetfake.NewSimpleClientset(
+		run(imageCache, "foo-old", 2*time.Hour), run(imageCache, "foo-recent", time.Hour), run(other, "bar-old", 3*time.Hour))
+	controller, _, _ := newTestController(fakeclientset.NewSimpleClientset(), fakefledgedclientset)
+	controller.cfg.ImageCacheRunHistoryLimit = 2
+
+	results := map[string]images.ImageWorkResult{
+		"job1": {Status: images.ImageWorkResultStatusFailed, Reason: "ErrImagePull",
+			ImageWorkRequest: images.ImageWorkRequest{Image: "foo", Node: worker2, WorkType: images.ImageCacheRefresh}},
+		"job2": {Status: images.ImageWorkResultStatusAlreadyPulled,
+			ImageWorkRequest: images.ImageWorkRequest{Image: "foo", Node: worker1, WorkType: images.ImageCacheRefresh}},
+	}
+	status := &kubefledgedv1alpha3.ImageCacheStatus{Status: kubefledgedv1alpha3.ImageCacheActionStatusFailed}
+	controller.recordImageCacheRun(context.Background(), imageCache, "0123456789abcdef", status, results)
+	// The runs are listed by the label of their image cache
+	for _, action := range fakefledgedclientset.Actions() {
+		if list, ok := action.(core.ListAction); ok {
+			if selector := list.GetListRestrictions().Labels.String(); selector != "imagecache=foo" {
+				t.Errorf("Test: record image cache run failed: unexpected label selector %q", selector)
+			}
+		}
+	}
+
+	runs, err := fakefledgedclientset.KubefledgedV1alpha3().ImageCacheRuns(fledgedNameSpace).List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("Test: record image cache run failed: err=%v", err)
+	}
+	var names []string
+	for _, r := range runs.Items {
+		names = append(names, r.Name)
+	}
+	sort.Strings(names)
+	if expected := []string{"bar-old", "foo-01234567", "foo-recent"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("Test: record image cache run failed: expected runs=%v, actual=%v", expected, names)
+	}
+	recorded, err := fakefledgedclientset.KubefledgedV1alpha3().ImageCacheRuns(fledgedNameSpace).Get(context.Background(), "foo-01234567", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Test: record image cache run failed: err=%v", err)
+	}
+	if recorded.Status.Trigger != kubefledgedv1alpha3.ImageCacheRunTriggerRefresh || recorded.Status.Status != kubefledgedv1alpha3.ImageCacheActionStatusFailed {
+		t.Errorf("Test: record image cache run failed: unexpected trigger=%s, status=%s", recorded.Status.Trigger, recorded.Status.Status)
+	}
+	if recorded.Labels["imagecache"] != imageCache.Name {
+		t.Errorf("Test: record image cache run failed: expected imagecache label=%s, actual labels=%v", imageCache.Name, recorded.Labels)
+	}
+	expected := kubefledgedv1alpha3.NodeResultList{
+		{Node: "worker1", Result: kubefledgedv1alpha3.NodeResultAlreadyPresent},
+		{Node: "worker2", Result: kubefledgedv1alpha3.NodeResultFailed, Reason: "ErrImagePull"},
+	}
+	if !reflect.DeepEqual(recorded.Status.Results["foo"], expected) {
+		t.Errorf("Test: record image cache run failed: expected results=%+v, actual=%+v", expected, recorded.Status.Results["foo"])
+	}
+}
+
+func TestRecordImageCacheRunLongName(t *testing.T) {
+	imageCache := &kubefledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{Name: strings.Repeat("a", 100), Namespace: fledgedNameSpace, UID: "uid-long"},
+	}
+	completionTime := metav1.NewTime(time.Now().Add(-time.Hour))
+	old := &kubefledgedv1alpha3.ImageCacheRun{
+		ObjectMeta: metav1.ObjectMeta{Name: "old", Namespace: fledgedNameSpace, Labels: imageCacheRunLabels(imageCache),
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(imageCache, kubefledgedv1alpha3.SchemeGroupVersion.WithKind("ImageCache"))}},
+		Status: kubefledgedv1alpha3.ImageCacheRunStatus{CompletionTime: &completionTime},
+	}
+	fakefledgedclientset := kubefledgedclientsetfake.NewSimpleClientset(old)
+	controller, _, _ := newTestController(fakeclientset.NewSimpleClientset(), fakefledgedclientset)
+	controller.cfg.ImageCacheRunHistoryLimit = 1
+
+	status := &kubefledgedv1alpha3.ImageCacheStatus{Status: kubefledgedv1alpha3.ImageCacheActionStatusSucceeded}
+	controller.recordImageCacheRun(context.Background(), imageCache, "0123456789abcdef", status, nil)
+
+	runs, err := fakefledgedclientset.KubefledgedV1alpha3().ImageCacheRuns(fledgedNameSpace).List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("Test: record image cache run with long name failed: err=%v", err)
+	}
+	// The old run is listed by the shortened label and pruned
+	if len(runs.Items) != 1 || runs.Items[0].Name != imageCache.Name+"-01234567" {
+		t.Fatalf("Test: record image cache run with long name failed: unexpected runs %+v", runs.Items)
+	}
+	value := runs.Items[0].Labels["imagecache"]
+	if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+		t.Errorf("Test: record image cache run with long name failed: invalid label value %s: %v", value, errs)
+	}
+	if !strings.HasPrefix(value, strings.Repeat("a", 52)+"-") {
+		t.Errorf("Test: record image cache run with long name failed: unexpected label value %s", value)
+	}
+}
+
+func TestSyncCounts(t *testing.T) {
+	worker1 := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker1"}}
+	worker2 := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker2"}}
+	result := func(node *corev1.Node, image, status string) images.ImageWorkResult {
+		return images.ImageWorkResult{Status: status, ImageWorkRequest: images.ImageWorkRequest{Image: image, Node: node}}
+	}
+	requests := []images.ImageWorkRequest{
+		{Image: "foo", Node: worker1}, {Image: "bar", Node: worker1},
+		{Image: "foo", Node: worker2}, {Image: "bar", Node: worker2},
+	}
+	tests := []struct {
+		name     string
+		results  map[string]images.ImageWorkResult
+		final    bool
+		expected kubefledgedv1alpha3.ImageCacheStatus
+	}{
+		{
+			name: "#1: In progress, requests without result pending",
+			results: map[string]images.ImageWorkResult{
+				"job1": result(worker1, "foo", images.ImageWorkResultStatusSucceeded),
+				"job2": result(worker1, "bar", images.ImageWorkResultStatusAlreadyPulled),
+				"job3": result(worker2, "foo", images.ImageWorkResultStatusRetryScheduled),
+			},
+			expected: kubefledgedv1alpha3.ImageCacheStatus{NodesTargeted: 2, NodesReady: 1, ImagesTotal: 2,
+				PullsSucceeded: 2, PullsPending: 2},
+		},
+		{
+			name: "#2: Final results",
+			results: map[string]images.ImageWorkResult{
+				"job1": result(worker1, "foo", images.ImageWorkResultStatusSucceeded),
+				"job2": result(worker1, "bar", images.ImageWorkResultStatusAlreadyPulled),
+				"job3": result(worker2, "foo", images.ImageWorkResultStatusFailed),
+				"job4": result(worker2, "bar", images.ImageWorkResultStatusCancelled),
+			},
+			final: true,
+			expected: kubefledgedv1alpha3.ImageCacheStatus{NodesTargeted: 2, NodesReady: 1, ImagesTotal: 2,
+				PullsSucceeded: 2, PullsFailed: 2},
+		},
+	}
+	for _, test := range tests {
+		status := &kubefledgedv1alpha3.ImageCacheStatus{}
+		setRequestCounts(status, requests)
+		if status.NodesTargeted != 2 || status.ImagesTotal != 2 || status.PullsPending != 4 {
+			t.Errorf("Test: %s failed: unexpected counts at start %+v", test.name, *status)
+		}
+		setResultCounts(status, test.results, test.final)
+		if !reflect.DeepEqual(*status, test.expected) {
+			t.Errorf("Test: %s failed: expected=%+v, actual=%+v", test.name, test.expected, *status)
+		}
+	}
+}
+
+func TestImagePresentInNode(t *testing.T) {
+	node := &corev1.Node{Status: corev1.NodeStatus{Images: []corev1.ContainerImage{
+		{Names: []string{"docker.io/library/nginx@sha256:abc", "docker.io/library/nginx:1.21"}},
+		{Names: []string{"docker.io/library/busybox:latest"}},
+		{Names: []string{"quay.io/org/app:v1"}},
+		{Names: []string{"docker.io/org/tool:v2"}},
+	}}}
+	tests := []struct {
+		name     string
+		image    string
+		expected bool
+	}{
+		{name: "#1: Short name with tag", image: "nginx:1.21", expected: true},
+		{name: "#2: Short name with other tag", image: "nginx:1.22", expected: false},
+		{name: "#3: Short name without tag", image: "busybox", expected: true},
+		{name: "#4: Digest", image: "nginx@sha256:abc", expected: true},
+		{name: "#5: Registry with domain", image: "quay.io/org/app:v1", expected: true},
+		{name: "#6: Docker hub organization", image: "org/tool:v2", expected: true},
+		{name: "#7: Missing image", image: "redis:7", expected: false},
+	}
+	for _, test := range tests {
+		if actual := imagePresentInNode(test.image, node); actual != test.expected {
+			t.Errorf("Test: %s failed: expected=%t, actual=%t", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestCheckNodeDrift(t *testing.T) {
+	worker := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker1", Labels: map[string]string{"kubernetes.io/hostname": "worker1"}},
+		Status: corev1.NodeStatus{Images: []corev1.ContainerImage{
+			{Names: []string{"docker.io/library/nginx:1.21"}},
+		}},
+	}
+	cacheSpec := []kubefledgedv1alpha3.CacheSpecImages{
+		{Images: []kubefledgedv1alpha3.Image{{Name: "nginx:1.21"}, {Name: "redis:7"}}},
+	}
+	tests := []struct {
+		name          string
+		warmupState   NodeWarmupState
+		nodeImages    int
+		status        kubefledgedv1alpha3.ImageCacheStatus
+		expectedState NodeWarmupState
+	}{
+		{
+			name:          "#1: Missing image pulled again",
+			warmupState:   NodeWarmupWarm,
+			status:        kubefledgedv1alpha3.ImageCacheStatus{Status: kubefledgedv1alpha3.ImageCacheActionStatusSucceeded},
+			expectedState: NodeWarmupWarming,
+		},
+		{
+			name:          "#2: Node still warming up",
+			warmupState:   NodeWarmupPending,
+			status:        kubefledgedv1alpha3.ImageCacheStatus{Status: kubefledgedv1alpha3.ImageCacheActionStatusSucceeded},
+			expectedState: NodeWarmupPending,
+		},
+		{
+			name:          "#3: Node status may be truncated",
+			warmupState:   NodeWarmupWarm,
+			nodeImages:    nodeStatusMaxImages,
+			status:        kubefledgedv1alpha3.ImageCacheStatus{Status: kubefledgedv1alpha3.ImageCacheActionStatusSucceeded},
+			expectedState: NodeWarmupWarm,
+		},
+		{
+			name:        "#4: Images purged",
+			warmupState: NodeWarmupWarm,
+			status: kubefledgedv1alpha3.ImageCacheStatus{Status: kubefledgedv1alpha3.ImageCacheActionStatusSucceeded,
+				Reason: kubefledgedv1alpha3.ImageCacheReasonImageCachePurge},
+			expectedState: NodeWarmupWarm,
+		},
+		{
+			name:        "#5: Image failed to pull in last sync",
+			warmupState: NodeWarmupFailed,
+			status: kubefledgedv1alpha3.ImageCacheStatus{Status: kubefledgedv1alpha3.ImageCacheActionStatusFailed,
+				Failures: map[string]kubefledgedv1alpha3.NodeReasonMessageList{"redis:7": {{Node: "worker1"}}}},
+			expectedState: NodeWarmupFailed,
+		},
+	}
 	for _, test := range tests {
-		if test.workqueueItems > 0 {
-			//TODO: How to check if workqueue contains the added item?
-			continue
+		node := worker.DeepCopy()
+		for i := 0; i < test.nodeImages; i++ {
+			node.Status.Images = append(node.Status.Images, corev1.ContainerImage{Names: []string{fmt.Sprintf("image%d:v1", i)}})
 		}
-		fakekubeclientset := &fakeclientset.Clientset{}
+		fakekubeclientset := fakeclientset.NewSimpleClientset(node)
 		fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+		controller, nodeInformer, imagecacheInformer := newTestController(fakekubeclientset, fakefledgedclientset)
+		nodeInformer.Informer().GetIndexer().Add(node)
+		imagecacheInformer.Informer().GetIndexer().Add(&kubefledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace},
+			Spec:       kubefledgedv1alpha3.ImageCacheSpec{CacheSpec: cacheSpec},
+			Status:     test.status,
+		})
+		controller.nodeWarmups.add(node.Name, test.warmupState)
 
-		controller, _, imagecacheInformer := newTestController(fakekubeclientset, fakefledgedclientset)
-		if test.imageCacheList != nil && len(test.imageCacheList.Items) > 0 {
-			for _, imagecache := range test.imageCacheList.Items {
-				imagecacheInformer.Informer().GetIndexer().Add(&imagecache)
-			}
+		if err := controller.checkNodeDrift(context.Background(), node.Name); err != nil {
+			t.Errorf("Test: %s failed: err=%v", test.name, err)
+			continue
 		}
-		controller.runRefreshWorker()
-		if test.workqueueItems == controller.workqueue.Len() {
-		} else {
-			t.Errorf("Test: %s failed: expected %d, actual %d", test.name, test.workqueueItems, controller.workqueue.Len())
+		if state, _ := controller.nodeWarmups.state(node.Name); state != test.expectedState {
+			t.Errorf("Test: %s failed: expectedState=%s, actualState=%s", test.name, test.expectedState, state)
 		}
 	}
 }
@@ -444,6 +1485,12 @@ func TestSyncHandler(t *testing.T) {
 		reaction string
 	}
 	now := metav1.Now()
+	// A window opening in six hours is closed now
+	opens := time.Now().UTC().Add(6 * time.Hour)
+	closedWindows := []kubefledgedv1alpha3.MaintenanceWindow{{
+		Schedule: fmt.Sprintf("CRON_TZ=UTC %d %d * * *", opens.Minute(), opens.Hour()),
+		Duration: metav1.Duration{Duration: time.Minute},
+	}}
 	defaultImageCache := kubefledgedv1alpha3.ImageCache{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      "foo",
@@ -481,6 +1528,8 @@ func TestSyncHandler(t *testing.T) {
 		expectedActions   []ActionReaction
 		expectErr         bool
 		expectedErrString string
+		expectDeferred    bool
+		expectDropped     bool
 	}{
 		{
 			name: "#1: Invalid imagecache resource key",
@@ -892,6 +1941,255 @@ func TestSyncHandler(t *testing.T) {
 			expectErr:         false,
 			expectedErrString: "",
 		},
+		{
+			name: "#16: RetryStatusUpdate - Retry scheduled while processing",
+			imageCache: kubefledgedv1alpha3.ImageCache{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "kube-fledged",
+				},
+				Spec: kubefledgedv1alpha3.ImageCacheSpec{
+					CacheSpec:   defaultImageCache.Spec.CacheSpec,
+					RetryPolicy: &kubefledgedv1alpha3.RetryPolicy{MaxAttempts: 3},
+				},
+				Status: kubefledgedv1alpha3.ImageCacheStatus{
+					StartTime: &now,
+					Status:    kubefledgedv1alpha3.ImageCacheActionStatusProcessing,
+					Reason:    kubefledgedv1alpha3.ImageCacheReasonImageCacheCreate,
+				},
+			},
+			wqKey: images.WorkQueueKey{
+				ObjKey:   "kube-fledged/foo",
+				WorkType: images.ImageCacheRetryStatusUpdate,
+				Status: &map[string]images.ImageWorkResult{
+					"job1": {
+						Status:        images.ImageWorkResultStatusRetryScheduled,
+						NextRetryTime: &now,
+						ImageWorkRequest: images.ImageWorkRequest{
+							Image:    "foo",
+							WorkType: images.ImageCacheCreate,
+							Node:     &node,
+						},
+					},
+				},
+			},
+			expectedActions: []ActionReaction{
+				{action: "get", reaction: ""},
+				{action: "update", reaction: ""},
+			},
+			expectErr:         false,
+			expectedErrString: "",
+		},
+		{
+			name: "#17: RetryStatusUpdate - Sync action already completed",
+			imageCache: kubefledgedv1alpha3.ImageCache{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "kube-fledged",
+				},
+				Spec: defaultImageCache.Spec,
+				Status: kubefledgedv1alpha3.ImageCacheStatus{
+					StartTime: &now,
+					Status:    kubefledgedv1alpha3.ImageCacheActionStatusFailed,
+				},
+			},
+			wqKey: images.WorkQueueKey{
+				ObjKey:   "kube-fledged/foo",
+				WorkType: images.ImageCacheRetryStatusUpdate,
+				Status: &map[string]images.ImageWorkResult{
+					"job1": {
+						Status:        images.ImageWorkResultStatusRetryScheduled,
+						NextRetryTime: &now,
+						ImageWorkRequest: images.ImageWorkRequest{
+							Image:    "foo",
+							WorkType: images.ImageCacheCreate,
+							Node:     &node,
+						},
+					},
+				},
+			},
+			expectedActions: []ActionReaction{
+				{action: "get", reaction: ""},
+			},
+			expectErr:         false,
+			expectedErrString: "",
+		},
+		{
+			name: "#18: ProgressStatusUpdate - Requests queued while processing",
+			imageCache: kubefledgedv1alpha3.ImageCache{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "kube-fledged",
+				},
+				Spec: defaultImageCache.Spec,
+				Status: kubefledgedv1alpha3.ImageCacheStatus{
+					StartTime: &now,
+					Status:    kubefledgedv1alpha3.ImageCacheActionStatusProcessing,
+					Reason:    kubefledgedv1alpha3.ImageCacheReasonImageCacheCreate,
+				},
+			},
+			wqKey: images.WorkQueueKey{
+				ObjKey:   "kube-fledged/foo",
+				WorkType: images.ImageCacheProgressStatusUpdate,
+				Status: &map[string]images.ImageWorkResult{
+					"fakejob-1": {
+						Status: images.ImageWorkResultStatusQueued,
+						ImageWorkRequest: images.ImageWorkRequest{
+							Image:    "foo",
+							WorkType: images.ImageCacheCreate,
+							Node:     &node,
+						},
+					},
+				},
+			},
+			expectedActions: []ActionReaction{
+				{action: "get", reaction: ""},
+				{action: "update", reaction: ""},
+			},
+			expectErr:         false,
+			expectedErrString: "",
+		},
+		{
+			name: "#19: Create - Deferred until maintenance window opens",
+			imageCache: kubefledgedv1alpha3.ImageCache{
+				ObjectMeta: defaultImageCache.ObjectMeta,
+				Spec: kubefledgedv1alpha3.ImageCacheSpec{
+					CacheSpec:          defaultImageCache.Spec.CacheSpec,
+					MaintenanceWindows: closedWindows,
+				},
+			},
+			wqKey: images.WorkQueueKey{
+				ObjKey:   "kube-fledged/foo",
+				WorkType: images.ImageCacheCreate,
+			},
+			nodeList:          defaultNodeList,
+			expectedActions:   []ActionReaction{},
+			expectErr:         false,
+			expectedErrString: "",
+			expectDeferred:    true,
+		},
+		{
+			name: "#20: Create - Bypassing closed maintenance window",
+			imageCache: kubefledgedv1alpha3.ImageCache{
+				ObjectMeta: defaultImageCache.ObjectMeta,
+				Spec: kubefledgedv1alpha3.ImageCacheSpec{
+					CacheSpec:                defaultImageCache.Spec.CacheSpec,
+					MaintenanceWindows:       closedWindows,
+					BypassMaintenanceWindows: true,
+				},
+			},
+			wqKey: images.WorkQueueKey{
+				ObjKey:   "kube-fledged/foo",
+				WorkType: images.ImageCacheCreate,
+			},
+			nodeList: defaultNodeList,
+			expectedActions: []ActionReaction{
+				{action: "get", reaction: ""},
+				{action: "update", reaction: ""},
+			},
+			expectErr:         false,
+			expectedErrString: "",
+		},
+		{
+			name: "#21: Refresh - Deferred, image cache purged in the meantime",
+			imageCache: kubefledgedv1alpha3.ImageCache{
+				ObjectMeta: defaultImageCache.ObjectMeta,
+				Spec:       defaultImageCache.Spec,
+				Status: kubefledgedv1alpha3.ImageCacheStatus{
+					Status: kubefledgedv1alpha3.ImageCacheActionStatusSucceeded,
+					Reason: kubefledgedv1alpha3.ImageCacheReasonImageCachePurge,
+				},
+			},
+			wqKey: images.WorkQueueKey{
+				ObjKey:   "kube-fledged/foo",
+				WorkType: images.ImageCacheRefresh,
+				Deferred: true,
+			},
+			nodeList:        defaultNodeList,
+			expectedActions: []ActionReaction{},
+			expectDropped:   true,
+		},
+		{
+			name: "#22: Refresh - Deferred, image cache under processing",
+			imageCache: kubefledgedv1alpha3.ImageCache{
+				ObjectMeta: defaultImageCache.ObjectMeta,
+				Spec:       defaultImageCache.Spec,
+				Status: kubefledgedv1alpha3.ImageCacheStatus{
+					Status: kubefledgedv1alpha3.ImageCacheActionStatusProcessing,
+				},
+			},
+			wqKey: images.WorkQueueKey{
+				ObjKey:   "kube-fledged/foo",
+				WorkType: images.ImageCacheRefresh,
+				Deferred: true,
+			},
+			nodeList:        defaultNodeList,
+			expectedActions: []ActionReaction{},
+			expectDropped:   true,
+		},
+		{
+			name: "#23: Refresh - Deferred, changes of image cache planned in the meantime",
+			imageCache: kubefledgedv1alpha3.ImageCache{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "foo",
+					Namespace:   "kube-fledged",
+					Annotations: map[string]string{imageCachePlanAnnotationKey: ""},
+				},
+				Spec: defaultImageCache.Spec,
+				Status: kubefledgedv1alpha3.ImageCacheStatus{
+					Status: kubefledgedv1alpha3.ImageCacheActionStatusSucceeded,
+				},
+			},
+			wqKey: images.WorkQueueKey{
+				ObjKey:   "kube-fledged/foo",
+				WorkType: images.ImageCacheRefresh,
+				Deferred: true,
+			},
+			nodeList:        defaultNodeList,
+			expectedActions: []ActionReaction{},
+			expectDropped:   true,
+		},
+		{
+			name: "#24: Create - Deferred, image cache synced in the meantime",
+			imageCache: kubefledgedv1alpha3.ImageCache{
+				ObjectMeta: defaultImageCache.ObjectMeta,
+				Spec:       defaultImageCache.Spec,
+				Status: kubefledgedv1alpha3.ImageCacheStatus{
+					Status: kubefledgedv1alpha3.ImageCacheActionStatusSucceeded,
+				},
+			},
+			wqKey: images.WorkQueueKey{
+				ObjKey:   "kube-fledged/foo",
+				WorkType: images.ImageCacheCreate,
+				Deferred: true,
+			},
+			nodeList:        defaultNodeList,
+			expectedActions: []ActionReaction{},
+			expectDropped:   true,
+		},
+		{
+			name: "#25: Update - Deferred, image cache under processing",
+			imageCache: kubefledgedv1alpha3.ImageCache{
+				ObjectMeta: defaultImageCache.ObjectMeta,
+				Spec:       defaultImageCache.Spec,
+				Status: kubefledgedv1alpha3.ImageCacheStatus{
+					Status: kubefledgedv1alpha3.ImageCacheActionStatusProcessing,
+				},
+			},
+			wqKey: images.WorkQueueKey{
+				ObjKey:        "kube-fledged/foo",
+				WorkType:      images.ImageCacheUpdate,
+				OldImageCache: &defaultImageCache,
+				Deferred:      true,
+			},
+			nodeList: defaultNodeList,
+			expectedActions: []ActionReaction{
+				{action: "get", reaction: ""},
+				{action: "update", reaction: ""},
+			},
+			expectErr:         false,
+			expectedErrString: "",
+		},
 	}
 
 	for _, test := range tests {
@@ -927,6 +2225,16 @@ func TestSyncHandler(t *testing.T) {
 		} else if err != nil {
 			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
 		}
+		if actions := fakefledgedclientset.Actions(); test.expectDeferred && len(actions) != 0 {
+			t.Errorf("Test: %s failed: expected sync to be deferred, actual api calls %v", test.name, actions)
+		}
+		if actions := fakefledgedclientset.Actions(); test.expectDropped && len(actions) != 0 {
+			t.Errorf("Test: %s failed: expected sync to be dropped, actual api calls %v", test.name, actions)
+		}
+		if _, pending := controller.pendingUpdates.take(test.wqKey.ObjKey); test.wqKey.Deferred &&
+			test.wqKey.WorkType == images.ImageCacheUpdate && !pending {
+			t.Errorf("Test: %s failed: expected update to be pending", test.name)
+		}
 	}
 	t.Logf("%d tests passed", len(tests))
 }
@@ -1027,7 +2335,7 @@ func TestEnqueueImageCache(t *testing.T) {
 			expectedResult: false,
 		},
 		{
-			name:     "#5: Update - Status processing. Unsuccessful queueing",
+			name:     "#5: Update - Status processing. Queued as pending update",
 			workType: images.ImageCacheUpdate,
 			oldImageCache: kubefledgedv1alpha3.ImageCache{
 				ObjectMeta: metav1.ObjectMeta{
@@ -1050,7 +2358,7 @@ func TestEnqueueImageCache(t *testing.T) {
 					Status: kubefledgedv1alpha3.ImageCacheActionStatusProcessing,
 				},
 			},
-			expectedResult: false,
+			expectedResult: true,
 		},
 		{
 			name:          "#6: Update - Successful queueing",
@@ -1081,9 +2389,10 @@ func TestEnqueueImageCache(t *testing.T) {
 			expectedResult: true,
 		},
 		{
-			name:           "#7: Delete - Unsuccessful queueing",
+			name:           "#7: Delete - Successful queueing to remove node labels",
 			workType:       images.ImageCacheDelete,
-			expectedResult: false,
+			oldImageCache:  defaultImageCache,
+			expectedResult: true,
 		},
 		{
 			name:           "#8: Refresh - Successful queueing",
@@ -1152,6 +2461,66 @@ func TestEnqueueImageCache(t *testing.T) {
 			},
 			expectedResult: true,
 		},
+		{
+			name:     "#11: Update - Plan annotation removed. Successful queueing",
+			workType: images.ImageCacheUpdate,
+			oldImageCache: kubefledgedv1alpha3.ImageCache{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "foo",
+					Namespace:   "kube-fledged",
+					Annotations: map[string]string{imageCachePlanAnnotationKey: ""},
+				},
+				Spec: defaultImageCache.Spec,
+			},
+			newImageCache: kubefledgedv1alpha3.ImageCache{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "kube-fledged",
+				},
+				Spec: defaultImageCache.Spec,
+				Status: kubefledgedv1alpha3.ImageCacheStatus{
+					Plan: &kubefledgedv1alpha3.ImageCachePlan{},
+				},
+			},
+			expectedResult: true,
+		},
+		{
+			name:     "#12: Update - Plan annotation removed, nothing planned. Unsuccessful queueing",
+			workType: images.ImageCacheUpdate,
+			oldImageCache: kubefledgedv1alpha3.ImageCache{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "foo",
+					Namespace:   "kube-fledged",
+					Annotations: map[string]string{imageCachePlanAnnotationKey: ""},
+				},
+				Spec: defaultImageCache.Spec,
+			},
+			newImageCache:  defaultImageCache,
+			expectedResult: false,
+		},
+		{
+			name:     "#13: Update - Cancel annotation while under processing. Successful queueing",
+			workType: images.ImageCacheUpdate,
+			oldImageCache: kubefledgedv1alpha3.ImageCache{
+				ObjectMeta: defaultImageCache.ObjectMeta,
+				Spec:       defaultImageCache.Spec,
+				Status: kubefledgedv1alpha3.ImageCacheStatus{
+					Status: kubefledgedv1alpha3.ImageCacheActionStatusProcessing,
+				},
+			},
+			newImageCache: kubefledgedv1alpha3.ImageCache{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "foo",
+					Namespace:   "kube-fledged",
+					Annotations: map[string]string{imageCacheCancelAnnotationKey: ""},
+				},
+				Spec: defaultImageCache.Spec,
+				Status: kubefledgedv1alpha3.ImageCacheStatus{
+					Status: kubefledgedv1alpha3.ImageCacheActionStatusProcessing,
+				},
+			},
+			expectedResult: true,
+		},
 	}
 
 	for _, test := range tests {
@@ -0,0 +1,137 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	"github.com/senthilrch/kube-fledged/pkg/images"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+)
+
+// nodeStatusMaxImages is the default number of images reported by kubelet in
+// the node status (--node-status-max-images). A node reporting this many images
+// may hold more, so missing images cannot be told apart from truncation.
+const nodeStatusMaxImages = 50
+
+// handleNodeImagesChange queues a drift check when the images reported by a node change
+func (c *Controller) handleNodeImagesChange(old, new interface{}) {
+	oldNode, ok := old.(*corev1.Node)
+	if !ok {
+		return
+	}
+	newNode, ok := new.(*corev1.Node)
+	if !ok {
+		return
+	}
+	if reflect.DeepEqual(oldNode.Status.Images, newNode.Status.Images) {
+		return
+	}
+	// Image garbage collection removes several images in a row, the delay
+	// folds the resulting node updates into one check
+	c.workqueue.AddAfter(images.WorkQueueKey{WorkType: images.NodeDriftCheck, ObjKey: newNode.Name}, defaultNodeLatency)
+}
+
+// checkNodeDrift compares the images reported by the node with the images it
+// is supposed to hold, and pulls the missing ones to this node again
+func (c *Controller) checkNodeDrift(ctx context.Context, nodeName string) error {
+	// Drift is only detected on nodes which are done warming up
+	if state, ok := c.nodeWarmups.state(nodeName); !ok || (state != NodeWarmupWarm && state != NodeWarmupFailed) {
+		return nil
+	}
+	node, err := c.nodesLister.Get(nodeName)
+	if err != nil {
+		klog.ErrorS(err, "Error getting node for drift check", "node", nodeName)
+		return err
+	}
+	if len(node.Status.Images) >= nodeStatusMaxImages {
+		klog.V(4).InfoS("Node status may not list all images, skipping drift check", "node", nodeName,
+			"images", len(node.Status.Images))
+		return nil
+	}
+	ics, err := c.imageCachesLister.ImageCaches(c.scope.single).List(labels.Everything())
+	if err != nil {
+		klog.ErrorS(err, "Error listing ImageCaches")
+		return err
+	}
+	drifted := map[*v1alpha3.ImageCache][]v1alpha3.Image{}
+	for _, ic := range ics {
+		if !c.scope.contains(ic.Namespace) {
+			continue
+		}
+		// A sync in progress pulls the images anyway. After a purge the images are gone on purpose.
+		if ic.Status.Status == v1alpha3.ImageCacheActionStatusProcessing || ic.Status.Reason == v1alpha3.ImageCacheReasonImageCachePurge {
+			continue
+		}
+		for _, i := range ic.Spec.CacheSpec {
+			if !labels.Set(i.NodeSelector).AsSelector().Matches(labels.Set(node.Labels)) {
+				continue
+			}
+			for _, image := range i.Images {
+				if imagePresentInNode(image.Name, node) || failedOnNode(ic, image.Name, node) {
+					continue
+				}
+				drifted[ic] = append(drifted[ic], image)
+			}
+		}
+	}
+	if len(drifted) == 0 {
+		return nil
+	}
+	if !c.pullToNode(ctx, node, drifted, NodeWarmupWarm, NodeWarmupFailed) {
+		return nil
+	}
+	for ic, imgs := range drifted {
+		c.setImageCacheNodeLabel(ctx, nodeName, ic.Namespace, ic.Name, false)
+		for _, image := range imgs {
+			klog.InfoS("Cached image missing from node, pulling it again", "node", nodeName, "image", image.Name,
+				"imagecache", klog.KObj(ic))
+			c.recorder.Eventf(ic, corev1.EventTypeWarning, v1alpha3.ImageCacheReasonCacheDrift,
+				"Image %s is missing from node %s, pulling it again", image.Name, nodeName)
+		}
+	}
+	return nil
+}
+
+// failedOnNode reports whether the last sync of the image cache failed to
+// pull the image to the node. Such an image is not missing due to drift.
+func failedOnNode(ic *v1alpha3.ImageCache, image string, node *corev1.Node) bool {
+	for _, failure := range ic.Status.Failures[image] {
+		if failure.Node == images.NodeHostname(node) {
+			return true
+		}
+	}
+	return false
+}
+
+// imagePresentInNode reports whether the node status lists the image. Image
+// names are compared in the fully qualified form used by the container runtime.
+func imagePresentInNode(image string, node *corev1.Node) bool {
+	name, tag, digest := images.NormalizeImageName(image)
+	for _, nodeImage := range node.Status.Images {
+		for _, n := range nodeImage.Names {
+			if (tag != "" && n == name+tag) || (digest != "" && n == name+digest) || n == image {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/senthilrch/kube-fledged/pkg/images"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Reasons of the events recorded on nodes
+const (
+	nodeEventReasonImagePulled       = "ImagePulled"
+	nodeEventReasonImageDeleted      = "ImageDeleted"
+	nodeEventReasonImagePullFailed   = "ImagePullFailed"
+	nodeEventReasonImageDeleteFailed = "ImageDeleteFailed"
+)
+
+// recordNodeEvents records an event on the node of every image pulled,
+// deleted or failed, as far as the configured verbosity allows
+func (c *Controller) recordNodeEvents(results map[string]images.ImageWorkResult) {
+	c.cfgLock.RLock()
+	cfg := c.cfg
+	c.cfgLock.RUnlock()
+	for _, v := range results {
+		eventType, reason, message, ok := nodeEvent(v)
+		if !ok || !cfg.RecordNodeEvent(eventType == corev1.EventTypeWarning) {
+			continue
+		}
+		c.recorder.Event(nodeReference(v.ImageWorkRequest.Node), eventType, reason, message)
+	}
+}
+
+// nodeEvent returns the event describing the result on its node. Images which
+// are already present, planned or cancelled have no event.
+func nodeEvent(v images.ImageWorkResult) (eventType, reason, message string, ok bool) {
+	iwr := v.ImageWorkRequest
+	if iwr.Node == nil || iwr.Imagecache == nil {
+		return "", "", "", false
+	}
+	imageCache := iwr.Imagecache.Namespace + "/" + iwr.Imagecache.Name
+	purge := iwr.WorkType == images.ImageCachePurge
+	switch v.Status {
+	case images.ImageWorkResultStatusSucceeded:
+		if purge {
+			return corev1.EventTypeNormal, nodeEventReasonImageDeleted,
+				fmt.Sprintf("Deleted image %s of image cache %s", iwr.Image, imageCache), true
+		}
+		return corev1.EventTypeNormal, nodeEventReasonImagePulled,
+			fmt.Sprintf("Pulled image %s of image cache %s", iwr.Image, imageCache), true
+	case images.ImageWorkResultStatusFailed, images.ImageWorkResultStatusUnknown:
+		if purge {
+			return corev1.EventTypeWarning, nodeEventReasonImageDeleteFailed,
+				fmt.Sprintf("Failed to delete image %s of image cache %s: %s: %s", iwr.Image, imageCache, v.Reason, v.Message), true
+		}
+		return corev1.EventTypeWarning, nodeEventReasonImagePullFailed,
+			fmt.Sprintf("Failed to pull image %s of image cache %s: %s: %s", iwr.Image, imageCache, v.Reason, v.Message), true
+	case images.ImageWorkResultStatusRetryScheduled:
+		return corev1.EventTypeWarning, nodeEventReasonImagePullFailed,
+			fmt.Sprintf("Failed to pull image %s of image cache %s (attempt %d), retrying at %s: %s: %s", iwr.Image, imageCache,
+				iwr.Attempts(), v.NextRetryTime.Format(time.RFC3339), v.Reason, v.Message), true
+	}
+	return "", "", "", false
+}
+
+// nodeReference refers to the node the way the kubelet does, so that the
+// events show up in kubectl describe node
+func nodeReference(node *corev1.Node) *corev1.ObjectReference {
+	return &corev1.ObjectReference{Kind: "Node", Name: node.Name, UID: types.UID(node.Name)}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	"github.com/senthilrch/kube-fledged/pkg/images"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+)
+
+// imageCacheNodeLabelPrefix is the prefix of the node labels advertising
+// the image caches which are warm on the node
+const imageCacheNodeLabelPrefix = "cache.kubefledged.io/"
+
+// imageCacheNodeLabelWarm is the value of the node label of a warm image cache
+const imageCacheNodeLabelWarm = "warm"
+
+// imageCacheNodeLabel returns the node label key of an image cache, i.e.
+// cache.kubefledged.io/<namespace>.<name>. Names exceeding the length limit
+// of label names are shortened and suffixed with a hash to keep them unique.
+func imageCacheNodeLabel(namespace, name string) string {
+	return imageCacheNodeLabelPrefix + shortenLabelValue(namespace+"."+name)
+}
+
+// shortenLabelValue returns s if it does not exceed the length limit of label
+// values, i.e. of label names without prefix. Otherwise s is shortened and
+// suffixed with a hash to keep it unique.
+func shortenLabelValue(s string) string {
+	if len(s) <= validation.LabelValueMaxLength {
+		return s
+	}
+	sum := sha256.Sum256([]byte(s))
+	return s[:validation.LabelValueMaxLength-11] + "-" + hex.EncodeToString(sum[:])[:10]
+}
+
+// syncImageCacheNodeLabels labels the nodes on which all images of the image
+// cache were pulled by a sync, i.e. whose results all succeeded, and unlabels
+// the other nodes. A purge unlabels all nodes.
+func (c *Controller) syncImageCacheNodeLabels(ctx context.Context, imageCache *v1alpha3.ImageCache, status *v1alpha3.ImageCacheStatus,
+	results map[string]images.ImageWorkResult) {
+	nodes, err := c.nodesLister.List(labels.Everything())
+	if err != nil {
+		klog.ErrorS(err, "Error listing nodes", "imagecache", klog.KObj(imageCache))
+		return
+	}
+	warm := map[string]bool{}
+	if status.Reason != v1alpha3.ImageCacheReasonImageCachePurge {
+		for _, v := range results {
+			if v.ImageWorkRequest.Node == nil {
+				continue
+			}
+			node := v.ImageWorkRequest.Node.Name
+			succeeded := v.Status == images.ImageWorkResultStatusSucceeded || v.Status == images.ImageWorkResultStatusAlreadyPulled
+			if w, ok := warm[node]; !ok || w {
+				warm[node] = succeeded
+			}
+		}
+	}
+	for _, node := range nodes {
+		c.setImageCacheNodeLabel(ctx, node.Name, imageCache.Namespace, imageCache.Name, warm[node.Name])
+	}
+}
+
+// removeImageCacheNodeLabels unlabels all nodes of a deleted image cache
+func (c *Controller) removeImageCacheNodeLabels(ctx context.Context, namespace, name string) {
+	selector := labels.SelectorFromSet(labels.Set{imageCacheNodeLabel(namespace, name): imageCacheNodeLabelWarm})
+	nodes, err := c.nodesLister.List(selector)
+	if err != nil {
+		klog.ErrorS(err, "Error listing nodes", "imagecache", name, "namespace", namespace)
+		return
+	}
+	for _, node := range nodes {
+		c.setImageCacheNodeLabel(ctx, node.Name, namespace, name, false)
+	}
+}
+
+// setImageCacheNodeLabel adds or removes the node label of an image cache. As
+// with the warm-up state, a failed patch is only logged.
+func (c *Controller) setImageCacheNodeLabel(ctx context.Context, nodeName, namespace, name string, warm bool) {
+	key := imageCacheNodeLabel(namespace, name)
+	// The lister avoids calls to the api server for nodes which are labelled right
+	if node, err := c.nodesLister.Get(nodeName); err == nil {
+		if _, ok := node.Labels[key]; ok == warm {
+			return
+		}
+	}
+	var value interface{}
+	if warm {
+		value = imageCacheNodeLabelWarm
+	}
+	patch, _ := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]interface{}{key: value},
+		},
+	})
+	if _, err := c.kubeclientset.CoreV1().Nodes().Patch(ctx, nodeName, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		klog.ErrorS(err, "Error labelling node with image cache", "node", nodeName, "label", key, "warm", warm)
+		return
+	}
+	klog.V(4).InfoS("Image cache node label updated", "node", nodeName, "label", key, "warm", warm)
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+
+	"github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	"github.com/senthilrch/kube-fledged/pkg/notify"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// notifySync pushes the final status of a sync of the image cache to the
+// configured notification sinks. The sinks are notified in the background, so
+// that a slow sink does not hold up the workers.
+func (c *Controller) notifySync(imageCache *v1alpha3.ImageCache, syncID string, status *v1alpha3.ImageCacheStatus) {
+	c.cfgLock.RLock()
+	sinks := c.cfg.Notifications
+	c.cfgLock.RUnlock()
+	if len(sinks) == 0 {
+		return
+	}
+	completionTime := status.CompletionTime
+	if completionTime == nil {
+		now := metav1.Now()
+		completionTime = &now
+	}
+	notification := notify.Notification{
+		Namespace:      imageCache.Namespace,
+		ImageCache:     imageCache.Name,
+		SyncID:         syncID,
+		Severity:       notify.StatusSeverity(status.Status),
+		Status:         status.Status,
+		Reason:         status.Reason,
+		Message:        status.Message,
+		StartTime:      status.StartTime,
+		CompletionTime: completionTime,
+		Failures:       status.Failures,
+	}
+	go func() {
+		for _, err := range c.notifier.Notify(context.Background(), sinks, notification) {
+			klog.ErrorS(err, "Error sending notification", "imagecache", imageCache.Name, "namespace", imageCache.Namespace,
+				"status", status.Status)
+		}
+	}()
+}
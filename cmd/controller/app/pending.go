@@ -0,0 +1,98 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"sync"
+
+	"github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	"github.com/senthilrch/kube-fledged/pkg/images"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// pendingUpdates tracks the spec changes of image caches made while they are
+// under processing. It is accessed from the workers, hence guarded by lock.
+type pendingUpdates struct {
+	lock sync.Mutex
+	// caches holds, per image cache, the image cache as the sync action in
+	// progress sees it. The update diffs the latest spec against it.
+	caches map[string]*v1alpha3.ImageCache
+}
+
+func newPendingUpdates() *pendingUpdates {
+	return &pendingUpdates{caches: map[string]*v1alpha3.ImageCache{}}
+}
+
+// add records a spec change of the image cache. Only the first change is
+// kept, later changes only update the latest spec.
+func (p *pendingUpdates) add(key string, oldImageCache *v1alpha3.ImageCache) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if _, ok := p.caches[key]; !ok {
+		p.caches[key] = oldImageCache
+	}
+}
+
+// take returns and forgets the pending spec change of the image cache
+func (p *pendingUpdates) take(key string) (*v1alpha3.ImageCache, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	oldImageCache, ok := p.caches[key]
+	delete(p.caches, key)
+	return oldImageCache, ok
+}
+
+// deferUpdate records a spec change made while the image cache is under
+// processing, and its generation in the status. The change is reconciled
+// once the sync action in progress completes. If it has completed already,
+// the update is queued right away.
+func (c *Controller) deferUpdate(ctx context.Context, wqKey images.WorkQueueKey, namespace, name string, logValues []interface{}) error {
+	// Recording the change first ensures either the completing sync action or
+	// this check below picks it up
+	c.pendingUpdates.add(wqKey.ObjKey, wqKey.OldImageCache)
+	imageCache, err := c.kubefledgedclientset.KubefledgedV1alpha3().ImageCaches(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		klog.ErrorS(err, "Error getting imagecache", logValues...)
+		return err
+	}
+	if imageCache.Status.Status != v1alpha3.ImageCacheActionStatusProcessing {
+		c.queuePendingUpdate(wqKey.ObjKey)
+		return nil
+	}
+	status := imageCache.Status.DeepCopy()
+	status.PendingGeneration = imageCache.Generation
+	if err = c.updateImageCacheStatus(ctx, imageCache, status); err != nil {
+		klog.ErrorS(err, "Error updating imagecache status", append(logValues, "status", status.Status)...)
+		return err
+	}
+	klog.InfoS("Image cache changed while under processing, update deferred until it completes", append(logValues, "generation", imageCache.Generation)...)
+	return nil
+}
+
+// queuePendingUpdate queues the update of the image cache changed while it
+// was under processing. It returns false if there is no such change.
+func (c *Controller) queuePendingUpdate(key string) bool {
+	oldImageCache, ok := c.pendingUpdates.take(key)
+	if !ok {
+		return false
+	}
+	c.workqueue.AddRateLimited(images.WorkQueueKey{WorkType: images.ImageCacheUpdate, ObjKey: key, OldImageCache: oldImageCache})
+	klog.InfoS("Pending update of image cache queued", "imagecache", key)
+	return true
+}
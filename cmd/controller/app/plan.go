@@ -0,0 +1,119 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"sort"
+
+	"github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	"github.com/senthilrch/kube-fledged/pkg/images"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+)
+
+// imageCachePlanAnnotationKey makes the controller plan the syncs of an image
+// cache instead of doing them. Removing it applies the planned changes.
+const imageCachePlanAnnotationKey = "kubefledged.io/plan"
+
+// isPlanned reports whether changes of the image cache are only planned
+func isPlanned(imageCache *v1alpha3.ImageCache) bool {
+	_, ok := imageCache.Annotations[imageCachePlanAnnotationKey]
+	return ok
+}
+
+// newImageCachePlan builds the plan from the results of a planned sync. Images
+// which an earlier planned change removed from the spec are still to be
+// deleted, their deletions are carried over.
+func newImageCachePlan(imageCache *v1alpha3.ImageCache, results map[string]images.ImageWorkResult) *v1alpha3.ImageCachePlan {
+	now := metav1.Now()
+	plan := &v1alpha3.ImageCachePlan{PlanTime: &now, Images: map[string]v1alpha3.NodePlannedActionList{}}
+	for _, v := range results {
+		action := v1alpha3.NodePlannedAction{Node: images.NodeHostname(v.ImageWorkRequest.Node), Action: v1alpha3.PlannedActionPull}
+		if v.Status == images.ImageWorkResultStatusAlreadyPulled {
+			action.Action, action.Reason = v1alpha3.PlannedActionSkip, v1alpha3.ImageCacheReasonImageAlreadyPresent
+		} else if v.ImageWorkRequest.WorkType == images.ImageCachePurge {
+			action.Action = v1alpha3.PlannedActionDelete
+		}
+		plan.Images[v.ImageWorkRequest.Image] = append(plan.Images[v.ImageWorkRequest.Image], action)
+	}
+	if imageCache.Status.Plan != nil {
+		for image, actions := range imageCache.Status.Plan.Images {
+			if _, ok := plan.Images[image]; ok || specContainsImage(imageCache, image) {
+				continue
+			}
+			for _, action := range actions {
+				if action.Action == v1alpha3.PlannedActionDelete {
+					plan.Images[image] = append(plan.Images[image], action)
+				}
+			}
+		}
+	}
+	for _, actions := range plan.Images {
+		sort.Slice(actions, func(i, j int) bool { return actions[i].Node < actions[j].Node })
+	}
+	return plan
+}
+
+// plannedDeletes returns the requests deleting the images which the plan
+// deletes because they were removed from the spec
+func (c *Controller) plannedDeletes(imageCache *v1alpha3.ImageCache, plan *v1alpha3.ImageCachePlan) []images.ImageWorkRequest {
+	if plan == nil {
+		return nil
+	}
+	nodes, err := c.nodesLister.List(labels.Everything())
+	if err != nil {
+		klog.ErrorS(err, "Error listing nodes", "imagecache", klog.KObj(imageCache))
+		return nil
+	}
+	byHostname := map[string]*corev1.Node{}
+	for _, n := range nodes {
+		byHostname[images.NodeHostname(n)] = n
+	}
+	var iwrs []images.ImageWorkRequest
+	for image, actions := range plan.Images {
+		if specContainsImage(imageCache, image) {
+			continue
+		}
+		for _, action := range actions {
+			n, ok := byHostname[action.Node]
+			if action.Action != v1alpha3.PlannedActionDelete || !ok {
+				continue
+			}
+			iwrs = append(iwrs, images.ImageWorkRequest{
+				Image:                   image,
+				Node:                    n,
+				ContainerRuntimeVersion: n.Status.NodeInfo.ContainerRuntimeVersion,
+				WorkType:                images.ImageCachePurge,
+				Imagecache:              imageCache,
+			})
+		}
+	}
+	return iwrs
+}
+
+func specContainsImage(imageCache *v1alpha3.ImageCache, image string) bool {
+	for _, i := range imageCache.Spec.CacheSpec {
+		for _, img := range i.Images {
+			if img.Name == image {
+				return true
+			}
+		}
+	}
+	return false
+}
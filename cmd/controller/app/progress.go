@@ -0,0 +1,111 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	"github.com/senthilrch/kube-fledged/pkg/images"
+)
+
+// pullResult is the state of the pull or delete of an image on a node
+type pullResult int
+
+// The states in increasing precedence, when an image is requested more than
+// once for a node the request which is furthest from succeeding counts
+const (
+	pullSucceeded pullResult = iota
+	pullFailed
+	pullPending
+)
+
+// setRequestCounts sets the counters of the status of a sync action which is
+// about to start. All requests are pending.
+func setRequestCounts(status *v1alpha3.ImageCacheStatus, requests []images.ImageWorkRequest) {
+	nodes, imgs, pairs := map[string]bool{}, map[string]bool{}, map[string]bool{}
+	for _, iwr := range requests {
+		if iwr.Node == nil {
+			continue
+		}
+		nodes[iwr.Node.Name] = true
+		imgs[iwr.Image] = true
+		pairs[iwr.Node.Name+"/"+iwr.Image] = true
+	}
+	status.NodesTargeted = int32(len(nodes))
+	status.NodesReady = 0
+	status.ImagesTotal = int32(len(imgs))
+	status.PullsSucceeded = 0
+	status.PullsFailed = 0
+	status.PullsPending = int32(len(pairs))
+}
+
+// setResultCounts sets the counters of the status from the results of a sync
+// action. While the sync action is in progress, the requests which have no
+// result yet are left pending. The final results cover all requests.
+func setResultCounts(status *v1alpha3.ImageCacheStatus, results map[string]images.ImageWorkResult, final bool) {
+	pairs := map[string]pullResult{}
+	nodes, imgs := map[string]bool{}, map[string]bool{}
+	for _, v := range results {
+		if v.ImageWorkRequest.Node == nil {
+			continue
+		}
+		node := v.ImageWorkRequest.Node.Name
+		result := pullPending
+		switch v.Status {
+		case images.ImageWorkResultStatusSucceeded, images.ImageWorkResultStatusAlreadyPulled:
+			result = pullSucceeded
+		case images.ImageWorkResultStatusFailed, images.ImageWorkResultStatusUnknown, images.ImageWorkResultStatusCancelled:
+			result = pullFailed
+		}
+		key := node + "/" + v.ImageWorkRequest.Image
+		if r, ok := pairs[key]; !ok || result > r {
+			pairs[key] = result
+		}
+		if _, ok := nodes[node]; !ok {
+			nodes[node] = true
+		}
+		nodes[node] = nodes[node] && result == pullSucceeded
+		imgs[v.ImageWorkRequest.Image] = true
+	}
+
+	var succeeded, failed, pending int32
+	for _, r := range pairs {
+		switch r {
+		case pullSucceeded:
+			succeeded++
+		case pullFailed:
+			failed++
+		default:
+			pending++
+		}
+	}
+	var ready int32
+	for _, ok := range nodes {
+		if ok {
+			ready++
+		}
+	}
+	if final {
+		status.NodesTargeted = int32(len(nodes))
+		status.ImagesTotal = int32(len(imgs))
+	} else if total := status.PullsSucceeded + status.PullsFailed + status.PullsPending; total-succeeded-failed > pending {
+		pending = total - succeeded - failed
+	}
+	status.NodesReady = ready
+	status.PullsSucceeded = succeeded
+	status.PullsFailed = failed
+	status.PullsPending = pending
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"sort"
+
+	"github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	"github.com/senthilrch/kube-fledged/pkg/images"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+)
+
+// runTriggers maps the reason of a sync under processing to its trigger
+var runTriggers = map[string]v1alpha3.ImageCacheRunTrigger{
+	v1alpha3.ImageCacheReasonImageCacheCreate:  v1alpha3.ImageCacheRunTriggerCreate,
+	v1alpha3.ImageCacheReasonImageCacheUpdate:  v1alpha3.ImageCacheRunTriggerUpdate,
+	v1alpha3.ImageCacheReasonImageCacheRefresh: v1alpha3.ImageCacheRunTriggerRefresh,
+	v1alpha3.ImageCacheReasonImageCachePurge:   v1alpha3.ImageCacheRunTriggerPurge,
+}
+
+// nodeResults maps the results of image work to the results recorded in runs
+var nodeResults = map[string]v1alpha3.NodeResultType{
+	images.ImageWorkResultStatusSucceeded:     v1alpha3.NodeResultSucceeded,
+	images.ImageWorkResultStatusFailed:        v1alpha3.NodeResultFailed,
+	images.ImageWorkResultStatusUnknown:       v1alpha3.NodeResultUnknown,
+	images.ImageWorkResultStatusAlreadyPulled: v1alpha3.NodeResultAlreadyPresent,
+	images.ImageWorkResultStatusCancelled:     v1alpha3.NodeResultCancelled,
+}
+
+// recordImageCacheRun creates the ImageCacheRun of a completed sync of the
+// image cache, as it was under processing, and deletes its runs beyond the
+// history limit. Errors are only logged, the image cache status is the source
+// of truth.
+func (c *Controller) recordImageCacheRun(ctx context.Context, imageCache *v1alpha3.ImageCache, syncID string,
+	status *v1alpha3.ImageCacheStatus, results map[string]images.ImageWorkResult) {
+	c.cfgLock.RLock()
+	limit := c.cfg.ImageCacheRunHistoryLimit
+	c.cfgLock.RUnlock()
+	if limit == 0 {
+		return
+	}
+	now := metav1.Now()
+	run := &v1alpha3.ImageCacheRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            imageCacheRunName(imageCache.Name, syncID),
+			Namespace:       imageCache.Namespace,
+			Labels:          imageCacheRunLabels(imageCache),
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(imageCache, v1alpha3.SchemeGroupVersion.WithKind("ImageCache"))},
+		},
+		Status: v1alpha3.ImageCacheRunStatus{
+			ImageCache:     imageCache.Name,
+			SyncID:         syncID,
+			Trigger:        runTriggers[imageCache.Status.Reason],
+			Status:         status.Status,
+			Reason:         status.Reason,
+			Message:        status.Message,
+			StartTime:      status.StartTime,
+			CompletionTime: &now,
+			Results:        map[string]v1alpha3.NodeResultList{},
+		},
+	}
+	for _, v := range results {
+		result, ok := nodeResults[v.Status]
+		if !ok || v.ImageWorkRequest.Node == nil {
+			continue
+		}
+		nodeResult := v1alpha3.NodeResult{
+			Node:    images.NodeHostname(v.ImageWorkRequest.Node),
+			Result:  result,
+			Reason:  v.Reason,
+			Message: v.Message,
+		}
+		if imageCache.Spec.RetryPolicy != nil {
+			nodeResult.Attempts = v.ImageWorkRequest.Attempts()
+		}
+		run.Status.Results[v.ImageWorkRequest.Image] = append(run.Status.Results[v.ImageWorkRequest.Image], nodeResult)
+	}
+	for _, nodeResults := range run.Status.Results {
+		sort.Slice(nodeResults, func(i, j int) bool { return nodeResults[i].Node < nodeResults[j].Node })
+	}
+	logValues := []interface{}{"imagecache", imageCache.Name, "namespace", imageCache.Namespace, "run", run.Name}
+	if _, err := c.kubefledgedclientset.KubefledgedV1alpha3().ImageCacheRuns(imageCache.Namespace).Create(ctx, run, metav1.CreateOptions{}); err != nil {
+		klog.ErrorS(err, "Error creating imagecacherun", logValues...)
+		return
+	}
+	klog.V(4).InfoS("ImageCacheRun created", logValues...)
+	c.pruneImageCacheRuns(ctx, imageCache, limit)
+}
+
+// pruneImageCacheRuns deletes the oldest runs of the image cache, keeping the last limit runs
+func (c *Controller) pruneImageCacheRuns(ctx context.Context, imageCache *v1alpha3.ImageCache, limit int) {
+	list, err := c.kubefledgedclientset.KubefledgedV1alpha3().ImageCacheRuns(imageCache.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(imageCacheRunLabels(imageCache)).String(),
+	})
+	if err != nil {
+		klog.ErrorS(err, "Error listing imagecacheruns", "imagecache", imageCache.Name, "namespace", imageCache.Namespace)
+		return
+	}
+	var runs []v1alpha3.ImageCacheRun
+	for _, run := range list.Items {
+		if metav1.IsControlledBy(&run, imageCache) {
+			runs = append(runs, run)
+		}
+	}
+	if len(runs) <= limit {
+		return
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		ti, tj := runs[i].Status.CompletionTime, runs[j].Status.CompletionTime
+		if ti == nil || tj == nil || ti.Equal(tj) {
+			return runs[i].Name < runs[j].Name
+		}
+		return ti.Before(tj)
+	})
+	for _, run := range runs[:len(runs)-limit] {
+		if err := c.kubefledgedclientset.KubefledgedV1alpha3().ImageCacheRuns(run.Namespace).Delete(ctx, run.Name, metav1.DeleteOptions{}); err != nil {
+			klog.ErrorS(err, "Error deleting imagecacherun", "imagecache", imageCache.Name, "namespace", imageCache.Namespace, "run", run.Name)
+			continue
+		}
+		klog.V(4).InfoS("ImageCacheRun deleted", "imagecache", imageCache.Name, "namespace", imageCache.Namespace, "run", run.Name)
+	}
+}
+
+// imageCacheRunLabels returns the labels of the runs of the image cache, by
+// which they are listed. Names exceeding the length limit of label values are
+// shortened, see shortenLabelValue.
+func imageCacheRunLabels(imageCache *v1alpha3.ImageCache) labels.Set {
+	return labels.Set{"imagecache": shortenLabelValue(imageCache.Name)}
+}
+
+// imageCacheRunName returns the name of the run of the sync, made of the image
+// cache name and the start of the sync id
+func imageCacheRunName(imageCache, syncID string) string {
+	if len(syncID) > 8 {
+		syncID = syncID[:8]
+	}
+	if max := validation.DNS1123SubdomainMaxLength - len(syncID) - 1; len(imageCache) > max {
+		imageCache = imageCache[:max]
+	}
+	return imageCache + "-" + syncID
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"github.com/senthilrch/kube-fledged/pkg/config"
+	"k8s.io/apimachinery/pkg/labels"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// namespaceScope decides which namespaces' ImageCaches are handled by this
+// controller instance. An empty scope contains all namespaces.
+type namespaceScope struct {
+	// namespaces is the set of watched namespaces, nil means all namespaces
+	namespaces map[string]bool
+	// selector must match the labels of a watched namespace, nil means everything
+	selector         labels.Selector
+	namespacesLister corelisters.NamespaceLister
+	// single is the only watched namespace, or metav1.NamespaceAll
+	single string
+}
+
+// newNamespaceScope builds the scope from the configuration. namespacesLister
+// is only used when a namespace selector is configured.
+func newNamespaceScope(cfg *config.ControllerConfiguration, namespacesLister corelisters.NamespaceLister) *namespaceScope {
+	scope := &namespaceScope{namespacesLister: namespacesLister, single: cfg.SingleWatchNamespace()}
+	if len(cfg.WatchNamespaces) > 0 {
+		scope.namespaces = map[string]bool{}
+		for _, ns := range cfg.WatchNamespaces {
+			scope.namespaces[ns] = true
+		}
+	}
+	if cfg.WatchNamespaceSelector != "" {
+		// The selector has already been validated with the configuration
+		scope.selector, _ = labels.Parse(cfg.WatchNamespaceSelector)
+	}
+	return scope
+}
+
+// contains reports whether ImageCaches in namespace are handled
+func (s *namespaceScope) contains(namespace string) bool {
+	if s.namespaces != nil && !s.namespaces[namespace] {
+		return false
+	}
+	if s.selector == nil {
+		return true
+	}
+	ns, err := s.namespacesLister.Get(namespace)
+	if err != nil {
+		klog.ErrorS(err, "Error getting namespace", "namespace", namespace)
+		return false
+	}
+	return s.selector.Matches(labels.Set(ns.Labels))
+}
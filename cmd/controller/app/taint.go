@@ -0,0 +1,112 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/senthilrch/kube-fledged/pkg/images"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+)
+
+// applyStartupTaint taints a node which became ready until the critical image
+// caches are warm on it, or the startup taint timeout expires. Nodes which have
+// been warmed up before are only tainted if they still carry the taint, i.e.
+// kubefledged-controller restarted while the node was warming up.
+func (c *Controller) applyStartupTaint(ctx context.Context, node *corev1.Node) {
+	if c.startupTaint == nil {
+		return
+	}
+	if _, warmedUp := node.Annotations[nodeWarmupAnnotationKey]; warmedUp && !c.hasStartupTaint(node) {
+		return
+	}
+	if err := c.updateStartupTaint(ctx, node.Name, true); err != nil {
+		klog.ErrorS(err, "Error applying startup taint", "node", node.Name, "taint", c.startupTaint.ToString())
+		return
+	}
+	c.cfgLock.RLock()
+	timeout := c.cfg.StartupTaintTimeout.Duration
+	c.cfgLock.RUnlock()
+	klog.InfoS("Startup taint applied", "node", node.Name, "taint", c.startupTaint.ToString(), "timeout", timeout)
+	c.workqueue.AddAfter(images.WorkQueueKey{WorkType: images.NodeStartupTaintTimeout, ObjKey: node.Name}, timeout)
+}
+
+// removeStartupTaint removes the startup taint from the node if present
+func (c *Controller) removeStartupTaint(ctx context.Context, nodeName string, reason string) {
+	if c.startupTaint == nil {
+		return
+	}
+	// The lister avoids calls to the api server for nodes which are not tainted
+	if node, err := c.nodesLister.Get(nodeName); err == nil && !c.hasStartupTaint(node) {
+		return
+	}
+	if err := c.updateStartupTaint(ctx, nodeName, false); err != nil {
+		klog.ErrorS(err, "Error removing startup taint", "node", nodeName, "taint", c.startupTaint.ToString())
+		return
+	}
+	klog.InfoS("Startup taint removed", "node", nodeName, "reason", reason)
+}
+
+// hasStartupTaint reports whether the node carries the startup taint
+func (c *Controller) hasStartupTaint(node *corev1.Node) bool {
+	if c.startupTaint == nil {
+		return false
+	}
+	for i := range node.Spec.Taints {
+		if node.Spec.Taints[i].MatchTaint(c.startupTaint) {
+			return true
+		}
+	}
+	return false
+}
+
+// updateStartupTaint adds or removes the startup taint. The taints of the node
+// are replaced as a whole, guarded by the resource version.
+func (c *Controller) updateStartupTaint(ctx context.Context, nodeName string, add bool) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, err := c.kubeclientset.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if c.hasStartupTaint(node) == add {
+			return nil
+		}
+		taints := []corev1.Taint{}
+		for _, taint := range node.Spec.Taints {
+			if !taint.MatchTaint(c.startupTaint) {
+				taints = append(taints, taint)
+			}
+		}
+		if add {
+			taints = append(taints, *c.startupTaint)
+		}
+		patch, err := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{"resourceVersion": node.ResourceVersion},
+			"spec":     map[string]interface{}{"taints": taints},
+		})
+		if err != nil {
+			return err
+		}
+		_, err = c.kubeclientset.CoreV1().Nodes().Patch(ctx, nodeName, types.MergePatchType, patch, metav1.PatchOptions{})
+		return err
+	})
+}
@@ -0,0 +1,318 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	"github.com/senthilrch/kube-fledged/pkg/images"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/klog/v2"
+)
+
+// nodeWarmupAnnotationKey is the node annotation exposing the warm-up state
+const nodeWarmupAnnotationKey = "kubefledged.io/warmup-state"
+
+// NodeWarmupState is the state of a node's warm-up
+type NodeWarmupState string
+
+// Node warm-up states
+const (
+	// NodeWarmupPending means the node is ready and waits for its warm-up to start
+	NodeWarmupPending NodeWarmupState = "Pending"
+	// NodeWarmupWarming means images are being pulled to the node
+	NodeWarmupWarming NodeWarmupState = "Warming"
+	// NodeWarmupWarm means all images of the image caches are present on the node
+	NodeWarmupWarm NodeWarmupState = "Warm"
+	// NodeWarmupFailed means some images could not be pulled to the node
+	NodeWarmupFailed NodeWarmupState = "Failed"
+)
+
+type nodeWarmup struct {
+	state NodeWarmupState
+	// syncs are the image cache syncs still running for the node, by sync id
+	syncs          map[string]*v1alpha3.ImageCache
+	failed         bool
+	criticalFailed bool
+}
+
+// nodeWarmupTracker tracks the warm-up of every known node. It is accessed
+// from the informer callbacks and the workers, hence guarded by lock.
+type nodeWarmupTracker struct {
+	lock  sync.Mutex
+	nodes map[string]*nodeWarmup
+}
+
+func newNodeWarmupTracker() *nodeWarmupTracker {
+	return &nodeWarmupTracker{nodes: map[string]*nodeWarmup{}}
+}
+
+// add starts tracking a node in the given state. It returns false if the
+// node is already tracked.
+func (t *nodeWarmupTracker) add(node string, state NodeWarmupState) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if _, ok := t.nodes[node]; ok {
+		return false
+	}
+	t.nodes[node] = &nodeWarmup{state: state}
+	return true
+}
+
+// remove stops tracking a deleted node
+func (t *nodeWarmupTracker) remove(node string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.nodes, node)
+}
+
+// state returns the warm-up state of a node
+func (t *nodeWarmupTracker) state(node string) (NodeWarmupState, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	w, ok := t.nodes[node]
+	if !ok {
+		return "", false
+	}
+	return w.state, true
+}
+
+// start records the image cache syncs started for the node and returns the
+// resulting state. The node must be in one of the from states.
+func (t *nodeWarmupTracker) start(node string, syncs map[string]*v1alpha3.ImageCache, from ...NodeWarmupState) (NodeWarmupState, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	w, ok := t.nodes[node]
+	if !ok || !containsState(from, w.state) {
+		return "", false
+	}
+	w.syncs, w.failed, w.criticalFailed = syncs, false, false
+	w.state = NodeWarmupWarming
+	if len(syncs) == 0 {
+		w.state = NodeWarmupWarm
+	}
+	return w.state, true
+}
+
+// complete records the result of one image cache sync of the node. It returns
+// the image cache of the sync, the resulting state and whether the warm-up is
+// finished. The image cache is nil if the sync is unknown.
+func (t *nodeWarmupTracker) complete(node, syncID string, failed bool) (*v1alpha3.ImageCache, NodeWarmupState, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	w, ok := t.nodes[node]
+	if !ok || w.state != NodeWarmupWarming {
+		return nil, "", false
+	}
+	ic, ok := w.syncs[syncID]
+	if !ok {
+		return nil, "", false
+	}
+	delete(w.syncs, syncID)
+	w.failed = w.failed || failed
+	w.criticalFailed = w.criticalFailed || (failed && ic.Spec.Critical)
+	if len(w.syncs) > 0 {
+		return ic, w.state, false
+	}
+	w.state = NodeWarmupWarm
+	if w.failed {
+		w.state = NodeWarmupFailed
+	}
+	return ic, w.state, true
+}
+
+// criticalWarm reports whether all critical image caches were successfully
+// pulled to the node
+func (t *nodeWarmupTracker) criticalWarm(node string) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	w, ok := t.nodes[node]
+	if !ok || w.state == NodeWarmupPending || w.criticalFailed {
+		return false
+	}
+	for _, ic := range w.syncs {
+		if ic.Spec.Critical {
+			return false
+		}
+	}
+	return true
+}
+
+// trackNode starts the warm-up of a node which became ready. A node that
+// already reports being warm, e.g. after a restart of the controller, is not
+// warmed up again. Neither is a node which was ready before the controller
+// started and never warmed up, i.e. a node of the cluster the controller was
+// deployed to: it is considered warm, annotated as such and not tainted.
+func (c *Controller) trackNode(node *corev1.Node) {
+	state := NodeWarmupState(node.Annotations[nodeWarmupAnnotationKey])
+	if state == NodeWarmupWarm || (state == "" && readyBefore(node, c.startTime)) {
+		if c.nodeWarmups.add(node.Name, NodeWarmupWarm) && state == "" {
+			c.setNodeWarmupState(context.TODO(), node.Name, NodeWarmupWarm)
+		}
+		if c.hasStartupTaint(node) {
+			c.removeStartupTaint(context.TODO(), node.Name, "node is warm")
+		}
+		return
+	}
+	if !c.nodeWarmups.add(node.Name, NodeWarmupPending) {
+		return
+	}
+	klog.V(4).InfoS("Node ready, warm-up pending", "node", node.Name)
+	c.applyStartupTaint(context.TODO(), node)
+	c.setNodeWarmupState(context.TODO(), node.Name, NodeWarmupPending)
+	// Wait for defaultNodeLatency before warming up the node to make kubernetes api server happy.
+	c.workqueue.AddAfter(images.WorkQueueKey{WorkType: images.NodeWarmup, ObjKey: node.Name}, defaultNodeLatency)
+}
+
+// readyBefore reports whether the node became ready before the given time. A
+// node without a transition time of its Ready condition is taken to be new.
+func readyBefore(node *corev1.Node, t time.Time) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return !condition.LastTransitionTime.IsZero() && condition.LastTransitionTime.Time.Before(t)
+		}
+	}
+	return false
+}
+
+// warmupNode places requests to pull the images of every image cache whose
+// node selector matches the node. Only this node is targeted.
+func (c *Controller) warmupNode(ctx context.Context, nodeName string) error {
+	if state, ok := c.nodeWarmups.state(nodeName); !ok || state != NodeWarmupPending {
+		return nil
+	}
+	node, err := c.nodesLister.Get(nodeName)
+	if err != nil {
+		klog.ErrorS(err, "Error getting node for warm-up", "node", nodeName)
+		return err
+	}
+	ics, err := c.imageCachesLister.ImageCaches(c.scope.single).List(labels.Everything())
+	if err != nil {
+		klog.ErrorS(err, "Error listing ImageCaches")
+		return err
+	}
+	warmups := map[*v1alpha3.ImageCache][]v1alpha3.Image{}
+	for _, ic := range ics {
+		if !c.scope.contains(ic.Namespace) {
+			continue
+		}
+		for _, i := range ic.Spec.CacheSpec {
+			if labels.Set(i.NodeSelector).AsSelector().Matches(labels.Set(node.Labels)) {
+				warmups[ic] = append(warmups[ic], i.Images...)
+			}
+		}
+	}
+	if c.pullToNode(ctx, node, warmups, NodeWarmupPending) {
+		klog.InfoS("Warming up node", "node", nodeName, "imagecaches", len(warmups))
+		if c.nodeWarmups.criticalWarm(nodeName) {
+			c.removeStartupTaint(ctx, nodeName, "no critical image caches")
+		}
+	}
+	return nil
+}
+
+// pullToNode places the requests to pull images of image caches to the node
+// only, one sync per image cache. It returns false without placing any request
+// if the node is not in one of the from states.
+func (c *Controller) pullToNode(ctx context.Context, node *corev1.Node, pulls map[*v1alpha3.ImageCache][]v1alpha3.Image,
+	from ...NodeWarmupState) bool {
+	// The syncs are recorded before placing any request, so that no result
+	// can arrive before the node is known to be warming
+	syncs := map[string]*v1alpha3.ImageCache{}
+	for ic := range pulls {
+		syncs[string(uuid.NewUUID())] = ic
+	}
+	state, ok := c.nodeWarmups.start(node.Name, syncs, from...)
+	if !ok {
+		return false
+	}
+	for syncID, ic := range syncs {
+		for _, image := range pulls[ic] {
+			c.imageworkqueue.AddRateLimited(images.ImageWorkRequest{
+				Image:                   image.Name,
+				ForceFullCache:          image.ForceFullCache,
+				Node:                    node,
+				ContainerRuntimeVersion: node.Status.NodeInfo.ContainerRuntimeVersion,
+				WorkType:                images.NodeWarmup,
+				Imagecache:              ic,
+				SyncID:                  syncID,
+			})
+		}
+		c.imageworkqueue.AddRateLimited(images.ImageWorkRequest{WorkType: images.NodeWarmup, Imagecache: ic,
+			Node: node, SyncID: syncID, Requests: len(pulls[ic])})
+	}
+	c.setNodeWarmupState(ctx, node.Name, state)
+	return true
+}
+
+// completeNodeWarmup accounts the results of one image cache sync of a node
+// warm-up. The image cache is labelled warm on the node if all its images
+// were pulled.
+func (c *Controller) completeNodeWarmup(ctx context.Context, nodeName, syncID string, results map[string]images.ImageWorkResult) {
+	failed := false
+	for _, v := range results {
+		if v.Status == images.ImageWorkResultStatusFailed || v.Status == images.ImageWorkResultStatusUnknown {
+			failed = true
+			klog.InfoS("Image pull failed during node warm-up", "node", nodeName, "image", v.ImageWorkRequest.Image,
+				"imagecache", klog.KObj(v.ImageWorkRequest.Imagecache), "reason", v.Reason)
+		}
+	}
+	c.recordNodeEvents(results)
+	ic, state, done := c.nodeWarmups.complete(nodeName, syncID, failed)
+	if ic == nil {
+		return
+	}
+	c.setImageCacheNodeLabel(ctx, nodeName, ic.Namespace, ic.Name, !failed)
+	if ic.Spec.Critical && c.nodeWarmups.criticalWarm(nodeName) {
+		c.removeStartupTaint(ctx, nodeName, "critical image caches are warm")
+	}
+	if !done {
+		return
+	}
+	klog.InfoS("Node warm-up completed", "node", nodeName, "state", state)
+	c.setNodeWarmupState(ctx, nodeName, state)
+}
+
+// setNodeWarmupState exposes the warm-up state in the node annotation. The
+// tracker remains the source of truth, so a failed patch is only logged.
+func (c *Controller) setNodeWarmupState(ctx context.Context, nodeName string, state NodeWarmupState) {
+	patch, _ := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{nodeWarmupAnnotationKey: string(state)},
+		},
+	})
+	if _, err := c.kubeclientset.CoreV1().Nodes().Patch(ctx, nodeName, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		klog.ErrorS(err, "Error annotating node with warm-up state", "node", nodeName, "state", state)
+	}
+}
+
+func containsState(states []NodeWarmupState, state NodeWarmupState) bool {
+	for _, s := range states {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
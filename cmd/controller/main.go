@@ -17,22 +17,31 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/golang/glog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kubeinformers "k8s.io/client-go/informers"
+	coreinformers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
+	logsapi "k8s.io/component-base/logs/api/v1"
+	jsonlog "k8s.io/component-base/logs/json"
+	"k8s.io/klog/v2"
 
 	// Uncomment the following line to load the gcp plugin (only required to authenticate against GKE clusters).
 	// _ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	"github.com/senthilrch/kube-fledged/cmd/controller/app"
 	clientset "github.com/senthilrch/kube-fledged/pkg/client/clientset/versioned"
 	informers "github.com/senthilrch/kube-fledged/pkg/client/informers/externalversions"
+	"github.com/senthilrch/kube-fledged/pkg/config"
 	"github.com/senthilrch/kube-fledged/pkg/signals"
+	"github.com/senthilrch/kube-fledged/pkg/tracing"
 )
 
 var (
@@ -50,53 +59,173 @@ var (
 	//Default value for when `--job-retention-policy` flag is not set
 	canDeleteJob  bool = true
 	criSocketPath string
+	pullerBackend string
+	otlpEndpoint  string
+	otlpInsecure  bool
+	loggingFormat string
+	configFile    string
+	// comma separated list of namespaces whose ImageCaches are handled
+	watchNamespaces           string
+	watchNamespaceSelector    string
+	startupTaint              string
+	startupTaintTimeout       time.Duration
+	maxConcurrentJobs         int
+	registryPullQPS           float64
+	registryPullBurst         int
+	nodeEvents                string
+	imageCacheRunHistoryLimit int
 )
 
 func main() {
+	klog.InitFlags(nil)
 	flag.Parse()
 
+	base := baseConfiguration()
+	ctrlConfig := &base
+	if configFile != "" {
+		var err error
+		if ctrlConfig, err = config.Load(configFile, base); err != nil {
+			klog.ErrorS(err, "Error loading configuration file", "path", configFile)
+			os.Exit(1)
+		}
+	} else if err := ctrlConfig.Validate(); err != nil {
+		klog.ErrorS(err, "Invalid configuration")
+		os.Exit(1)
+	}
+
+	if err := setupLogging(ctrlConfig.LoggingFormat); err != nil {
+		klog.ErrorS(err, "Error setting up logging")
+		os.Exit(1)
+	}
+	defer klog.Flush()
+
 	// set up signals so we handle the first shutdown signal gracefully
 	stopCh := signals.SetupSignalHandler()
 
 	cfg, err := clientcmd.BuildConfigFromFlags(masterURL, kubeconfig)
 	if err != nil {
-		glog.Fatalf("Error building kubeconfig: %s", err.Error())
+		fatal(err, "Error building kubeconfig")
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), "kubefledged-controller",
+		ctrlConfig.OTLPEndpoint, ctrlConfig.OTLPInsecure)
+	if err != nil {
+		fatal(err, "Error setting up tracing")
 	}
+	defer shutdownTracing(context.Background())
 
 	kubeClient, err := kubernetes.NewForConfig(cfg)
 	if err != nil {
-		glog.Fatalf("Error building kubernetes clientset: %s", err.Error())
+		fatal(err, "Error building kubernetes clientset")
 	}
 
 	fledgedClient, err := clientset.NewForConfig(cfg)
 	if err != nil {
-		glog.Fatalf("Error building fledged clientset: %s", err.Error())
+		fatal(err, "Error building fledged clientset")
 	}
 
 	kubeInformerFactory := kubeinformers.NewSharedInformerFactory(kubeClient, time.Second*30)
-	fledgedInformerFactory := informers.NewSharedInformerFactory(fledgedClient, time.Second*30)
+	fledgedInformerFactory := informers.NewSharedInformerFactoryWithOptions(fledgedClient, time.Second*30,
+		informers.WithNamespace(ctrlConfig.SingleWatchNamespace()))
+
+	var namespaceInformer coreinformers.NamespaceInformer
+	if ctrlConfig.WatchNamespaceSelector != "" {
+		namespaceInformer = kubeInformerFactory.Core().V1().Namespaces()
+	}
 
-	controller := app.NewController(kubeClient, fledgedClient, fledgedNameSpace,
-		kubeInformerFactory.Core().V1().Nodes(),
+	controller := app.NewController(kubeClient, fledgedClient,
+		kubeInformerFactory.Core().V1().Nodes(), namespaceInformer,
 		fledgedInformerFactory.Kubefledged().V1alpha3().ImageCaches(),
-		imageCacheRefreshFrequency, imagePullDeadlineDuration, criClientImage,
-		busyboxImage, imagePullPolicy, serviceAccountName, imageDeleteJobHostNetwork,
-		jobPriorityClassName, canDeleteJob, criSocketPath)
+		ctrlConfig)
 
-	glog.Info("Starting pre-flight checks")
-	if err = controller.PreFlightChecks(); err != nil {
-		glog.Fatalf("Error running pre-flight checks: %s", err.Error())
+	// The pre-flight checks read the namespace informer's cache
+	kubeInformerFactory.Start(stopCh)
+
+	klog.InfoS("Starting pre-flight checks")
+	if err = controller.PreFlightChecks(stopCh); err != nil {
+		fatal(err, "Error running pre-flight checks")
 	}
-	glog.Info("Pre-flight checks completed")
+	klog.InfoS("Pre-flight checks completed")
 
-	go kubeInformerFactory.Start(stopCh)
 	go fledgedInformerFactory.Start(stopCh)
+	if configFile != "" {
+		go config.Watch(configFile, base, config.DefaultReloadInterval, stopCh, controller.UpdateConfiguration)
+	}
 
 	if err = controller.Run(1, stopCh); err != nil {
-		glog.Fatalf("Error running controller: %s", err.Error())
+		fatal(err, "Error running controller")
 	}
 }
 
+// baseConfiguration returns the configuration given by the command line flags
+// and environment variables. Settings in the configuration file override it.
+func baseConfiguration() config.ControllerConfiguration {
+	jobRetentionPolicy := config.JobRetentionPolicyDelete
+	if !canDeleteJob {
+		jobRetentionPolicy = config.JobRetentionPolicyRetain
+	}
+	return config.ControllerConfiguration{
+		TypeMeta:                   metav1.TypeMeta{APIVersion: config.APIVersion, Kind: config.Kind},
+		Namespace:                  fledgedNameSpace,
+		WatchNamespaces:            splitNamespaces(watchNamespaces),
+		WatchNamespaceSelector:     watchNamespaceSelector,
+		ImageCacheRefreshFrequency: metav1.Duration{Duration: imageCacheRefreshFrequency},
+		ImagePullDeadlineDuration:  metav1.Duration{Duration: imagePullDeadlineDuration},
+		ImagePullPolicy:            imagePullPolicy,
+		CRIClientImage:             criClientImage,
+		BusyboxImage:               busyboxImage,
+		ServiceAccountName:         serviceAccountName,
+		ImageDeleteJobHostNetwork:  imageDeleteJobHostNetwork,
+		JobPriorityClassName:       jobPriorityClassName,
+		JobRetentionPolicy:         jobRetentionPolicy,
+		CRISocketPath:              criSocketPath,
+		PullerBackend:              pullerBackend,
+		LoggingFormat:              loggingFormat,
+		OTLPEndpoint:               otlpEndpoint,
+		OTLPInsecure:               otlpInsecure,
+		StartupTaint:               startupTaint,
+		StartupTaintTimeout:        metav1.Duration{Duration: startupTaintTimeout},
+		MaxConcurrentJobs:          maxConcurrentJobs,
+		RegistryPullQPS:            registryPullQPS,
+		RegistryPullBurst:          registryPullBurst,
+		NodeEvents:                 nodeEvents,
+		ImageCacheRunHistoryLimit:  imageCacheRunHistoryLimit,
+	}
+}
+
+func splitNamespaces(list string) []string {
+	var namespaces []string
+	for _, ns := range strings.Split(list, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	return namespaces
+}
+
+// setupLogging switches klog to the JSON logger when the json format is requested
+func setupLogging(format string) error {
+	switch format {
+	case "text":
+		return nil
+	case "json":
+		v, err := strconv.Atoi(flag.Lookup("v").Value.String())
+		if err != nil {
+			return err
+		}
+		logger, flush := jsonlog.NewJSONLogger(logsapi.VerbosityLevel(v), jsonlog.AddNopSync(os.Stderr), nil, nil)
+		klog.SetLoggerWithOptions(logger, klog.FlushLogger(flush))
+		return nil
+	default:
+		return fmt.Errorf("unsupported logging format %q, possible values are 'text' and 'json'", format)
+	}
+}
+
+func fatal(err error, msg string) {
+	klog.ErrorS(err, msg)
+	klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+}
+
 func init() {
 
 	flag.StringVar(&kubeconfig, "kubeconfig", "",
@@ -128,19 +257,33 @@ func init() {
 			switch strings.ToLower(strings.TrimSpace(val)) {
 			case deletePolicy:
 				canDeleteJob = true
-				glog.Infof("Using '%s' Job Retention Policy", deletePolicy)
+				klog.InfoS("Using job retention policy", "policy", deletePolicy)
 				return nil
 			case retainPolicy:
 				canDeleteJob = false
-				glog.Infof("Using '%s' Job Retention Policy", retainPolicy)
+				klog.InfoS("Using job retention policy", "policy", retainPolicy)
 				return nil
 			default:
 				//canDeleteJob is initialized to true already
-				glog.Infof("Failed to set '%s' Job Retention Policy -- invalid input:"+
-					" falling back to '%s' Job Retention Policy", val, deletePolicy)
+				klog.InfoS("Invalid job retention policy, falling back to default",
+					"policy", val, "default", deletePolicy)
 				return nil
 			}
 		},
 	)
+	flag.StringVar(&configFile, "config", "", "Path to the configuration file. Settings in the file override command line flags and environment variables. Changes to the file are applied without a restart, except for namespace, the watched namespaces, loggingFormat, the OTLP settings, startupTaint and pullerBackend")
+	flag.StringVar(&watchNamespaces, "watch-namespaces", "", "Comma separated list of namespaces whose ImageCaches are handled by this controller. If not specified, ImageCaches in all namespaces are handled")
+	flag.StringVar(&watchNamespaceSelector, "watch-namespace-selector", "", "Label selector for namespaces whose ImageCaches are handled by this controller e.g. 'kubefledged.io/tenant=foo'. Combined with --watch-namespaces if both are specified")
+	flag.StringVar(&loggingFormat, "logging-format", "text", "Log output format. Possible values are 'text' and 'json'. Default value is 'text'")
+	flag.StringVar(&otlpEndpoint, "otlp-endpoint", "", "host:port of the OTLP gRPC endpoint to which trace spans are exported. Tracing is disabled when not specified")
+	flag.BoolVar(&otlpInsecure, "otlp-insecure", false, "whether to disable transport security for the connection to the OTLP endpoint. Default value: false")
+	flag.StringVar(&startupTaint, "startup-taint", "", "Taint 'key[=value]' with effect NoSchedule applied to nodes which became ready, until all critical image caches are warm on the node e.g. 'kubefledged.io/warming'. Disabled when not specified")
+	flag.DurationVar(&startupTaintTimeout, "startup-taint-timeout", time.Minute*10, "Maximum duration for which the startup taint is kept on a node. Default value: 10m")
+	flag.IntVar(&maxConcurrentJobs, "max-concurrent-jobs", 0, "Maximum number of jobs running at the same time. Further jobs are queued. Default value: 0 (no limit)")
+	flag.Float64Var(&registryPullQPS, "registry-pull-qps", 0, "Rate of image pulls per second allowed per registry host. Further pulls are queued. Default value: 0 (no limit)")
+	flag.IntVar(&registryPullBurst, "registry-pull-burst", 1, "Number of image pulls allowed at once per registry host when --registry-pull-qps is set. Default value: 1")
+	flag.IntVar(&imageCacheRunHistoryLimit, "image-cache-run-history-limit", 10, "Number of ImageCacheRuns kept per image cache, recording the trigger, times and per-node results of its syncs. Setting this flag to 0 disables recording runs. Default value: 10")
+	flag.StringVar(&nodeEvents, "node-events", config.NodeEventsAll, "Verbosity of the events recorded on nodes for image pulls and deletes. Possible values are 'none', 'failures' and 'all'. Default value is 'all'")
 	flag.StringVar(&criSocketPath, "cri-socket-path", "", "path to the cri socket on the node e.g. /run/containerd/containerd.sock (default: /var/run/docker.sock, /run/containerd/containerd.sock, /var/run/crio/crio.sock)")
+	flag.StringVar(&pullerBackend, "puller-backend", config.PullerBackendJob, "Backend which pulls and deletes images. Possible values are 'job', which creates a Job per image and node, and 'agent', which hands the work to the kubefledged-agent DaemonSet through ImageTasks. Default value is 'job'")
 }
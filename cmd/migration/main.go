@@ -6,10 +6,14 @@ import (
 	"fmt"
 
 	"github.com/golang/glog"
+	"github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha2"
 	"github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha3"
 	clientset "github.com/senthilrch/kube-fledged/pkg/client/clientset/versioned"
 	"github.com/sirupsen/logrus"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
@@ -28,6 +32,12 @@ func init() {
 		"Whether enable cache all feature of migration imagecaches.")
 }
 
+// main rewrites the image caches stored as v1alpha2 in the v1alpha3 schema.
+// It runs after the CRD making v1alpha3 the storage version was applied, before
+// kubefledged-controller is started. The API server does not convert between
+// the versions, so the image caches are listed unstructured: the ones already
+// stored as v1alpha3 cannot be decoded as v1alpha2 and are skipped, which
+// allows running the migration again.
 func main() {
 	flag.Parse()
 
@@ -41,12 +51,26 @@ func main() {
 		glog.Fatalf("error building Inference clientset: %s", err.Error())
 	}
 
-	old, err := client.KubefledgedV1alpha2().ImageCaches("").List(context.TODO(), metav1.ListOptions{})
+	dynamicClient, err := dynamic.NewForConfig(clientCmdConfig)
+	if err != nil {
+		glog.Fatalf("error building dynamic client: %s", err.Error())
+	}
+
+	old, err := dynamicClient.Resource(v1alpha2.SchemeGroupVersion.WithResource("imagecaches")).
+		List(context.TODO(), metav1.ListOptions{})
 	if err != nil {
 		glog.Fatalf("error listing Inferences: %s", err.Error())
 	}
 
-	for _, o := range old.Items {
+	for _, u := range old.Items {
+		if !storedAsV1alpha2(&u) {
+			logrus.Info("Skipping image cache already migrated: ", u.GetName(), u.GetNamespace())
+			continue
+		}
+		o := v1alpha2.ImageCache{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &o); err != nil {
+			glog.Fatalf("error decoding image cache %s/%s: %s", u.GetNamespace(), u.GetName(), err.Error())
+		}
 		spec := []v1alpha3.CacheSpecImages{}
 
 		for _, s := range o.Spec.CacheSpec {
@@ -67,12 +91,16 @@ func main() {
 		for k, messageList := range o.Status.Failures {
 			l := []v1alpha3.NodeReasonMessage{}
 			for _, v := range messageList {
-				l = append(l, v1alpha3.NodeReasonMessage(v))
+				l = append(l, v1alpha3.NodeReasonMessage{
+					Node:    v.Node,
+					Reason:  v.Reason,
+					Message: v.Message,
+				})
 			}
 			Failures[k] = l
 		}
 		new := &v1alpha3.ImageCache{
-			TypeMeta:   o.TypeMeta,
+			TypeMeta:   metav1.TypeMeta{APIVersion: v1alpha3.SchemeGroupVersion.String(), Kind: "ImageCache"},
 			ObjectMeta: o.ObjectMeta,
 			Spec: v1alpha3.ImageCacheSpec{
 				CacheSpec:        spec,
@@ -102,3 +130,22 @@ func main() {
 		fmt.Printf("%s\n", n.Name)
 	}
 }
+
+// storedAsV1alpha2 reports whether the image cache lists its images as
+// strings, i.e. is still stored in the v1alpha2 schema
+func storedAsV1alpha2(u *unstructured.Unstructured) bool {
+	cacheSpec, _, _ := unstructured.NestedSlice(u.Object, "spec", "cacheSpec")
+	for _, i := range cacheSpec {
+		m, ok := i.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		images, _, _ := unstructured.NestedSlice(m, "images")
+		for _, image := range images {
+			if _, ok := image.(string); !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestStoredAsV1alpha2(t *testing.T) {
+	tests := []struct {
+		name     string
+		images   []interface{}
+		expected bool
+	}{
+		{
+			name:     "#1: Images listed as strings",
+			images:   []interface{}{"nginx:1.23", "redis:7"},
+			expected: true,
+		},
+		{
+			name:     "#2: Images listed as objects",
+			images:   []interface{}{map[string]interface{}{"name": "nginx:1.23"}},
+			expected: false,
+		},
+		{
+			name:     "#3: No images",
+			expected: true,
+		},
+	}
+	for _, test := range tests {
+		u := &unstructured.Unstructured{Object: map[string]interface{}{
+			"spec": map[string]interface{}{
+				"cacheSpec": []interface{}{map[string]interface{}{"images": test.images}},
+			},
+		}}
+		if actual := storedAsV1alpha2(u); actual != test.expected {
+			t.Errorf("Test: %s failed: expected=%t, actual=%t", test.name, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution/reference"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+// Name is the name of the plugin used in the plugin registry and configurations
+const Name = "KubeFledged"
+
+// preScoreStateKey is the key of the pre-score state in the cycle state
+const preScoreStateKey = "PreScore" + Name
+
+// nodeWarmupAnnotationKey is the node annotation set by kubefledged-controller
+// exposing the warm-up state of the node
+const nodeWarmupAnnotationKey = "kubefledged.io/warmup-state"
+
+// Node warm-up states set by kubefledged-controller
+const (
+	nodeWarmupPending = "Pending"
+	nodeWarmupWarming = "Warming"
+	nodeWarmupWarm    = "Warm"
+	nodeWarmupFailed  = "Failed"
+)
+
+// imageCacheResource is the resource of the image caches. They are read as
+// unstructured objects, since the scheduler is built as a separate module.
+var imageCacheResource = schema.GroupVersionResource{Group: "kubefledged.io", Version: "v1alpha3", Resource: "imagecaches"}
+
+// imageCache holds the fields of an image cache the plugin scores nodes by
+type imageCache struct {
+	Spec struct {
+		CacheSpec []struct {
+			Images []struct {
+				Name string `json:"name"`
+			} `json:"images"`
+			NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+		} `json:"cacheSpec"`
+	} `json:"spec"`
+	Status struct {
+		Failures map[string][]struct {
+			Node string `json:"node"`
+		} `json:"failures,omitempty"`
+	} `json:"status,omitempty"`
+}
+
+// cacheSyncTimeout is the time allowed for the initial list of image caches,
+// e.g. the CRD may be missing or reading image caches forbidden
+var cacheSyncTimeout = time.Minute
+
+// KubeFledged is a score plugin favouring nodes on which the image caches
+// holding the pod's images are warm. Nodes still warming up are penalized,
+// since the pod would wait for the images being pulled.
+type KubeFledged struct {
+	handle      framework.Handle
+	imageCaches *imageCacheStore
+}
+
+var _ framework.PreScorePlugin = &KubeFledged{}
+var _ framework.ScorePlugin = &KubeFledged{}
+
+// preScoreState holds the pod's images and the image caches for scoring all nodes
+type preScoreState struct {
+	images      []string
+	imageCaches []*imageCache
+}
+
+// Clone returns the state itself, it is not modified after PreScore
+func (s *preScoreState) Clone() framework.StateData {
+	return s
+}
+
+// imageCacheStore holds the image caches by namespace/name. They are decoded
+// once when the informer delivers them, not in every scheduling cycle.
+type imageCacheStore struct {
+	lock        sync.RWMutex
+	imageCaches map[string]*imageCache
+}
+
+func newImageCacheStore() *imageCacheStore {
+	return &imageCacheStore{imageCaches: map[string]*imageCache{}}
+}
+
+// set decodes and stores an image cache. An image cache which cannot be
+// decoded is removed.
+func (s *imageCacheStore) set(obj interface{}) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	key, err := cache.MetaNamespaceKeyFunc(u)
+	if err != nil {
+		return
+	}
+	ic := &imageCache{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, ic); err != nil {
+		klog.ErrorS(err, "Error decoding image cache", "imagecache", klog.KObj(u))
+		ic = nil
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if ic == nil {
+		delete(s.imageCaches, key)
+		return
+	}
+	s.imageCaches[key] = ic
+}
+
+// delete removes an image cache
+func (s *imageCacheStore) delete(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.imageCaches, key)
+}
+
+// list returns all image caches
+func (s *imageCacheStore) list() []*imageCache {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	ics := make([]*imageCache, 0, len(s.imageCaches))
+	for _, ic := range s.imageCaches {
+		ics = append(ics, ic)
+	}
+	return ics
+}
+
+// New initializes the plugin and waits for the image caches to be synced. It
+// fails if they are not synced within cacheSyncTimeout.
+func New(_ runtime.Object, h framework.Handle) (framework.Plugin, error) {
+	client, err := dynamic.NewForConfig(h.KubeConfig())
+	if err != nil {
+		return nil, fmt.Errorf("error building dynamic client: %w", err)
+	}
+	store := newImageCacheStore()
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(client, 0)
+	informer := factory.ForResource(imageCacheResource).Informer()
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    store.set,
+		UpdateFunc: func(_, new interface{}) { store.set(new) },
+		DeleteFunc: store.delete,
+	})
+	stopCh := make(chan struct{})
+	factory.Start(stopCh)
+	if err := wait.PollImmediate(100*time.Millisecond, cacheSyncTimeout, func() (bool, error) {
+		return informer.HasSynced(), nil
+	}); err != nil {
+		close(stopCh)
+		return nil, fmt.Errorf("failed to wait for image caches to sync: %w", err)
+	}
+	return &KubeFledged{handle: h, imageCaches: store}, nil
+}
+
+// Name returns name of the plugin
+func (pl *KubeFledged) Name() string {
+	return Name
+}
+
+// PreScore collects the pod's images and the image caches once per scheduling cycle
+func (pl *KubeFledged) PreScore(ctx context.Context, state *framework.CycleState, pod *corev1.Pod, nodes []*corev1.Node) *framework.Status {
+	s := &preScoreState{imageCaches: pl.imageCaches.list()}
+	for _, c := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
+		s.images = append(s.images, c.Image)
+	}
+	state.Write(preScoreStateKey, s)
+	return nil
+}
+
+// Score ranks the node by the share of the pod's images cached on it
+func (pl *KubeFledged) Score(ctx context.Context, state *framework.CycleState, pod *corev1.Pod, nodeName string) (int64, *framework.Status) {
+	data, err := state.Read(preScoreStateKey)
+	if err != nil {
+		return 0, framework.AsStatus(fmt.Errorf("reading %q from cycle state: %w", preScoreStateKey, err))
+	}
+	s, ok := data.(*preScoreState)
+	if !ok {
+		return 0, framework.AsStatus(fmt.Errorf("%+v cannot be converted to preScoreState", data))
+	}
+	nodeInfo, err := pl.handle.SnapshotSharedLister().NodeInfos().Get(nodeName)
+	if err != nil {
+		return 0, framework.AsStatus(fmt.Errorf("getting node %q from Snapshot: %w", nodeName, err))
+	}
+	return scoreNode(nodeInfo.Node(), s.images, s.imageCaches), nil
+}
+
+// ScoreExtensions of the Score plugin
+func (pl *KubeFledged) ScoreExtensions() framework.ScoreExtensions {
+	return pl
+}
+
+// NormalizeScore maps the scores from [-MaxNodeScore, MaxNodeScore] to
+// [MinNodeScore, MaxNodeScore]. Nodes without cached images score in the middle.
+func (pl *KubeFledged) NormalizeScore(ctx context.Context, state *framework.CycleState, pod *corev1.Pod, scores framework.NodeScoreList) *framework.Status {
+	for i := range scores {
+		scores[i].Score = (scores[i].Score + framework.MaxNodeScore) / 2
+	}
+	return nil
+}
+
+// scoreNode returns the share of images cached on the node, scaled to
+// MaxNodeScore. Images of a node still warming up count negative. A node
+// without warm-up state, e.g. one that was ready before kubefledged-controller
+// was installed, is taken to be warm.
+func scoreNode(node *corev1.Node, images []string, imageCaches []*imageCache) int64 {
+	if len(images) == 0 {
+		return 0
+	}
+	var weight int64
+	switch node.Annotations[nodeWarmupAnnotationKey] {
+	case nodeWarmupPending, nodeWarmupWarming:
+		weight = -1
+	default:
+		weight = 1
+	}
+	var cached int64
+	for _, image := range images {
+		if cachedOnNode(image, node, imageCaches) {
+			cached++
+		}
+	}
+	return weight * cached * framework.MaxNodeScore / int64(len(images))
+}
+
+// cachedOnNode reports whether an image cache holds the image on the node.
+// An image which failed to be pulled to the node is not cached.
+func cachedOnNode(image string, node *corev1.Node, imageCaches []*imageCache) bool {
+	for _, ic := range imageCaches {
+		for _, i := range ic.Spec.CacheSpec {
+			if !labels.Set(i.NodeSelector).AsSelector().Matches(labels.Set(node.Labels)) {
+				continue
+			}
+			for _, cached := range i.Images {
+				if sameImage(cached.Name, image) && !failedOnNode(ic, cached.Name, node) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// failedOnNode reports whether the last sync of the image cache failed to
+// pull the image to the node
+func failedOnNode(ic *imageCache, image string, node *corev1.Node) bool {
+	for _, failure := range ic.Status.Failures[image] {
+		if failure.Node == node.Labels[corev1.LabelHostname] {
+			return true
+		}
+	}
+	return false
+}
+
+// sameImage compares image references in their fully qualified form
+func sameImage(a, b string) bool {
+	return normalizeImageName(a) == normalizeImageName(b)
+}
+
+func normalizeImageName(image string) string {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return image
+	}
+	return reference.TagNameOnly(named).String()
+}
@@ -0,0 +1,243 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+func newImageCache(t *testing.T, obj map[string]interface{}) *imageCache {
+	ic := &imageCache{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj, ic); err != nil {
+		t.Fatalf("error decoding image cache: %v", err)
+	}
+	return ic
+}
+
+func TestScoreNode(t *testing.T) {
+	imageCaches := []*imageCache{
+		newImageCache(t, map[string]interface{}{
+			"spec": map[string]interface{}{
+				"cacheSpec": []interface{}{
+					map[string]interface{}{
+						"images":       []interface{}{map[string]interface{}{"name": "nginx:1.23"}},
+						"nodeSelector": map[string]interface{}{"pool": "web"},
+					},
+					map[string]interface{}{
+						"images": []interface{}{map[string]interface{}{"name": "docker.io/library/redis:7"}},
+					},
+				},
+			},
+			"status": map[string]interface{}{
+				"failures": map[string]interface{}{
+					"docker.io/library/redis:7": []interface{}{map[string]interface{}{"node": "node2"}},
+				},
+			},
+		}),
+	}
+	newNode := func(name, state string, labels map[string]string) *corev1.Node {
+		node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{corev1.LabelHostname: name}}}
+		for k, v := range labels {
+			node.Labels[k] = v
+		}
+		if state != "" {
+			node.Annotations = map[string]string{nodeWarmupAnnotationKey: state}
+		}
+		return node
+	}
+	tests := []struct {
+		name          string
+		node          *corev1.Node
+		images        []string
+		expectedScore int64
+	}{
+		{
+			name:          "#1 Warm node holding all images",
+			node:          newNode("node1", nodeWarmupWarm, map[string]string{"pool": "web"}),
+			images:        []string{"docker.io/library/nginx:1.23", "redis:7"},
+			expectedScore: framework.MaxNodeScore,
+		},
+		{
+			name:          "#2 Warm node not matching the node selector of one image",
+			node:          newNode("node1", nodeWarmupWarm, nil),
+			images:        []string{"nginx:1.23", "redis:7"},
+			expectedScore: framework.MaxNodeScore / 2,
+		},
+		{
+			name:          "#3 Failed node, image failed on the node is not cached",
+			node:          newNode("node2", nodeWarmupFailed, map[string]string{"pool": "web"}),
+			images:        []string{"nginx:1.23", "redis:7"},
+			expectedScore: framework.MaxNodeScore / 2,
+		},
+		{
+			name:          "#4 Node still warming up is penalized",
+			node:          newNode("node1", nodeWarmupWarming, map[string]string{"pool": "web"}),
+			images:        []string{"nginx:1.23", "redis:7"},
+			expectedScore: -framework.MaxNodeScore,
+		},
+		{
+			name:          "#5 Node without warm-up state holding cached images is warm",
+			node:          newNode("node1", "", map[string]string{"pool": "web"}),
+			images:        []string{"nginx:1.23"},
+			expectedScore: framework.MaxNodeScore,
+		},
+		{
+			name:          "#6 Warm node, image with other tag is not cached",
+			node:          newNode("node1", nodeWarmupWarm, map[string]string{"pool": "web"}),
+			images:        []string{"nginx"},
+			expectedScore: 0,
+		},
+		{
+			name:          "#7 Node without warm-up state, image failed on the node is not cached",
+			node:          newNode("node2", "", map[string]string{"pool": "web"}),
+			images:        []string{"nginx:1.23", "redis:7"},
+			expectedScore: framework.MaxNodeScore / 2,
+		},
+		{
+			name:          "#8 Pending node is penalized",
+			node:          newNode("node1", nodeWarmupPending, nil),
+			images:        []string{"redis:7"},
+			expectedScore: -framework.MaxNodeScore,
+		},
+	}
+	for _, test := range tests {
+		if score := scoreNode(test.node, test.images, imageCaches); score != test.expectedScore {
+			t.Errorf("Test: %s failed: expectedScore=%d, actual=%d", test.name, test.expectedScore, score)
+		}
+	}
+}
+
+func TestNormalizeScore(t *testing.T) {
+	scores := framework.NodeScoreList{{Name: "warming", Score: -framework.MaxNodeScore}, {Name: "none"}, {Name: "warm", Score: framework.MaxNodeScore}}
+	pl := &KubeFledged{}
+	if status := pl.NormalizeScore(context.TODO(), nil, nil, scores); !status.IsSuccess() {
+		t.Fatalf("Test: NormalizeScore failed: %v", status)
+	}
+	expected := []int64{framework.MinNodeScore, framework.MaxNodeScore / 2, framework.MaxNodeScore}
+	for i := range scores {
+		if scores[i].Score != expected[i] {
+			t.Errorf("Test: NormalizeScore failed: node=%s, expectedScore=%d, actual=%d", scores[i].Name, expected[i], scores[i].Score)
+		}
+	}
+}
+
+func TestImageCacheStore(t *testing.T) {
+	newObj := func(name string, images ...interface{}) *unstructured.Unstructured {
+		cacheSpec := []interface{}{}
+		for _, image := range images {
+			cacheSpec = append(cacheSpec, map[string]interface{}{"images": []interface{}{image}})
+		}
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"metadata": map[string]interface{}{"name": name, "namespace": "kube-fledged"},
+			"spec":     map[string]interface{}{"cacheSpec": cacheSpec},
+		}}
+	}
+	foo := newObj("foo", map[string]interface{}{"name": "nginx:1.23"})
+	tests := []struct {
+		name           string
+		apply          func(s *imageCacheStore)
+		expectedImages []string
+	}{
+		{
+			name:           "#1: Image cache added",
+			apply:          func(s *imageCacheStore) { s.set(foo) },
+			expectedImages: []string{"nginx:1.23"},
+		},
+		{
+			name: "#2: Image cache updated",
+			apply: func(s *imageCacheStore) {
+				s.set(foo)
+				s.set(newObj("foo", map[string]interface{}{"name": "redis:7"}))
+			},
+			expectedImages: []string{"redis:7"},
+		},
+		{
+			name: "#3: Image cache deleted",
+			apply: func(s *imageCacheStore) {
+				s.set(foo)
+				s.delete(foo)
+			},
+		},
+		{
+			name: "#4: Image cache deleted while the watch was down",
+			apply: func(s *imageCacheStore) {
+				s.set(foo)
+				s.delete(cache.DeletedFinalStateUnknown{Key: "kube-fledged/foo", Obj: foo})
+			},
+		},
+		{
+			name: "#5: Image cache which cannot be decoded is removed",
+			apply: func(s *imageCacheStore) {
+				s.set(foo)
+				s.set(newObj("foo", "nginx:1.23"))
+			},
+		},
+	}
+	for _, test := range tests {
+		s := newImageCacheStore()
+		test.apply(s)
+		images := []string{}
+		for _, ic := range s.list() {
+			for _, i := range ic.Spec.CacheSpec {
+				for _, image := range i.Images {
+					images = append(images, image.Name)
+				}
+			}
+		}
+		if len(images) != len(test.expectedImages) || (len(images) > 0 && images[0] != test.expectedImages[0]) {
+			t.Errorf("Test: %s failed: expectedImages=%v, actual=%v", test.name, test.expectedImages, images)
+		}
+	}
+}
+
+// fakeHandle is the framework handle of the plugin, only KubeConfig is used
+type fakeHandle struct {
+	framework.Handle
+	config *rest.Config
+}
+
+func (h *fakeHandle) KubeConfig() *rest.Config {
+	return h.config
+}
+
+func TestNewCacheSyncTimeout(t *testing.T) {
+	// The image caches cannot be listed, e.g. the CRD is missing
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+	defer server.Close()
+	defer func(timeout time.Duration) { cacheSyncTimeout = timeout }(cacheSyncTimeout)
+	cacheSyncTimeout = 200 * time.Millisecond
+
+	_, err := New(nil, &fakeHandle{config: &rest.Config{Host: server.URL}})
+	if err == nil || !strings.Contains(err.Error(), "failed to wait for image caches to sync") {
+		t.Errorf("Test: New failed: expected sync timeout error, actual=%v", err)
+	}
+}
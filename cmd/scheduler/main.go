@@ -0,0 +1,32 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"os"
+
+	"github.com/senthilrch/kube-fledged/cmd/scheduler/app"
+	"k8s.io/component-base/cli"
+	scheduler "k8s.io/kubernetes/cmd/kube-scheduler/app"
+)
+
+// kubefledged-scheduler is kube-scheduler with the KubeFledged score plugin
+// registered. The plugin is enabled through the KubeSchedulerConfiguration.
+func main() {
+	command := scheduler.NewSchedulerCommand(scheduler.WithPlugin(app.Name, app.New))
+	os.Exit(cli.Run(command))
+}
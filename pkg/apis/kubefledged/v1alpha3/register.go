@@ -47,6 +47,10 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(SchemeGroupVersion,
 		&ImageCache{},
 		&ImageCacheList{},
+		&ImageCacheRun{},
+		&ImageCacheRunList{},
+		&ImageTask{},
+		&ImageTaskList{},
 	)
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
 	return nil
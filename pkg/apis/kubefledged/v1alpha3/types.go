@@ -27,6 +27,12 @@ import (
 // ImageCache is a specification for a ImageCache resource
 // +kubebuilder:printcolumn:name="Message",type="string",JSONPath=".status.message"
 // +kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.status"
+// +kubebuilder:printcolumn:name="Nodes",type="integer",JSONPath=".status.nodesTargeted"
+// +kubebuilder:printcolumn:name="Ready",type="integer",JSONPath=".status.nodesReady"
+// +kubebuilder:printcolumn:name="Images",type="integer",JSONPath=".status.imagesTotal"
+// +kubebuilder:printcolumn:name="Succeeded",type="integer",JSONPath=".status.pullsSucceeded"
+// +kubebuilder:printcolumn:name="Failed",type="integer",JSONPath=".status.pullsFailed"
+// +kubebuilder:printcolumn:name="Pending",type="integer",JSONPath=".status.pullsPending"
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 type ImageCache struct {
 	metav1.TypeMeta   `json:",inline"`
@@ -40,6 +46,8 @@ type ImageCache struct {
 type Image struct {
 	Name           string `json:"name"`
 	ForceFullCache bool   `json:"forceFullCache"`
+	// PullDeadline overrides the pull deadline of the image cache for the image
+	PullDeadline *metav1.Duration `json:"pullDeadline,omitempty"`
 }
 
 // CacheSpecImages specifies the Images to be cached
@@ -52,6 +60,44 @@ type CacheSpecImages struct {
 type ImageCacheSpec struct {
 	CacheSpec        []CacheSpecImages             `json:"cacheSpec"`
 	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+	RetryPolicy      *RetryPolicy                  `json:"retryPolicy,omitempty"`
+	// PinImages protects the cached images from image garbage collection of
+	// kubelet. Only supported on nodes running containerd.
+	PinImages bool `json:"pinImages,omitempty"`
+	// Critical image caches must be warm on a new node before the startup
+	// taint of kubefledged-controller is removed from it
+	Critical bool `json:"critical,omitempty"`
+	// PullDeadline is the time allowed for pulling an image to a node. It
+	// defaults to the --image-pull-deadline-duration of kubefledged-controller.
+	PullDeadline *metav1.Duration `json:"pullDeadline,omitempty"`
+	// MaintenanceWindows restrict the syncs of the image cache to these windows.
+	// Defaults to the maintenanceWindows of kubefledged-controller.
+	MaintenanceWindows []MaintenanceWindow `json:"maintenanceWindows,omitempty"`
+	// BypassMaintenanceWindows syncs creates and updates of the spec right away,
+	// refreshes and purges still wait for a maintenance window
+	BypassMaintenanceWindows bool `json:"bypassMaintenanceWindows,omitempty"`
+}
+
+// MaintenanceWindow is a recurring period of time in which images are pulled
+// and deleted
+type MaintenanceWindow struct {
+	// Schedule is a cron expression for the start of the window, e.g. "0 22 * * 1-5".
+	// The time zone can be set with a "CRON_TZ=" prefix, it defaults to the
+	// time zone of kubefledged-controller, which is UTC in its container image.
+	Schedule string `json:"schedule"`
+	// Duration is how long the window stays open
+	Duration metav1.Duration `json:"duration"`
+}
+
+// RetryPolicy specifies how failed image pulls are retried on a node. Only the
+// failed node and image pairs are retried, with exponential backoff.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of pull attempts per node and image, including the first one
+	MaxAttempts int32 `json:"maxAttempts"`
+	// InitialBackoff is the delay before the first retry. Defaults to 10s.
+	InitialBackoff *metav1.Duration `json:"initialBackoff,omitempty"`
+	// MaxBackoff caps the delay between retries. Defaults to 5m.
+	MaxBackoff *metav1.Duration `json:"maxBackoff,omitempty"`
 }
 
 // ImageCacheStatus is the status for a ImageCache resource
@@ -62,13 +108,67 @@ type ImageCacheStatus struct {
 	Failures       map[string]NodeReasonMessageList `json:"failures,omitempty"`
 	StartTime      *metav1.Time                     `json:"startTime"`
 	CompletionTime *metav1.Time                     `json:"completionTime,omitempty"`
+	// Plan lists what the next sync would do while the image cache is annotated
+	// with kubefledged.io/plan
+	Plan *ImageCachePlan `json:"plan,omitempty"`
+	// QueuedRequests is the number of image pulls or deletes of the sync in
+	// progress which wait for the job concurrency or registry pull rate limits
+	QueuedRequests int32 `json:"queuedRequests,omitempty"`
+	// PendingGeneration is the generation of a spec change made while the
+	// image cache is under processing. It is reconciled once the sync in
+	// progress completes.
+	PendingGeneration int64 `json:"pendingGeneration,omitempty"`
+	// NodesTargeted is the number of nodes the sync action pulls images to or
+	// deletes images from
+	NodesTargeted int32 `json:"nodesTargeted,omitempty"`
+	// NodesReady is the number of targeted nodes on which all images of the
+	// sync action were pulled or deleted successfully
+	NodesReady int32 `json:"nodesReady,omitempty"`
+	// ImagesTotal is the number of images of the sync action
+	ImagesTotal int32 `json:"imagesTotal,omitempty"`
+	// PullsSucceeded, PullsFailed and PullsPending count the image pulls of the
+	// sync action by their result, or the image deletes of a purge
+	PullsSucceeded int32 `json:"pullsSucceeded,omitempty"`
+	PullsFailed    int32 `json:"pullsFailed,omitempty"`
+	PullsPending   int32 `json:"pullsPending,omitempty"`
 }
 
+// ImageCachePlan has the actions planned for each image, on each node
+type ImageCachePlan struct {
+	PlanTime *metav1.Time                     `json:"planTime"`
+	Images   map[string]NodePlannedActionList `json:"images,omitempty"`
+}
+
+// NodePlannedAction has the action planned for an image on a node
+type NodePlannedAction struct {
+	Node   string        `json:"node"`
+	Action PlannedAction `json:"action"`
+	// Reason tells why the image is skipped
+	Reason string `json:"reason,omitempty"`
+}
+
+// NodePlannedActionList has list of node planned action
+type NodePlannedActionList []NodePlannedAction
+
+// PlannedAction defines the action planned for an image on a node
+type PlannedAction string
+
+// List of constants for PlannedAction
+const (
+	PlannedActionPull   PlannedAction = "Pull"
+	PlannedActionDelete PlannedAction = "Delete"
+	PlannedActionSkip   PlannedAction = "Skip"
+)
+
 // NodeReasonMessage has failure reason and message for a node
 type NodeReasonMessage struct {
 	Node    string `json:"node"`
 	Reason  string `json:"reason"`
 	Message string `json:"message"`
+	// Attempts is the number of pull attempts made when a retry policy is set
+	Attempts int32 `json:"attempts,omitempty"`
+	// NextRetryTime is set while a retry is scheduled
+	NextRetryTime *metav1.Time `json:"nextRetryTime,omitempty"`
 }
 
 // NodeReasonMessageList has list of node reason message
@@ -84,6 +184,155 @@ type ImageCacheList struct {
 	Items []ImageCache `json:"items"`
 }
 
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ImageCacheRun records a sync of an ImageCache, which owns it. Only the last
+// runs of each image cache are kept.
+// +kubebuilder:printcolumn:name="ImageCache",type="string",JSONPath=".status.imageCache"
+// +kubebuilder:printcolumn:name="Trigger",type="string",JSONPath=".status.trigger"
+// +kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.status"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+type ImageCacheRun struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Status ImageCacheRunStatus `json:"status"`
+}
+
+// ImageCacheRunStatus has the trigger, times and per-node results of a sync
+type ImageCacheRunStatus struct {
+	ImageCache     string                 `json:"imageCache"`
+	SyncID         string                 `json:"syncID"`
+	Trigger        ImageCacheRunTrigger   `json:"trigger"`
+	Status         ImageCacheActionStatus `json:"status"`
+	Reason         string                 `json:"reason"`
+	Message        string                 `json:"message"`
+	StartTime      *metav1.Time           `json:"startTime"`
+	CompletionTime *metav1.Time           `json:"completionTime"`
+	// Results has the result of each image on each node
+	Results map[string]NodeResultList `json:"results,omitempty"`
+}
+
+// ImageCacheRunTrigger defines what started a sync
+type ImageCacheRunTrigger string
+
+// List of constants for ImageCacheRunTrigger
+const (
+	ImageCacheRunTriggerCreate  ImageCacheRunTrigger = "Create"
+	ImageCacheRunTriggerUpdate  ImageCacheRunTrigger = "Update"
+	ImageCacheRunTriggerRefresh ImageCacheRunTrigger = "Refresh"
+	ImageCacheRunTriggerPurge   ImageCacheRunTrigger = "Purge"
+)
+
+// NodeResult has the result of an image pull or delete on a node
+type NodeResult struct {
+	Node    string         `json:"node"`
+	Result  NodeResultType `json:"result"`
+	Reason  string         `json:"reason,omitempty"`
+	Message string         `json:"message,omitempty"`
+	// Attempts is the number of pull attempts made when a retry policy is set
+	Attempts int32 `json:"attempts,omitempty"`
+}
+
+// NodeResultList has list of node result
+type NodeResultList []NodeResult
+
+// NodeResultType defines the result of an image pull or delete on a node
+type NodeResultType string
+
+// List of constants for NodeResultType
+const (
+	NodeResultSucceeded      NodeResultType = "Succeeded"
+	NodeResultFailed         NodeResultType = "Failed"
+	NodeResultUnknown        NodeResultType = "Unknown"
+	NodeResultAlreadyPresent NodeResultType = "AlreadyPresent"
+	NodeResultCancelled      NodeResultType = "Cancelled"
+)
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ImageCacheRunList is a list of ImageCacheRun resources
+type ImageCacheRunList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []ImageCacheRun `json:"items"`
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ImageTask asks the kubefledged agent running on a node to pull or remove an
+// image through the container runtime. The agent reports the result in the status.
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Node",type="string",JSONPath=".spec.nodeName"
+// +kubebuilder:printcolumn:name="Action",type="string",JSONPath=".spec.action"
+// +kubebuilder:printcolumn:name="Image",type="string",JSONPath=".spec.image"
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+type ImageTask struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ImageTaskSpec   `json:"spec"`
+	Status ImageTaskStatus `json:"status,omitempty"`
+}
+
+// ImageTaskSpec has the node, the action and the image of an image task
+type ImageTaskSpec struct {
+	// NodeName is the node on which the action is done
+	NodeName string          `json:"nodeName"`
+	Action   ImageTaskAction `json:"action"`
+	Image    string          `json:"image"`
+	// ImagePullPolicy is either IfNotPresent or Always. With IfNotPresent the
+	// image is not pulled again if the container runtime has it already.
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+	// ImagePullSecrets are the secrets in the namespace of the task used to pull the image
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+	// ActiveDeadlineSeconds is the time the agent may spend on the task, counted from its creation
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+}
+
+// ImageTaskAction defines what the agent does with the image
+type ImageTaskAction string
+
+// List of constants for ImageTaskAction
+const (
+	ImageTaskActionPull   ImageTaskAction = "Pull"
+	ImageTaskActionRemove ImageTaskAction = "Remove"
+)
+
+// ImageTaskStatus has the result of an image task
+type ImageTaskStatus struct {
+	Phase   ImageTaskPhase `json:"phase,omitempty"`
+	Reason  string         `json:"reason,omitempty"`
+	Message string         `json:"message,omitempty"`
+	// ImageRef is the reference of the pulled image reported by the container runtime
+	ImageRef       string       `json:"imageRef,omitempty"`
+	StartTime      *metav1.Time `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+// ImageTaskPhase defines the phase of an image task, empty until the agent finished it
+type ImageTaskPhase string
+
+// List of constants for ImageTaskPhase
+const (
+	ImageTaskPhaseSucceeded ImageTaskPhase = "Succeeded"
+	ImageTaskPhaseFailed    ImageTaskPhase = "Failed"
+)
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ImageTaskList is a list of ImageTask resources
+type ImageTaskList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []ImageTask `json:"items"`
+}
+
 // ImageCacheActionStatus defines the status of ImageCacheAction
 type ImageCacheActionStatus string
 
@@ -114,6 +363,18 @@ const (
 	ImageCacheReasonCacheSpecValidationFailed      = "CacheSpecValidationFailed"
 	ImageCacheReasonOldImageCacheNotFound          = "OldImageCacheNotFound"
 	ImageCacheReasonNotSupportedUpdates            = "NotSupportedUpdates"
+	ImageCacheReasonImagePullRetryScheduled        = "ImagePullRetryScheduled"
+	ImageCacheReasonCacheDrift                     = "CacheDrift"
+	ImageCacheReasonImagePinNotAttempted           = "ImagePinNotAttempted"
+	ImageCacheReasonImageAlreadyPresent            = "ImageAlreadyPresent"
+	ImageCacheReasonImageCachePlan                 = "ImageCachePlan"
+	ImageCacheReasonRateLimited                    = "RateLimited"
+	ImageCacheReasonMaintenanceWindow              = "MaintenanceWindow"
+	ImageCacheReasonImageCacheCancelled            = "ImageCacheCancelled"
+	ImageCacheReasonJobDeleted                     = "JobDeleted"
+	ImageCacheReasonImageTaskDeleted               = "ImageTaskDeleted"
+	ImageCacheReasonImageTaskNotFinished           = "ImageTaskNotFinished"
+	ImageCacheReasonJobCreationFailed              = "JobCreationFailed"
 )
 
 // List of constants for ImageCacheMessage
@@ -133,4 +394,15 @@ const (
 	ImageCacheMessageOldImageCacheNotFound          = "Unable to fetch the previous version of Image cache spec before update action."
 	ImageCacheMessageNotSupportedUpdates            = "The updates performed to image cache spec is not supported. Only addition or removal of images in a image list is supported."
 	ImageCacheMessageNoImagesPulledOrDeleted        = "No images were pulled or deleted because nodeSelector specified did not match any nodes"
+	ImageCacheMessageImagePullRetryScheduled        = "Image pull failed on some nodes and will be retried. Please see \"failures\" section"
+	ImageCacheMessageImagePinNotAttempted           = "Image pulled but not pinned before the image pull deadline"
+	ImageCacheMessageImageCachePlanned              = "Changes of image cache are planned, not applied. Please see \"plan\" section"
+	ImageCacheMessageRateLimited                    = "Job not created before the image pull deadline because of the job concurrency or registry pull rate limits"
+	ImageCacheMessageMaintenanceWindowClosed        = "Job not created before the image pull deadline because the maintenance window closed"
+	ImageCacheMessageImageCacheCancelled            = "Image cache processing cancelled. Please see \"failures\" section"
+	ImageCacheMessageJobCancelled                   = "Job deleted, image cache processing was cancelled"
+	ImageCacheMessageRequestCancelled               = "Job not created, image cache processing was cancelled"
+	ImageCacheMessageJobDeleted                     = "Job deleted before it finished"
+	ImageCacheMessageImageTaskDeleted               = "Image task deleted before the agent finished it"
+	ImageCacheMessageImageTaskNotFinished           = "Image task not finished by kubefledged-agent before the deadline. Check that the agent runs on the node"
 )
@@ -32,6 +32,14 @@ func (c *FakeKubefledgedV1alpha3) ImageCaches(namespace string) v1alpha3.ImageCa
 	return &FakeImageCaches{c, namespace}
 }
 
+func (c *FakeKubefledgedV1alpha3) ImageCacheRuns(namespace string) v1alpha3.ImageCacheRunInterface {
+	return &FakeImageCacheRuns{c, namespace}
+}
+
+func (c *FakeKubefledgedV1alpha3) ImageTasks(namespace string) v1alpha3.ImageTaskInterface {
+	return &FakeImageTasks{c, namespace}
+}
+
 // RESTClient returns a RESTClient that is used to communicate
 // with API server by this client implementation.
 func (c *FakeKubefledgedV1alpha3) RESTClient() rest.Interface {
@@ -19,3 +19,7 @@ limitations under the License.
 package v1alpha3
 
 type ImageCacheExpansion interface{}
+
+type ImageCacheRunExpansion interface{}
+
+type ImageTaskExpansion interface{}
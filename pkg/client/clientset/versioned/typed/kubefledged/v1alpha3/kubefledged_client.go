@@ -29,6 +29,8 @@ import (
 type KubefledgedV1alpha3Interface interface {
 	RESTClient() rest.Interface
 	ImageCachesGetter
+	ImageCacheRunsGetter
+	ImageTasksGetter
 }
 
 // KubefledgedV1alpha3Client is used to interact with features provided by the kubefledged.io group.
@@ -40,6 +42,14 @@ func (c *KubefledgedV1alpha3Client) ImageCaches(namespace string) ImageCacheInte
 	return newImageCaches(c, namespace)
 }
 
+func (c *KubefledgedV1alpha3Client) ImageCacheRuns(namespace string) ImageCacheRunInterface {
+	return newImageCacheRuns(c, namespace)
+}
+
+func (c *KubefledgedV1alpha3Client) ImageTasks(namespace string) ImageTaskInterface {
+	return newImageTasks(c, namespace)
+}
+
 // NewForConfig creates a new KubefledgedV1alpha3Client for the given config.
 // NewForConfig is equivalent to NewForConfigAndClient(c, httpClient),
 // where httpClient was generated with rest.HTTPClientFor(c).
@@ -60,6 +60,8 @@ func (f *sharedInformerFactory) ForResource(resource schema.GroupVersionResource
 		// Group=kubefledged.io, Version=v1alpha3
 	case v1alpha3.SchemeGroupVersion.WithResource("imagecaches"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Kubefledged().V1alpha3().ImageCaches().Informer()}, nil
+	case v1alpha3.SchemeGroupVersion.WithResource("imagetasks"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Kubefledged().V1alpha3().ImageTasks().Informer()}, nil
 
 	}
 
@@ -26,6 +26,8 @@ import (
 type Interface interface {
 	// ImageCaches returns a ImageCacheInformer.
 	ImageCaches() ImageCacheInformer
+	// ImageTasks returns a ImageTaskInformer.
+	ImageTasks() ImageTaskInformer
 }
 
 type version struct {
@@ -43,3 +45,8 @@ func New(f internalinterfaces.SharedInformerFactory, namespace string, tweakList
 func (v *version) ImageCaches() ImageCacheInformer {
 	return &imageCacheInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
 }
+
+// ImageTasks returns a ImageTaskInformer.
+func (v *version) ImageTasks() ImageTaskInformer {
+	return &imageTaskInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
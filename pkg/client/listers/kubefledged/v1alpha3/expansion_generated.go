@@ -25,3 +25,11 @@ type ImageCacheListerExpansion interface{}
 // ImageCacheNamespaceListerExpansion allows custom methods to be added to
 // ImageCacheNamespaceLister.
 type ImageCacheNamespaceListerExpansion interface{}
+
+// ImageTaskListerExpansion allows custom methods to be added to
+// ImageTaskLister.
+type ImageTaskListerExpansion interface{}
+
+// ImageTaskNamespaceListerExpansion allows custom methods to be added to
+// ImageTaskNamespaceLister.
+type ImageTaskNamespaceListerExpansion interface{}
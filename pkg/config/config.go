@@ -0,0 +1,360 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package config loads and watches the kubefledged-controller configuration file
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	fledgedv1alpha3 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	"github.com/senthilrch/kube-fledged/pkg/maintenance"
+	"github.com/senthilrch/kube-fledged/pkg/notify"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/validation"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilvalidation "k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// APIVersion is the version of the configuration file format
+	APIVersion = "kubefledged.io/v1alpha1"
+	// Kind is the kind of the configuration file
+	Kind = "ControllerConfiguration"
+	// DefaultReloadInterval is how often the configuration file is checked for changes
+	DefaultReloadInterval = 10 * time.Second
+)
+
+// Job retention policies
+const (
+	JobRetentionPolicyDelete = "delete"
+	JobRetentionPolicyRetain = "retain"
+)
+
+// Backends which pull and delete images
+const (
+	PullerBackendJob   = "job"
+	PullerBackendAgent = "agent"
+)
+
+// Verbosities of the events recorded on nodes
+const (
+	NodeEventsNone     = "none"
+	NodeEventsFailures = "failures"
+	NodeEventsAll      = "all"
+)
+
+// ControllerConfiguration holds all the settings of kubefledged-controller
+type ControllerConfiguration struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// Namespace in which kubefledged-controller runs. Requires a restart.
+	Namespace string `json:"namespace,omitempty"`
+	// WatchNamespaces restricts the handled ImageCaches to these namespaces.
+	// Empty means all namespaces. Requires a restart.
+	WatchNamespaces []string `json:"watchNamespaces,omitempty"`
+	// WatchNamespaceSelector restricts the handled ImageCaches to namespaces
+	// whose labels match this selector. Requires a restart.
+	WatchNamespaceSelector string `json:"watchNamespaceSelector,omitempty"`
+	// ImageCacheRefreshFrequency is the interval between image cache refreshes. 0s disables refresh.
+	ImageCacheRefreshFrequency metav1.Duration `json:"imageCacheRefreshFrequency,omitempty"`
+	// ImagePullDeadlineDuration is the maximum duration allowed for pulling an image
+	ImagePullDeadlineDuration metav1.Duration `json:"imagePullDeadlineDuration,omitempty"`
+	// ImagePullPolicy is either IfNotPresent or Always
+	ImagePullPolicy string `json:"imagePullPolicy,omitempty"`
+	// CRIClientImage is the image used by jobs that delete images
+	CRIClientImage string `json:"criClientImage,omitempty"`
+	// BusyboxImage is the image used by jobs that pull images
+	BusyboxImage string `json:"busyboxImage,omitempty"`
+	// ServiceAccountName used in jobs created for pulling or deleting images
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+	// ImageDeleteJobHostNetwork runs image delete jobs with HostNetwork: true
+	ImageDeleteJobHostNetwork bool `json:"imageDeleteJobHostNetwork,omitempty"`
+	// JobPriorityClassName is the priorityClassName of jobs created by kubefledged-controller
+	JobPriorityClassName string `json:"jobPriorityClassName,omitempty"`
+	// JobRetentionPolicy is either delete or retain
+	JobRetentionPolicy string `json:"jobRetentionPolicy,omitempty"`
+	// CRISocketPath is the path to the cri socket on the node
+	CRISocketPath string `json:"criSocketPath,omitempty"`
+	// PullerBackend is either job, which creates a job per image and node, or
+	// agent, which hands the pulls and deletes to kubefledged-agent on the node
+	// through ImageTasks. Requires a restart.
+	PullerBackend string `json:"pullerBackend,omitempty"`
+	// LoggingFormat is either text or json. Requires a restart.
+	LoggingFormat string `json:"loggingFormat,omitempty"`
+	// OTLPEndpoint is the host:port of the OTLP gRPC endpoint. Requires a restart.
+	OTLPEndpoint string `json:"otlpEndpoint,omitempty"`
+	// OTLPInsecure disables transport security for the OTLP connection. Requires a restart.
+	OTLPInsecure bool `json:"otlpInsecure,omitempty"`
+	// StartupTaint is a taint "key[=value]" with effect NoSchedule, applied to new
+	// nodes until the critical image caches are warm. Empty disables it. Requires a restart.
+	StartupTaint string `json:"startupTaint,omitempty"`
+	// StartupTaintTimeout is the maximum duration for which the startup taint is kept
+	StartupTaintTimeout metav1.Duration `json:"startupTaintTimeout,omitempty"`
+	// MaxConcurrentJobs caps the number of jobs running at the same time. 0 means no limit.
+	MaxConcurrentJobs int `json:"maxConcurrentJobs,omitempty"`
+	// RegistryPullQPS is the rate of image pulls allowed per registry host. 0 means no limit.
+	RegistryPullQPS float64 `json:"registryPullQPS,omitempty"`
+	// RegistryPullBurst is the number of image pulls allowed at once per registry host
+	RegistryPullBurst int `json:"registryPullBurst,omitempty"`
+	// RegistryPullLimits overrides the pull rate limit of individual registry hosts, e.g. docker.io
+	RegistryPullLimits map[string]RegistryPullLimit `json:"registryPullLimits,omitempty"`
+	// MaintenanceWindows restrict the syncs of image caches which do not set
+	// their own maintenance windows. Empty means images are synced at any time.
+	MaintenanceWindows []fledgedv1alpha3.MaintenanceWindow `json:"maintenanceWindows,omitempty"`
+	// NodeEvents is the verbosity of the events recorded on nodes for image
+	// pulls and deletes, either none, failures or all
+	NodeEvents string `json:"nodeEvents,omitempty"`
+	// ImageCacheRunHistoryLimit is the number of ImageCacheRuns kept per image
+	// cache. 0 disables recording runs.
+	ImageCacheRunHistoryLimit int `json:"imageCacheRunHistoryLimit,omitempty"`
+	// Notifications are the sinks notified of the final status of image cache syncs
+	Notifications []notify.SinkConfig `json:"notifications,omitempty"`
+}
+
+// RegistryPullLimit is the token bucket limiting the image pulls from a registry host
+type RegistryPullLimit struct {
+	// QPS is the rate of image pulls allowed. 0 means no limit.
+	QPS float64 `json:"qps"`
+	// Burst is the number of image pulls allowed at once
+	Burst int `json:"burst"`
+}
+
+// RegistryPullLimit returns the pull rate limit of the registry host
+func (c ControllerConfiguration) RegistryPullLimit(registry string) RegistryPullLimit {
+	if limit, ok := c.RegistryPullLimits[registry]; ok {
+		return limit
+	}
+	return RegistryPullLimit{QPS: c.RegistryPullQPS, Burst: c.RegistryPullBurst}
+}
+
+// CanDeleteJob reports whether finished jobs should be deleted
+func (c ControllerConfiguration) CanDeleteJob() bool {
+	return c.JobRetentionPolicy != JobRetentionPolicyRetain
+}
+
+// RecordNodeEvent reports whether an event of the given type is recorded on nodes
+func (c ControllerConfiguration) RecordNodeEvent(warning bool) bool {
+	switch c.NodeEvents {
+	case NodeEventsNone:
+		return false
+	case NodeEventsFailures:
+		return warning
+	default:
+		return true
+	}
+}
+
+// SingleWatchNamespace returns the namespace when ImageCaches of exactly one
+// namespace are handled, so that informers can be restricted to it. Otherwise
+// it returns metav1.NamespaceAll.
+func (c ControllerConfiguration) SingleWatchNamespace() string {
+	if len(c.WatchNamespaces) == 1 && c.WatchNamespaceSelector == "" {
+		return c.WatchNamespaces[0]
+	}
+	return metav1.NamespaceAll
+}
+
+// StartupNodeTaint returns the startup taint, nil if it is disabled
+func (c ControllerConfiguration) StartupNodeTaint() *corev1.Taint {
+	if c.StartupTaint == "" {
+		return nil
+	}
+	key, value, _ := strings.Cut(c.StartupTaint, "=")
+	return &corev1.Taint{Key: key, Value: value, Effect: corev1.TaintEffectNoSchedule}
+}
+
+// Validate checks the configuration for invalid values
+func (c *ControllerConfiguration) Validate() error {
+	if c.APIVersion != APIVersion {
+		return fmt.Errorf("unsupported apiVersion %q, expected %q", c.APIVersion, APIVersion)
+	}
+	if c.Kind != Kind {
+		return fmt.Errorf("unsupported kind %q, expected %q", c.Kind, Kind)
+	}
+	if c.Namespace == "" {
+		return fmt.Errorf("namespace must not be empty")
+	}
+	for _, ns := range c.WatchNamespaces {
+		if errs := validation.ValidateNamespaceName(ns, false); len(errs) > 0 {
+			return fmt.Errorf("invalid namespace %q in watchNamespaces: %s", ns, strings.Join(errs, ", "))
+		}
+	}
+	if _, err := labels.Parse(c.WatchNamespaceSelector); err != nil {
+		return fmt.Errorf("invalid watchNamespaceSelector: %v", err)
+	}
+	if c.ImageCacheRefreshFrequency.Duration < 0 {
+		return fmt.Errorf("imageCacheRefreshFrequency must not be negative")
+	}
+	if c.ImagePullDeadlineDuration.Duration <= 0 {
+		return fmt.Errorf("imagePullDeadlineDuration must be positive")
+	}
+	if c.ImagePullPolicy != "IfNotPresent" && c.ImagePullPolicy != "Always" {
+		return fmt.Errorf("unsupported imagePullPolicy %q, possible values are 'IfNotPresent' and 'Always'", c.ImagePullPolicy)
+	}
+	if c.CRIClientImage == "" {
+		return fmt.Errorf("criClientImage must not be empty")
+	}
+	if c.BusyboxImage == "" {
+		return fmt.Errorf("busyboxImage must not be empty")
+	}
+	if c.JobRetentionPolicy != JobRetentionPolicyDelete && c.JobRetentionPolicy != JobRetentionPolicyRetain {
+		return fmt.Errorf("unsupported jobRetentionPolicy %q, possible values are 'delete' and 'retain'", c.JobRetentionPolicy)
+	}
+	if c.PullerBackend != PullerBackendJob && c.PullerBackend != PullerBackendAgent {
+		return fmt.Errorf("unsupported pullerBackend %q, possible values are 'job' and 'agent'", c.PullerBackend)
+	}
+	if c.LoggingFormat != "text" && c.LoggingFormat != "json" {
+		return fmt.Errorf("unsupported loggingFormat %q, possible values are 'text' and 'json'", c.LoggingFormat)
+	}
+	if taint := c.StartupNodeTaint(); taint != nil {
+		if errs := utilvalidation.IsQualifiedName(taint.Key); len(errs) > 0 {
+			return fmt.Errorf("invalid startupTaint key %q: %s", taint.Key, strings.Join(errs, ", "))
+		}
+		if errs := utilvalidation.IsValidLabelValue(taint.Value); len(errs) > 0 {
+			return fmt.Errorf("invalid startupTaint value %q: %s", taint.Value, strings.Join(errs, ", "))
+		}
+		if c.StartupTaintTimeout.Duration <= 0 {
+			return fmt.Errorf("startupTaintTimeout must be positive")
+		}
+	}
+	if c.MaxConcurrentJobs < 0 {
+		return fmt.Errorf("maxConcurrentJobs must not be negative")
+	}
+	if err := validateRegistryPullLimit("registryPull", RegistryPullLimit{QPS: c.RegistryPullQPS, Burst: c.RegistryPullBurst}); err != nil {
+		return err
+	}
+	for registry, limit := range c.RegistryPullLimits {
+		if err := validateRegistryPullLimit(fmt.Sprintf("registryPullLimits[%s].", registry), limit); err != nil {
+			return err
+		}
+	}
+	if err := maintenance.Validate(c.MaintenanceWindows); err != nil {
+		return fmt.Errorf("invalid maintenanceWindows: %v", err)
+	}
+	if err := notify.Validate(c.Notifications); err != nil {
+		return fmt.Errorf("invalid notifications: %v", err)
+	}
+	if c.ImageCacheRunHistoryLimit < 0 {
+		return fmt.Errorf("imageCacheRunHistoryLimit must not be negative")
+	}
+	if c.NodeEvents != NodeEventsNone && c.NodeEvents != NodeEventsFailures && c.NodeEvents != NodeEventsAll {
+		return fmt.Errorf("unsupported nodeEvents %q, possible values are 'none', 'failures' and 'all'", c.NodeEvents)
+	}
+	return nil
+}
+
+func validateRegistryPullLimit(prefix string, limit RegistryPullLimit) error {
+	if limit.QPS < 0 {
+		return fmt.Errorf("%sQPS must not be negative", prefix)
+	}
+	if limit.QPS > 0 && limit.Burst < 1 {
+		return fmt.Errorf("%sBurst must be at least 1", prefix)
+	}
+	return nil
+}
+
+// Load reads the configuration file at path. Settings missing from the file
+// keep their value in base, which holds the command line flags and environment.
+func Load(path string, base ControllerConfiguration) (*ControllerConfiguration, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parse(data, base)
+}
+
+func parse(data []byte, base ControllerConfiguration) (*ControllerConfiguration, error) {
+	cfg := base
+	cfg.TypeMeta = metav1.TypeMeta{}
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, fmt.Errorf("error parsing configuration: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %v", err)
+	}
+	return &cfg, nil
+}
+
+// RestartRequired returns the settings which differ between old and new but
+// only take effect after kubefledged-controller is restarted
+func RestartRequired(old, new *ControllerConfiguration) []string {
+	var changed []string
+	if old.Namespace != new.Namespace {
+		changed = append(changed, "namespace")
+	}
+	if !reflect.DeepEqual(old.WatchNamespaces, new.WatchNamespaces) {
+		changed = append(changed, "watchNamespaces")
+	}
+	if old.WatchNamespaceSelector != new.WatchNamespaceSelector {
+		changed = append(changed, "watchNamespaceSelector")
+	}
+	if old.LoggingFormat != new.LoggingFormat {
+		changed = append(changed, "loggingFormat")
+	}
+	if old.OTLPEndpoint != new.OTLPEndpoint {
+		changed = append(changed, "otlpEndpoint")
+	}
+	if old.OTLPInsecure != new.OTLPInsecure {
+		changed = append(changed, "otlpInsecure")
+	}
+	if old.StartupTaint != new.StartupTaint {
+		changed = append(changed, "startupTaint")
+	}
+	if old.PullerBackend != new.PullerBackend {
+		changed = append(changed, "pullerBackend")
+	}
+	return changed
+}
+
+// Watch polls the configuration file at path every interval until stopCh is
+// closed and calls onChange with the new configuration whenever the file
+// content changes. Polling is used so that the atomic symlink swap of a
+// mounted ConfigMap is picked up. Invalid configurations are logged and ignored.
+func Watch(path string, base ControllerConfiguration, interval time.Duration,
+	stopCh <-chan struct{}, onChange func(*ControllerConfiguration)) {
+	last, err := os.ReadFile(path)
+	if err != nil {
+		klog.ErrorS(err, "Error reading configuration file", "path", path)
+	}
+	wait.Until(func() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			klog.ErrorS(err, "Error reading configuration file", "path", path)
+			return
+		}
+		if bytes.Equal(data, last) {
+			return
+		}
+		last = data
+		cfg, err := parse(data, base)
+		if err != nil {
+			klog.ErrorS(err, "Ignoring changed configuration file", "path", path)
+			return
+		}
+		klog.InfoS("Configuration file changed, reloading", "path", path)
+		onChange(cfg)
+	}, interval, stopCh)
+}
@@ -0,0 +1,204 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var base = ControllerConfiguration{
+	TypeMeta:                   metav1.TypeMeta{APIVersion: APIVersion, Kind: Kind},
+	Namespace:                  "kube-fledged",
+	ImageCacheRefreshFrequency: metav1.Duration{Duration: 15 * time.Minute},
+	ImagePullDeadlineDuration:  metav1.Duration{Duration: 5 * time.Minute},
+	ImagePullPolicy:            "IfNotPresent",
+	CRIClientImage:             "senthilrch/kubefledged-cri-client:latest",
+	BusyboxImage:               "senthilrch/busybox:1.35.0",
+	JobRetentionPolicy:         JobRetentionPolicyDelete,
+	PullerBackend:              PullerBackendJob,
+	LoggingFormat:              "text",
+	NodeEvents:                 NodeEventsAll,
+}
+
+func TestLoad(t *testing.T) {
+	overridden := base
+	overridden.ImagePullDeadlineDuration = metav1.Duration{Duration: 10 * time.Minute}
+	overridden.ImagePullPolicy = "Always"
+	overridden.JobRetentionPolicy = JobRetentionPolicyRetain
+	limited := base
+	limited.MaxConcurrentJobs = 20
+	limited.RegistryPullQPS = 0.5
+	limited.RegistryPullBurst = 5
+	limited.RegistryPullLimits = map[string]RegistryPullLimit{"docker.io": {QPS: 0.1, Burst: 2}}
+
+	tests := []struct {
+		name                string
+		content             string
+		expected            *ControllerConfiguration
+		expectedErrorString string
+	}{
+		{
+			name:     "#1 Successful - settings missing from the file keep the base value",
+			content:  "apiVersion: kubefledged.io/v1alpha1\nkind: ControllerConfiguration\n",
+			expected: &base,
+		},
+		{
+			name: "#2 Successful - settings in the file override the base value",
+			content: "apiVersion: kubefledged.io/v1alpha1\nkind: ControllerConfiguration\n" +
+				"imagePullDeadlineDuration: 10m\nimagePullPolicy: Always\njobRetentionPolicy: retain\n",
+			expected: &overridden,
+		},
+		{
+			name:                "#3 Unsuccessful - apiVersion missing",
+			content:             "kind: ControllerConfiguration\n",
+			expectedErrorString: "unsupported apiVersion",
+		},
+		{
+			name:                "#4 Unsuccessful - unknown field",
+			content:             "apiVersion: kubefledged.io/v1alpha1\nkind: ControllerConfiguration\nimagePullDeadline: 10m\n",
+			expectedErrorString: "unknown field",
+		},
+		{
+			name:                "#5 Unsuccessful - invalid imagePullPolicy",
+			content:             "apiVersion: kubefledged.io/v1alpha1\nkind: ControllerConfiguration\nimagePullPolicy: Never\n",
+			expectedErrorString: "unsupported imagePullPolicy",
+		},
+		{
+			name:                "#6 Unsuccessful - invalid duration",
+			content:             "apiVersion: kubefledged.io/v1alpha1\nkind: ControllerConfiguration\nimagePullDeadlineDuration: 0s\n",
+			expectedErrorString: "imagePullDeadlineDuration must be positive",
+		},
+		{
+			name:                "#7 Unsuccessful - invalid watchNamespaceSelector",
+			content:             "apiVersion: kubefledged.io/v1alpha1\nkind: ControllerConfiguration\nwatchNamespaceSelector: \"a b\"\n",
+			expectedErrorString: "invalid watchNamespaceSelector",
+		},
+		{
+			name:                "#8 Unsuccessful - invalid startupTaint",
+			content:             "apiVersion: kubefledged.io/v1alpha1\nkind: ControllerConfiguration\nstartupTaint: \"a b=c\"\nstartupTaintTimeout: 5m\n",
+			expectedErrorString: "invalid startupTaint key",
+		},
+		{
+			name:                "#9 Unsuccessful - startupTaint without timeout",
+			content:             "apiVersion: kubefledged.io/v1alpha1\nkind: ControllerConfiguration\nstartupTaint: kubefledged.io/warming\n",
+			expectedErrorString: "startupTaintTimeout must be positive",
+		},
+		{
+			name: "#10 Successful - registry pull limits",
+			content: "apiVersion: kubefledged.io/v1alpha1\nkind: ControllerConfiguration\nmaxConcurrentJobs: 20\n" +
+				"registryPullQPS: 0.5\nregistryPullBurst: 5\nregistryPullLimits:\n  docker.io:\n    qps: 0.1\n    burst: 2\n",
+			expected: &limited,
+		},
+		{
+			name:                "#11 Unsuccessful - registry pull limit without burst",
+			content:             "apiVersion: kubefledged.io/v1alpha1\nkind: ControllerConfiguration\nregistryPullLimits:\n  docker.io:\n    qps: 1\n",
+			expectedErrorString: "registryPullLimits[docker.io].Burst must be at least 1",
+		},
+		{
+			name:                "#12 Unsuccessful - invalid maintenance window",
+			content:             "apiVersion: kubefledged.io/v1alpha1\nkind: ControllerConfiguration\nmaintenanceWindows:\n- schedule: \"0 22 * *\"\n  duration: 8h\n",
+			expectedErrorString: "invalid maintenanceWindows",
+		},
+		{
+			name:                "#13 Unsuccessful - unsupported node events verbosity",
+			content:             "apiVersion: kubefledged.io/v1alpha1\nkind: ControllerConfiguration\nnodeEvents: warnings\n",
+			expectedErrorString: "unsupported nodeEvents",
+		},
+		{
+			name:                "#14 Unsuccessful - negative image cache run history limit",
+			content:             "apiVersion: kubefledged.io/v1alpha1\nkind: ControllerConfiguration\nimageCacheRunHistoryLimit: -1\n",
+			expectedErrorString: "imageCacheRunHistoryLimit must not be negative",
+		},
+		{
+			name:                "#15 Unsuccessful - unsupported notification sink type",
+			content:             "apiVersion: kubefledged.io/v1alpha1\nkind: ControllerConfiguration\nnotifications:\n- name: ops\n  type: email\n  url: https://example.com\n",
+			expectedErrorString: "invalid notifications",
+		},
+		{
+			name:                "#16 Unsuccessful - unsupported puller backend",
+			content:             "apiVersion: kubefledged.io/v1alpha1\nkind: ControllerConfiguration\npullerBackend: daemonset\n",
+			expectedErrorString: "unsupported pullerBackend",
+		},
+	}
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(test.content), 0644); err != nil {
+			t.Fatalf("%s: error writing config file: %v", test.name, err)
+		}
+		cfg, err := Load(path, base)
+		if test.expectedErrorString != "" {
+			if err == nil || !strings.Contains(err.Error(), test.expectedErrorString) {
+				t.Errorf("Test: %s failed: expectedError=%s, actualError=%v", test.name, test.expectedErrorString, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test: %s failed: err=%v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(cfg, test.expected) {
+			t.Errorf("Test: %s failed: expected=%+v, actual=%+v", test.name, test.expected, cfg)
+		}
+	}
+}
+
+func TestRestartRequired(t *testing.T) {
+	changed := base
+	changed.Namespace = "other"
+	changed.OTLPEndpoint = "collector:4317"
+	changed.ImagePullPolicy = "Always"
+	if actual := RestartRequired(&base, &changed); !reflect.DeepEqual(actual, []string{"namespace", "otlpEndpoint"}) {
+		t.Errorf("Test: RestartRequired failed: actual=%v", actual)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	header := "apiVersion: kubefledged.io/v1alpha1\nkind: ControllerConfiguration\n"
+	if err := os.WriteFile(path, []byte(header), 0644); err != nil {
+		t.Fatalf("error writing config file: %v", err)
+	}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	reloaded := make(chan *ControllerConfiguration, 1)
+	go Watch(path, base, 10*time.Millisecond, stopCh, func(cfg *ControllerConfiguration) { reloaded <- cfg })
+
+	// An invalid file is ignored, the following valid one is applied
+	time.Sleep(50 * time.Millisecond)
+	if err := os.WriteFile(path, []byte(header+"imagePullPolicy: Never\n"), 0644); err != nil {
+		t.Fatalf("error writing config file: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if err := os.WriteFile(path, []byte(header+"imagePullPolicy: Always\n"), 0644); err != nil {
+		t.Fatalf("error writing config file: %v", err)
+	}
+	select {
+	case cfg := <-reloaded:
+		if cfg.ImagePullPolicy != "Always" {
+			t.Errorf("Test: Watch failed: expected imagePullPolicy=Always, actual=%s", cfg.ImagePullPolicy)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Test: Watch failed: configuration not reloaded")
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"time"
+
+	fledgedv1alpha3 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	"k8s.io/apiserver/pkg/storage/names"
+	"k8s.io/klog/v2"
+)
+
+// cancelledSyncRetention is how long a cancelled sync action is remembered, so
+// that its requests still in the work queue are dropped
+const cancelledSyncRetention = time.Hour
+
+// cancelledSync is a sync action which has been cancelled
+type cancelledSync struct {
+	at time.Time
+	// done is set once the results of the sync action have been sent to the controller
+	done bool
+}
+
+// CancelSync cancels the sync action in progress. Its running jobs are deleted,
+// regardless of the job retention policy, and its requests which are queued or
+// wait for a retry or pin are reported as cancelled. Requests still in the
+// work queue are dropped when they come up. It returns the number of results
+// which were cancelled.
+func (m *ImageManager) CancelSync(syncID string) int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	now := time.Now()
+	for id, c := range m.cancelled {
+		if now.Sub(c.at) > cancelledSyncRetention {
+			delete(m.cancelled, id)
+		}
+	}
+	m.cancelled[syncID] = &cancelledSync{at: now}
+	cancelled := 0
+	s, ok := m.syncs[syncID]
+	if !ok {
+		return 0
+	}
+	for job := range s.jobs {
+		iwres := m.imageworkstatus[job]
+		switch iwres.Status {
+		case ImageWorkResultStatusJobCreated:
+			go m.removeJob(iwres.ImageWorkRequest.Imagecache.Namespace, job, iwres)
+			iwres.Message = fledgedv1alpha3.ImageCacheMessageJobCancelled
+		case ImageWorkResultStatusQueued, ImageWorkResultStatusRetryScheduled, ImageWorkResultStatusPinScheduled:
+			iwres.Message = fledgedv1alpha3.ImageCacheMessageRequestCancelled
+		default:
+			continue
+		}
+		klog.InfoS("Image work cancelled", append(iwres.ImageWorkRequest.logValues(), "job", job, "status", iwres.Status)...)
+		iwres.Status = ImageWorkResultStatusCancelled
+		iwres.Reason = fledgedv1alpha3.ImageCacheReasonImageCacheCancelled
+		iwres.NextRetryTime = nil
+		iwres.endSpan(nil)
+		m.setResult(job, iwres)
+		cancelled++
+	}
+	return cancelled
+}
+
+// dropCancelled reports whether the request belongs to a cancelled sync action.
+// A new request is recorded as cancelled until the results of the sync action
+// have been sent, a request superseding another one has been recorded already.
+func (m *ImageManager) dropCancelled(iwr ImageWorkRequest) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	c, ok := m.cancelled[iwr.SyncID]
+	if !ok {
+		return false
+	}
+	klog.InfoS("Request dropped, sync action cancelled", iwr.logValues()...)
+	if !c.done && iwr.Supersedes == "" {
+		m.recordResult(names.SimpleNameGenerator.GenerateName(fakeJobPrefix), ImageWorkResult{
+			ImageWorkRequest: iwr,
+			Status:           ImageWorkResultStatusCancelled,
+			Reason:           fledgedv1alpha3.ImageCacheReasonImageCacheCancelled,
+			Message:          fledgedv1alpha3.ImageCacheMessageRequestCancelled,
+		})
+	}
+	return true
+}
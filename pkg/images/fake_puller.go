@@ -0,0 +1,149 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// FakeImagePuller is an image puller which does no work on the nodes. It
+// records the work it is asked to do, which is finished with Succeed and Fail
+// instead of simulating jobs and pods. It is passed to NewImageManager.
+type FakeImagePuller struct {
+	m         *ImageManager
+	lock      sync.Mutex
+	pulls     []string
+	removes   []string
+	cleanups  []string
+	pullErr   error
+	status    *ImageWorkResult
+	statusErr error
+}
+
+// NewFakeImagePuller returns a fake image puller
+func NewFakeImagePuller() *FakeImagePuller {
+	return &FakeImagePuller{}
+}
+
+// bind implements imageManagerBinder
+func (p *FakeImagePuller) bind(m *ImageManager) {
+	p.m = m
+}
+
+// Pull records the pull and returns its name, fakepull-<n>
+func (p *FakeImagePuller) Pull(ctx context.Context, iwr ImageWorkRequest) (string, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.pullErr != nil {
+		return "", p.pullErr
+	}
+	name := fmt.Sprintf("fakepull-%d", len(p.pulls))
+	p.pulls = append(p.pulls, name)
+	return name, nil
+}
+
+// Remove records the removal and returns its name, fakeremove-<n>
+func (p *FakeImagePuller) Remove(ctx context.Context, iwr ImageWorkRequest) (string, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	name := fmt.Sprintf("fakeremove-%d", len(p.removes))
+	p.removes = append(p.removes, name)
+	return name, nil
+}
+
+// Status returns the result set with SetStatus, Unknown if none was set
+func (p *FakeImagePuller) Status(name string, iwres ImageWorkResult) (ImageWorkResult, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.statusErr != nil {
+		return iwres, p.statusErr
+	}
+	iwres.Status = ImageWorkResultStatusUnknown
+	if p.status != nil {
+		iwres.Status, iwres.Reason, iwres.Message = p.status.Status, p.status.Reason, p.status.Message
+	}
+	return iwres, nil
+}
+
+// Cleanup records the name of the work
+func (p *FakeImagePuller) Cleanup(namespace, name string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.cleanups = append(p.cleanups, name)
+}
+
+// Succeed records the work as succeeded
+func (p *FakeImagePuller) Succeed(name string) {
+	if iwres, ok := p.m.runningWork(p, name); ok {
+		iwres.Status = ImageWorkResultStatusSucceeded
+		p.m.finishJob(name, iwres, nil)
+	}
+}
+
+// Fail records the work as failed
+func (p *FakeImagePuller) Fail(name, reason, message string) {
+	if iwres, ok := p.m.runningWork(p, name); ok {
+		iwres.Status = ImageWorkResultStatusFailed
+		iwres.Reason, iwres.Message = reason, message
+		p.m.finishJob(name, iwres, nil)
+	}
+}
+
+// SetPullError makes Pull return err, none if err is nil
+func (p *FakeImagePuller) SetPullError(err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.pullErr = err
+}
+
+// SetStatus sets the result Status returns for work which did not finish
+// before the deadline of its sync action
+func (p *FakeImagePuller) SetStatus(status, reason, message string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.status = &ImageWorkResult{Status: status, Reason: reason, Message: message}
+}
+
+// SetStatusError makes Status return err, none if err is nil
+func (p *FakeImagePuller) SetStatusError(err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.statusErr = err
+}
+
+// Pulls returns the names of the pulls started so far
+func (p *FakeImagePuller) Pulls() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]string(nil), p.pulls...)
+}
+
+// Removes returns the names of the removals started so far
+func (p *FakeImagePuller) Removes() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]string(nil), p.removes...)
+}
+
+// Cleanups returns the names of the work cleaned up so far
+func (p *FakeImagePuller) Cleanups() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]string(nil), p.cleanups...)
+}
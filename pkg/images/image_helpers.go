@@ -22,32 +22,24 @@ import (
 	"strings"
 	"time"
 
-	"github.com/golang/glog"
 	fledgedv1alpha3 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha3"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog/v2"
 )
 
 // newImagePullJob constructs a job manifest for pulling an image to a node
 func newImagePullJob(imagecache *fledgedv1alpha3.ImageCache, image string,
 	forceFullCache bool, node *corev1.Node, imagePullPolicy string,
 	busyboxImage string, serviceAccountName string, jobPriorityClassName string) (*batchv1.Job, error) {
-	var pullPolicy corev1.PullPolicy = corev1.PullIfNotPresent
-	hostname := node.Labels["kubernetes.io/hostname"]
+	hostname := NodeHostname(node)
 	if imagecache == nil {
-		glog.Error("imagecache pointer is nil")
+		klog.ErrorS(nil, "imagecache pointer is nil", "image", image)
 		return nil, fmt.Errorf("imagecache pointer is nil")
 	}
-	if imagePullPolicy == string(corev1.PullAlways) {
-		pullPolicy = corev1.PullAlways
-	} else if imagePullPolicy == string(corev1.PullIfNotPresent) {
-		pullPolicy = corev1.PullIfNotPresent
-		if latestimage := strings.Contains(image, ":latest") || !strings.Contains(image, ":"); latestimage {
-			pullPolicy = corev1.PullAlways
-		}
-	}
+	pullPolicy := pullPolicy(imagePullPolicy, image)
 
 	labels := map[string]string{
 		"app":         "kubefledged",
@@ -76,14 +68,26 @@ func newImagePullJob(imagecache *fledgedv1alpha3.ImageCache, image string,
 	return job, nil
 }
 
+// pullPolicy returns the pull policy of an image, images with no or ':latest'
+// tag are always pulled
+func pullPolicy(imagePullPolicy string, image string) corev1.PullPolicy {
+	if imagePullPolicy == string(corev1.PullAlways) {
+		return corev1.PullAlways
+	}
+	if latestimage := strings.Contains(image, ":latest") || !strings.Contains(image, ":"); latestimage {
+		return corev1.PullAlways
+	}
+	return corev1.PullIfNotPresent
+}
+
 // newImageDeleteJob constructs a job manifest to delete an image from a node
 func newImageDeleteJob(imagecache *fledgedv1alpha3.ImageCache, image string, node *corev1.Node,
 	containerRuntimeVersion string, dockerclientimage string, serviceAccountName string,
 	imageDeleteJobHostNetwork bool, jobPriorityClassName string, criSocketPath string) (*batchv1.Job, error) {
-	hostname := node.Labels["kubernetes.io/hostname"]
+	hostname := NodeHostname(node)
 	socketPath := criSocketPath
 	if imagecache == nil {
-		glog.Error("imagecache pointer is nil")
+		klog.ErrorS(nil, "imagecache pointer is nil", "image", image)
 		return nil, fmt.Errorf("imagecache pointer is nil")
 	}
 
@@ -96,7 +100,7 @@ func newImageDeleteJob(imagecache *fledgedv1alpha3.ImageCache, image string, nod
 
 	hostpathtype := corev1.HostPathSocket
 	backoffLimit := int32(0)
-	activeDeadlineSeconds := int64((time.Hour).Seconds())
+	activeDeadlineSeconds := jobActiveDeadlineSeconds(imagecache, image)
 
 	job := &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
@@ -165,7 +169,9 @@ func newImageDeleteJob(imagecache *fledgedv1alpha3.ImageCache, image string, nod
 		if criSocketPath == "" {
 			socketPath = "/run/containerd/containerd.sock"
 		}
-		deleteCommand := "exec /usr/bin/crictl --runtime-endpoint=unix://" + socketPath + " --image-endpoint=unix://" + socketPath + " rmi " + image + " > /dev/termination-log 2>&1"
+		// A pinned image is unpinned first. Failures are ignored, since the image may never have been pinned.
+		deleteCommand := ctrImageLabelCommand(socketPath, image, containerdPinnedLabel+"=") + " > /dev/null 2>&1; " +
+			"exec /usr/bin/crictl --runtime-endpoint=unix://" + socketPath + " --image-endpoint=unix://" + socketPath + " rmi " + image + " > /dev/termination-log 2>&1"
 		job.Spec.Template.Spec.Containers[0].Args = []string{"-c", deleteCommand}
 		job.Spec.Template.Spec.Containers[0].VolumeMounts[0].MountPath = socketPath
 		job.Spec.Template.Spec.Volumes[0].VolumeSource.HostPath.Path = socketPath
@@ -195,6 +201,125 @@ func newImageDeleteJob(imagecache *fledgedv1alpha3.ImageCache, image string, nod
 	return job, nil
 }
 
+// containerdPinnedLabel is the image label which excludes an image from
+// image garbage collection of kubelet on nodes running containerd
+const containerdPinnedLabel = "io.cri-containerd.pinned"
+
+// newImagePinJob constructs a job manifest to pin an image on a node running
+// containerd. It runs the cri client image the same way as image delete jobs.
+func newImagePinJob(imagecache *fledgedv1alpha3.ImageCache, image string, node *corev1.Node,
+	criClientImage string, serviceAccountName string, hostNetwork bool, jobPriorityClassName string,
+	criSocketPath string) (*batchv1.Job, error) {
+	socketPath := criSocketPath
+	if socketPath == "" {
+		socketPath = "/run/containerd/containerd.sock"
+	}
+	job, err := newImageDeleteJob(imagecache, image, node, "containerd", criClientImage, serviceAccountName,
+		hostNetwork, jobPriorityClassName, socketPath)
+	if err != nil {
+		return nil, err
+	}
+	pinCommand := "exec " + ctrImageLabelCommand(socketPath, image, containerdPinnedLabel+"=pinned") + " > /dev/termination-log 2>&1"
+	job.Spec.Template.Spec.Containers[0].Args = []string{"-c", pinCommand}
+	return job, nil
+}
+
+// ctrImageLabelCommand returns the command setting a label of the image in
+// the namespace of the containerd cri plugin. An empty value removes the label.
+func ctrImageLabelCommand(socketPath, image, label string) string {
+	name, tag, digest := NormalizeImageName(image)
+	ref := name + tag + digest
+	if tag != "" && digest != "" {
+		// containerd stores the tag and the digest as separate references
+		ref = name + tag
+	}
+	return "/usr/bin/ctr --address " + socketPath + " --namespace k8s.io images label " + ref + " " + label
+}
+
+const (
+	defaultRetryInitialBackoff = 10 * time.Second
+	defaultRetryMaxBackoff     = 5 * time.Minute
+)
+
+// retryBackoff returns the delay before retrying a pull which failed in the given
+// attempt. The delay doubles with every attempt up to the maximum backoff.
+func retryBackoff(policy *fledgedv1alpha3.RetryPolicy, attempt int32) time.Duration {
+	backoff, maxBackoff := defaultRetryInitialBackoff, defaultRetryMaxBackoff
+	if policy.InitialBackoff != nil {
+		backoff = policy.InitialBackoff.Duration
+	}
+	if policy.MaxBackoff != nil {
+		maxBackoff = policy.MaxBackoff.Duration
+	}
+	for i := int32(1); i < attempt && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
+
+// syncTimeout returns how long a sync action waits for its jobs. With a retry
+// policy every attempt gets the full pull deadline, plus the backoffs in between.
+func syncTimeout(pullDeadline time.Duration, policy *fledgedv1alpha3.RetryPolicy) time.Duration {
+	if policy == nil || policy.MaxAttempts <= 1 {
+		return pullDeadline
+	}
+	timeout := pullDeadline
+	for attempt := int32(1); attempt < policy.MaxAttempts; attempt++ {
+		timeout += retryBackoff(policy, attempt) + pullDeadline
+	}
+	return timeout
+}
+
+// imagePullDeadline returns the pull deadline of an image of the image cache,
+// which is the deadline of the image if set, else that of the image cache. It
+// returns nil if neither is set.
+func imagePullDeadline(imagecache *fledgedv1alpha3.ImageCache, image string) *metav1.Duration {
+	for _, i := range imagecache.Spec.CacheSpec {
+		for _, img := range i.Images {
+			if img.Name == image && img.PullDeadline != nil {
+				return img.PullDeadline
+			}
+		}
+	}
+	return imagecache.Spec.PullDeadline
+}
+
+// jobActiveDeadlineSeconds returns the active deadline of the jobs of an image,
+// one hour unless the image cache sets a pull deadline
+func jobActiveDeadlineSeconds(imagecache *fledgedv1alpha3.ImageCache, image string) int64 {
+	if d := imagePullDeadline(imagecache, image); d != nil && d.Duration >= time.Second {
+		return int64(d.Duration.Seconds())
+	}
+	return int64((time.Hour).Seconds())
+}
+
+// syncPullDeadline returns the longest pull deadline of the images of the
+// image cache. Images without a pull deadline get the default deadline.
+func syncPullDeadline(imagecache *fledgedv1alpha3.ImageCache, defaultDeadline time.Duration) time.Duration {
+	deadline := defaultDeadline
+	if imagecache.Spec.PullDeadline != nil {
+		deadline = imagecache.Spec.PullDeadline.Duration
+	}
+	longest := deadline
+	for _, i := range imagecache.Spec.CacheSpec {
+		for _, img := range i.Images {
+			if img.PullDeadline != nil && img.PullDeadline.Duration > longest {
+				longest = img.PullDeadline.Duration
+			}
+		}
+	}
+	return longest
+}
+
+// NodeHostname returns the hostname label of the node, which is used to pin
+// jobs to the node and to identify the node in logs and status
+func NodeHostname(node *corev1.Node) string {
+	return node.Labels["kubernetes.io/hostname"]
+}
+
 func checkIfImageNeedsToBePulled(imagePullPolicy string, image string, node *corev1.Node) (bool, error) {
 	if imagePullPolicy == string(corev1.PullIfNotPresent) {
 		if !strings.Contains(image, ":") && !strings.Contains(image, "@sha") {
@@ -224,3 +349,25 @@ func imageAlreadyPresentInNode(image string, node *corev1.Node) (bool, error) {
 	}
 	return false, nil
 }
+
+// NormalizeImageName splits an image reference into its fully qualified
+// repository, ":tag" and "@digest". A reference without tag and digest gets
+// the tag ":latest".
+func NormalizeImageName(image string) (name, tag, digest string) {
+	name = image
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, digest = name[:i], name[i:]
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, tag = name[:i], name[i:]
+	}
+	if i := strings.Index(name, "/"); i < 0 {
+		name = "docker.io/library/" + name
+	} else if domain := name[:i]; !strings.ContainsAny(domain, ".:") && domain != "localhost" {
+		name = "docker.io/" + name
+	}
+	if tag == "" && digest == "" {
+		tag = ":latest"
+	}
+	return name, tag, digest
+}
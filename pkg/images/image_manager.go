@@ -23,12 +23,15 @@ import (
 	"sync"
 	"time"
 
-	"github.com/golang/glog"
 	fledgedv1alpha3 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha3"
-	batchv1 "k8s.io/api/batch/v1"
+	clientset "github.com/senthilrch/kube-fledged/pkg/client/clientset/versioned"
+	"github.com/senthilrch/kube-fledged/pkg/config"
+	"github.com/senthilrch/kube-fledged/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/selection"
 	"k8s.io/apimachinery/pkg/util/runtime"
@@ -40,6 +43,7 @@ import (
 	corelisters "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
 )
 
 const controllerAgentName = "fledged"
@@ -56,28 +60,47 @@ const (
 	ImageWorkResultStatusAlreadyPulled = "alreadypulled"
 	//ImageWorkResultStatusUnknown  means status of image pull/delete unknown
 	ImageWorkResultStatusUnknown = "unknown"
+	// ImageWorkResultStatusRetryScheduled means image pull failed and will be retried
+	ImageWorkResultStatusRetryScheduled = "retryscheduled"
+	// ImageWorkResultStatusPinScheduled means image pull succeeded and the image will be pinned
+	ImageWorkResultStatusPinScheduled = "pinscheduled"
+	// ImageWorkResultStatusPlanned means image pull/delete is planned, no job is created
+	ImageWorkResultStatusPlanned = "planned"
+	// ImageWorkResultStatusCancelled means the sync action was cancelled before the job finished
+	ImageWorkResultStatusCancelled = "cancelled"
+	// ImageWorkResultStatusQueued means the job waits for the job concurrency or registry pull rate
+	// limits, or for the next maintenance window
+	ImageWorkResultStatusQueued = "queued"
 )
 
 // ImageManager provides the functionalities for pulling and deleting images
 type ImageManager struct {
-	fledgedNameSpace          string
-	workqueue                 workqueue.RateLimitingInterface
-	imageworkqueue            workqueue.RateLimitingInterface
-	kubeclientset             kubernetes.Interface
-	imageworkstatus           map[string]ImageWorkResult
-	kubeInformerFactory       kubeinformers.SharedInformerFactory
-	podsLister                corelisters.PodLister
-	podsSynced                cache.InformerSynced
-	imagePullDeadlineDuration time.Duration
-	criClientImage            string
-	busyboxImage              string
-	imagePullPolicy           string
-	serviceAccountName        string
-	imageDeleteJobHostNetwork bool
-	jobPriorityClassName      string
-	canDeleteJob              bool
-	criSocketPath             string
-	lock                      sync.RWMutex
+	fledgedNameSpace    string
+	workqueue           workqueue.RateLimitingInterface
+	imageworkqueue      workqueue.RateLimitingInterface
+	kubeclientset       kubernetes.Interface
+	fledgedclientset    clientset.Interface
+	imageworkstatus     map[string]ImageWorkResult
+	kubeInformerFactory kubeinformers.SharedInformerFactory
+	podsLister          corelisters.PodLister
+	podsSynced          cache.InformerSynced
+	jobsSynced          cache.InformerSynced
+	lock                sync.RWMutex
+	// puller carries out the image pulls and deletes, except for those which
+	// need the job puller
+	puller ImagePuller
+	jobs   *jobPuller
+	// cfg holds the reloadable settings, guarded by cfgLock
+	cfg     config.ControllerConfiguration
+	cfgLock sync.RWMutex
+	// pullLimiter limits the rate of image pulls per registry
+	pullLimiter *pullLimiter
+	// cancelled holds the cancelled sync actions by sync id, guarded by lock
+	cancelled map[string]*cancelledSync
+	// syncs tracks the results of the sync actions by sync id, guarded by lock
+	syncs map[string]*syncState
+	// running is the number of jobs created which have not finished, guarded by lock
+	running int
 }
 
 // ImageWorkRequest has image name, node name, work type and imagecache
@@ -88,6 +111,29 @@ type ImageWorkRequest struct {
 	ContainerRuntimeVersion string
 	WorkType                WorkType
 	Imagecache              *fledgedv1alpha3.ImageCache
+	// SyncID identifies the sync action of the image cache that placed this request
+	SyncID string
+	// TraceParent carries the span context of the sync action
+	TraceParent string
+	// Retry is the number of times a failed pull has been retried, 0 for the first attempt
+	Retry int32
+	// Supersedes is the job whose result is replaced by this request, i.e. the
+	// failed attempt which is retried or the pull of the image which is pinned
+	Supersedes string
+	// Pin requests pinning the image on the node instead of pulling it
+	Pin bool
+	// Plan requests recording what would be done, without creating a job
+	Plan bool
+	// Urgent requests are not deferred to the next maintenance window
+	Urgent bool
+	// Requests is the number of requests placed by the sync action, set on the
+	// empty request which signals that all of them have been placed
+	Requests int
+}
+
+// Attempts returns the number of the pull attempt made by this request, starting at 1
+func (iwr ImageWorkRequest) Attempts() int32 {
+	return iwr.Retry + 1
 }
 
 // ImageWorkResult stores the result of pulling and deleting image
@@ -96,6 +142,12 @@ type ImageWorkResult struct {
 	Status           string
 	Reason           string
 	Message          string
+	// NextRetryTime is set when the failed pull has been scheduled for retry
+	NextRetryTime *metav1.Time
+	// span covers the lifetime of the job created for the request
+	span trace.Span
+	// puller carries out the request, nil for the job puller
+	puller ImagePuller
 }
 
 // WorkType refers to type of work to be done by sync handler
@@ -109,6 +161,24 @@ const (
 	ImageCacheStatusUpdate WorkType = "statusupdate"
 	ImageCacheRefresh      WorkType = "refresh"
 	ImageCachePurge        WorkType = "purge"
+	// ImageCacheRetryStatusUpdate reports a scheduled retry while the sync action is in progress
+	ImageCacheRetryStatusUpdate WorkType = "retrystatusupdate"
+	// NodeWarmup pulls the images of all image caches to a node which became ready
+	NodeWarmup WorkType = "nodewarmup"
+	// NodeWarmupStatusUpdate reports the results of warming up a node for one image cache
+	NodeWarmupStatusUpdate WorkType = "nodewarmupstatusupdate"
+	// NodeDriftCheck looks for cached images which went missing from a node
+	NodeDriftCheck WorkType = "nodedriftcheck"
+	// NodeStartupTaintTimeout removes the startup taint from a node which did not get warm in time
+	NodeStartupTaintTimeout WorkType = "nodestartuptainttimeout"
+	// ImageCachePlanStatusUpdate reports the planned image work of a sync action
+	ImageCachePlanStatusUpdate WorkType = "planstatusupdate"
+	// ImageCacheProgressStatusUpdate reports the results of the sync action in progress so far
+	ImageCacheProgressStatusUpdate WorkType = "progressstatusupdate"
+	// ImageCacheCancel cancels the sync action of the image cache in progress
+	ImageCacheCancel WorkType = "cancel"
+	// ImageCachePendingUpdate defers a spec change made while the image cache is under processing
+	ImageCachePendingUpdate WorkType = "pendingupdate"
 )
 
 // WorkQueueKey is an item in the sync handler's work queue
@@ -117,20 +187,21 @@ type WorkQueueKey struct {
 	ObjKey        string
 	Status        *map[string]ImageWorkResult
 	OldImageCache *fledgedv1alpha3.ImageCache
+	SyncID        string
+	TraceParent   string
+	// Deferred marks a sync which waited for a maintenance window to open
+	Deferred bool
 }
 
-// NewImageManager returns a new image manager object
+// NewImageManager returns a new image manager object. puller replaces the
+// image puller selected by the puller backend setting, unless it is nil.
 func NewImageManager(
 	workqueue workqueue.RateLimitingInterface,
 	imageworkqueue workqueue.RateLimitingInterface,
 	kubeclientset kubernetes.Interface,
-	namespace string,
-	imagePullDeadlineDuration time.Duration,
-	criClientImage, busyboxImage, imagePullPolicy, serviceAccountName string,
-	imageDeleteJobHostNetwork bool,
-	jobPriorityClassName string,
-	canDeleteJob bool,
-	criSocketPath string) (*ImageManager, coreinformers.PodInformer) {
+	fledgedclientset clientset.Interface,
+	cfg *config.ControllerConfiguration,
+	puller ImagePuller) (*ImageManager, coreinformers.PodInformer) {
 
 	appEqKubefledged, _ := labels.NewRequirement("app", selection.Equals, []string{"kubefledged"})
 	kubefledgedEqImagemanager, _ := labels.NewRequirement("kubefledged", selection.Equals, []string{"kubefledged-image-manager"})
@@ -140,258 +211,375 @@ func NewImageManager(
 	kubeInformerFactory := kubeinformers.NewSharedInformerFactoryWithOptions(
 		kubeclientset,
 		time.Second*30,
+		kubeinformers.WithNamespace(cfg.SingleWatchNamespace()),
 		kubeinformers.WithTweakListOptions(func(options *metav1.ListOptions) {
 			options.LabelSelector = labelSelector.String()
 		}))
 	podInformer := kubeInformerFactory.Core().V1().Pods()
+	jobInformer := kubeInformerFactory.Batch().V1().Jobs()
 
 	imagemanager := &ImageManager{
-		fledgedNameSpace:          namespace,
-		workqueue:                 workqueue,
-		imageworkqueue:            imageworkqueue,
-		kubeclientset:             kubeclientset,
-		imageworkstatus:           make(map[string]ImageWorkResult),
-		kubeInformerFactory:       kubeInformerFactory,
-		podsLister:                podInformer.Lister(),
-		podsSynced:                podInformer.Informer().HasSynced,
-		imagePullDeadlineDuration: imagePullDeadlineDuration,
-		criClientImage:            criClientImage,
-		busyboxImage:              busyboxImage,
-		imagePullPolicy:           imagePullPolicy,
-		serviceAccountName:        serviceAccountName,
-		imageDeleteJobHostNetwork: imageDeleteJobHostNetwork,
-		jobPriorityClassName:      jobPriorityClassName,
-		canDeleteJob:              canDeleteJob,
-		criSocketPath:             criSocketPath,
-	}
-	podInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-		//AddFunc: ,
-		UpdateFunc: func(old, new interface{}) {
-			newPod := new.(*corev1.Pod)
-			oldPod := old.(*corev1.Pod)
-			if newPod.ResourceVersion == oldPod.ResourceVersion {
-				// Periodic resync will send update events for all known Pods.
-				// Two different versions of the same Pod will always have different RVs.
-				return
-			}
-			glog.V(4).Infof("Pod %s changed status to %s", newPod.Name, newPod.Status.Phase)
-			if (newPod.Status.Phase == corev1.PodSucceeded || newPod.Status.Phase == corev1.PodFailed) &&
-				(oldPod.Status.Phase != corev1.PodSucceeded && oldPod.Status.Phase != corev1.PodFailed) {
-				imagemanager.handlePodStatusChange(newPod)
-			}
-		},
-		//DeleteFunc: ,
-	})
+		fledgedNameSpace:    cfg.Namespace,
+		workqueue:           workqueue,
+		imageworkqueue:      imageworkqueue,
+		kubeclientset:       kubeclientset,
+		fledgedclientset:    fledgedclientset,
+		imageworkstatus:     make(map[string]ImageWorkResult),
+		kubeInformerFactory: kubeInformerFactory,
+		podsLister:          podInformer.Lister(),
+		podsSynced:          podInformer.Informer().HasSynced,
+		jobsSynced:          jobInformer.Informer().HasSynced,
+		cfg:                 *cfg,
+		pullLimiter:         newPullLimiter(),
+		cancelled:           map[string]*cancelledSync{},
+		syncs:               map[string]*syncState{},
+	}
+	imagemanager.jobs = newJobPuller(imagemanager, jobInformer)
+	imagemanager.puller = imagemanager.jobs
+	if cfg.PullerBackend == config.PullerBackendAgent {
+		imagemanager.puller = newAgentPuller(imagemanager, cfg, labelSelector)
+	}
+	if puller != nil {
+		if b, ok := puller.(imageManagerBinder); ok {
+			b.bind(imagemanager)
+		}
+		imagemanager.puller = puller
+	}
 	return imagemanager, podInformer
 }
 
-func (m *ImageManager) handlePodStatusChange(pod *corev1.Pod) {
-	glog.V(4).Infof("Pod %s changed status to %s", pod.Name, pod.Status.Phase)
-	m.lock.RLock()
-	iwres, ok := m.imageworkstatus[pod.Labels["job-name"]]
-	m.lock.RUnlock()
-	// Corresponding job might have expired and got deleted.
-	// ignore pod status change for such jobs
-	if !ok {
+// UpdateConfiguration replaces the settings used for jobs created from now on
+func (m *ImageManager) UpdateConfiguration(cfg *config.ControllerConfiguration) {
+	m.cfgLock.Lock()
+	defer m.cfgLock.Unlock()
+	m.cfg = *cfg
+}
+
+// settings returns a snapshot of the current settings
+func (m *ImageManager) settings() config.ControllerConfiguration {
+	m.cfgLock.RLock()
+	defer m.cfgLock.RUnlock()
+	return m.cfg
+}
+
+// finishJob records the result of a finished job and schedules the retry or pin
+// which follows it
+func (m *ImageManager) finishJob(job string, iwres ImageWorkResult, pod *corev1.Pod) {
+	retry, backoff, ok := nextRetry(job, &iwres)
+	pin, pinOk := nextPin(job, &iwres)
+	iwres.endSpan(pod)
+	m.lock.Lock()
+	// The results of the sync action might have been sent in the meantime
+	if _, ok := m.imageworkstatus[job]; ok {
+		m.setResult(job, iwres)
+	}
+	m.lock.Unlock()
+	if ok {
+		klog.InfoS("Image pull retry scheduled", append(iwres.ImageWorkRequest.logValues(), "job", job,
+			"attempt", iwres.ImageWorkRequest.Attempts(), "backoff", backoff)...)
+		m.imageworkqueue.AddAfter(retry, backoff)
+		m.reportRetryScheduled(job, iwres)
+	}
+	if pinOk {
+		klog.InfoS("Image pin scheduled", append(iwres.ImageWorkRequest.logValues(), "job", job)...)
+		m.imageworkqueue.Add(pin)
+	}
+}
+
+// nextRetry marks a failed pull for retry if the retry policy of the image
+// cache allows another attempt. It returns the request for the next attempt
+// and the backoff after which it should be placed.
+func nextRetry(job string, iwres *ImageWorkResult) (ImageWorkRequest, time.Duration, bool) {
+	iwr := iwres.ImageWorkRequest
+	if iwres.Status != ImageWorkResultStatusFailed || iwr.WorkType == ImageCachePurge || iwr.Imagecache == nil {
+		return ImageWorkRequest{}, 0, false
+	}
+	policy := iwr.Imagecache.Spec.RetryPolicy
+	if policy == nil || iwr.Attempts() >= policy.MaxAttempts {
+		return ImageWorkRequest{}, 0, false
+	}
+	backoff := retryBackoff(policy, iwr.Attempts())
+	nextRetryTime := metav1.NewTime(time.Now().Add(backoff))
+	iwres.Status = ImageWorkResultStatusRetryScheduled
+	iwres.NextRetryTime = &nextRetryTime
+	retry := iwr
+	retry.Retry++
+	retry.Supersedes = job
+	return retry, backoff, true
+}
+
+// pinSupported reports whether the image of a pull request should be pinned
+// and can be, which is the case on nodes running containerd. The cri-client
+// image ships no ctr for 32-bit arm, so images are not pinned on arm nodes.
+func pinSupported(iwr ImageWorkRequest) bool {
+	if iwr.Imagecache == nil || !iwr.Imagecache.Spec.PinImages || iwr.WorkType == ImageCachePurge {
+		return false
+	}
+	if !strings.Contains(iwr.ContainerRuntimeVersion, "containerd") {
+		klog.InfoS("Image not pinned, container runtime does not support pinning", append(iwr.logValues(),
+			"runtime", iwr.ContainerRuntimeVersion)...)
+		return false
+	}
+	if iwr.Node != nil && iwr.Node.Status.NodeInfo.Architecture == "arm" {
+		klog.InfoS("Image not pinned, pinning is not supported on the node architecture", append(iwr.logValues(),
+			"architecture", iwr.Node.Status.NodeInfo.Architecture)...)
+		return false
+	}
+	return true
+}
+
+// nextPin marks a successful pull for pinning if the image cache requests it.
+// It returns the request for pinning the image.
+func nextPin(job string, iwres *ImageWorkResult) (ImageWorkRequest, bool) {
+	iwr := iwres.ImageWorkRequest
+	if iwres.Status != ImageWorkResultStatusSucceeded || iwr.Pin || !pinSupported(iwr) {
+		return ImageWorkRequest{}, false
+	}
+	iwres.Status = ImageWorkResultStatusPinScheduled
+	pin := iwr
+	pin.Pin = true
+	pin.Retry = 0
+	pin.Supersedes = job
+	return pin, true
+}
+
+// reportRetryScheduled lets the controller show the scheduled retry in the
+// image cache status while the sync action is still in progress
+func (m *ImageManager) reportRetryScheduled(job string, iwres ImageWorkResult) {
+	if iwres.ImageWorkRequest.WorkType == NodeWarmup {
+		// Warm-ups do not show in the image cache status
+		return
+	}
+	objKey, err := cache.MetaNamespaceKeyFunc(iwres.ImageWorkRequest.Imagecache)
+	if err != nil {
+		klog.ErrorS(err, "Error getting key of image cache", "imagecache", klog.KObj(iwres.ImageWorkRequest.Imagecache))
 		return
 	}
+	m.workqueue.AddRateLimited(WorkQueueKey{
+		WorkType:    ImageCacheRetryStatusUpdate,
+		Status:      &map[string]ImageWorkResult{job: iwres},
+		ObjKey:      objKey,
+		SyncID:      iwres.ImageWorkRequest.SyncID,
+		TraceParent: iwres.ImageWorkRequest.TraceParent,
+	})
+}
 
-	if pod.Status.Phase == corev1.PodSucceeded {
-		iwres.Status = ImageWorkResultStatusSucceeded
-		if iwres.ImageWorkRequest.WorkType == ImageCachePurge {
-			glog.Infof("Job %s succeeded (delete:- %s --> %s, runtime: %s)", pod.Labels["job-name"], iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"], iwres.ImageWorkRequest.ContainerRuntimeVersion)
-		} else {
-			glog.Infof("Job %s succeeded (pull:- %s --> %s, runtime: %s)", pod.Labels["job-name"], iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"], iwres.ImageWorkRequest.ContainerRuntimeVersion)
-		}
+// reportProgress lets the controller show the number of queued requests and
+// finished jobs in the image cache status while the sync action is still in progress
+func (m *ImageManager) reportProgress(sentinel ImageWorkRequest, results map[string]ImageWorkResult) {
+	if sentinel.WorkType == NodeWarmup || sentinel.Plan {
+		// Warm-ups do not show in the image cache status, plans create no jobs
+		return
+	}
+	objKey, err := cache.MetaNamespaceKeyFunc(sentinel.Imagecache)
+	if err != nil {
+		klog.ErrorS(err, "Error getting key of image cache", "imagecache", klog.KObj(sentinel.Imagecache))
+		return
+	}
+	m.workqueue.AddRateLimited(WorkQueueKey{
+		WorkType:    ImageCacheProgressStatusUpdate,
+		Status:      &results,
+		ObjKey:      objKey,
+		SyncID:      sentinel.SyncID,
+		TraceParent: sentinel.TraceParent,
+	})
+}
+
+// deleteJob deletes what was created for finished work, unless jobs are retained
+func (m *ImageManager) deleteJob(namespace, job string, iwres ImageWorkResult) {
+	if !m.settings().CanDeleteJob() {
+		return
+	}
+	m.removeJob(namespace, job, iwres)
+}
+
+// removeJob deletes what was created for the work, e.g. the job and its pod
+func (m *ImageManager) removeJob(namespace, job string, iwres ImageWorkResult) {
+	if strings.HasPrefix(job, fakeJobPrefix) {
+		return
+	}
+	m.pullerOf(iwres).Cleanup(namespace, job)
+}
+
+// logValues returns the key/value pairs identifying the request in structured logs
+func (iwr ImageWorkRequest) logValues() []interface{} {
+	kv := []interface{}{"workType", iwr.WorkType}
+	if iwr.Imagecache != nil {
+		kv = append(kv, "imagecache", iwr.Imagecache.Name, "namespace", iwr.Imagecache.Namespace)
+	}
+	if iwr.Node != nil {
+		kv = append(kv, "node", NodeHostname(iwr.Node))
+	}
+	if iwr.Image != "" {
+		kv = append(kv, "image", iwr.Image)
+	}
+	return kv
+}
+
+// spanAttributes returns the span attributes identifying the request
+func (iwr ImageWorkRequest) spanAttributes() []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		tracing.AttrSyncID.String(iwr.SyncID),
+		tracing.AttrWorkType.String(string(iwr.WorkType)),
 	}
-	if pod.Status.Phase == corev1.PodFailed {
-		iwres.Status = ImageWorkResultStatusFailed
-		if len(pod.Status.ContainerStatuses) == 1 {
-			if pod.Status.ContainerStatuses[0].State.Terminated != nil {
-				iwres.Reason = pod.Status.ContainerStatuses[0].State.Terminated.Reason
-				iwres.Message = pod.Status.ContainerStatuses[0].State.Terminated.Message
+	if iwr.Imagecache != nil {
+		attrs = append(attrs, tracing.AttrImageCache.String(iwr.Imagecache.Name),
+			tracing.AttrNamespace.String(iwr.Imagecache.Namespace))
+	}
+	if iwr.Node != nil {
+		attrs = append(attrs, tracing.AttrNode.String(NodeHostname(iwr.Node)))
+	}
+	if iwr.Image != "" {
+		attrs = append(attrs, tracing.AttrImage.String(iwr.Image))
+	}
+	return attrs
+}
+
+// endSpan ends the span of a finished job. The time at which the job's pod got
+// scheduled is recorded so that scheduling delays can be told apart from slow pulls.
+func (iwres *ImageWorkResult) endSpan(pod *corev1.Pod) {
+	if iwres.span == nil {
+		return
+	}
+	if pod != nil {
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionTrue {
+				iwres.span.AddEvent("PodScheduled", trace.WithTimestamp(condition.LastTransitionTime.Time))
 			}
-		} else {
-			iwres.Reason = fledgedv1alpha3.ImageCacheReasonImagePullStatusUnknown
-			iwres.Message = fledgedv1alpha3.ImageCacheMessageImagePullStatusUnknown
-		}
-		if iwres.ImageWorkRequest.WorkType == ImageCachePurge {
-			glog.Infof("Job %s failed (delete: %s --> %s)", pod.Labels["job-name"], iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"])
-		} else {
-			glog.Infof("Job %s failed (pull: %s --> %s)", pod.Labels["job-name"], iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"])
 		}
 	}
-	m.lock.Lock()
-	m.imageworkstatus[pod.Labels["job-name"]] = iwres
-	m.lock.Unlock()
+	if iwres.Status != ImageWorkResultStatusSucceeded {
+		iwres.span.SetStatus(codes.Error, iwres.Reason)
+	}
+	iwres.span.SetAttributes(attribute.String("kubefledged.result", iwres.Status))
+	iwres.span.End()
+	iwres.span = nil
 }
 
-func (m *ImageManager) updatePendingImageWorkResults(imageCacheName string) error {
+// updatePendingImageWorkResults sets the final results of the work of the sync
+// action which did not finish before the deadline. A result whose status
+// cannot be obtained from its image puller is reported as unknown.
+func (m *ImageManager) updatePendingImageWorkResults(syncID string) {
 	m.lock.Lock()
 	defer m.lock.Unlock()
-	for job, iwres := range m.imageworkstatus {
-		if iwres.ImageWorkRequest.Imagecache.Name == imageCacheName {
-			if iwres.Status == ImageWorkResultStatusJobCreated {
-				pods, err := m.podsLister.Pods(iwres.ImageWorkRequest.Imagecache.Namespace).
-					List(labels.Set(map[string]string{"job-name": job}).AsSelector())
-				if err != nil {
-					glog.Errorf("Error listing Pods: %v", err)
-					return err
-				}
-				if len(pods) > 1 {
-					glog.Errorf("More than one pod matched job %s", job)
-					return fmt.Errorf("more than one pod matched job %s", job)
-				}
-				if len(pods) == 0 {
-					glog.Warningf("No pods matched job %s", job)
-					if iwres.ImageWorkRequest.WorkType == ImageCachePurge {
-						glog.Warningf("Job %s status unknown (delete: %s --> %s)", job, iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"])
-					} else {
-						glog.Warningf("Job %s status unknown (pull: %s --> %s)", job, iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"])
-					}
-					iwres.Status = ImageWorkResultStatusUnknown
-					iwres.Reason = fmt.Sprintf("No pods matched job %s", job)
-					iwres.Message = fmt.Sprintf("No pods matched job %s", job)
-				}
-				if len(pods) == 1 {
-					iwres.Status = ImageWorkResultStatusFailed
-					if iwres.ImageWorkRequest.WorkType == ImageCachePurge {
-						glog.Infof("Job %s expired (delete: %s --> %s)", job, iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"])
-					} else {
-						glog.Infof("Job %s expired (pull: %s --> %s)", job, iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"])
-					}
-					if pods[0].Status.Phase == corev1.PodPending {
-						if len(pods[0].Status.ContainerStatuses) == 1 {
-							if pods[0].Status.ContainerStatuses[0].State.Waiting != nil {
-								iwres.Reason = pods[0].Status.ContainerStatuses[0].State.Waiting.Reason
-								iwres.Message = pods[0].Status.ContainerStatuses[0].State.Waiting.Message
-							}
-							if pods[0].Status.ContainerStatuses[0].State.Terminated != nil {
-								iwres.Reason = pods[0].Status.ContainerStatuses[0].State.Terminated.Reason
-								iwres.Message = pods[0].Status.ContainerStatuses[0].State.Terminated.Message
-							}
-						} else {
-							iwres.Reason = "Pending"
-							iwres.Message = "Check if node is ready"
-						}
-					}
-					if iwres.ImageWorkRequest.WorkType != ImageCachePurge {
-						fieldSelector := fields.Set{
-							"involvedObject.kind":      "Pod",
-							"involvedObject.name":      pods[0].Name,
-							"involvedObject.namespace": iwres.ImageWorkRequest.Imagecache.Namespace,
-							"reason":                   "Failed",
-						}.AsSelector().String()
-
-						eventlist, err := m.kubeclientset.CoreV1().Events(iwres.ImageWorkRequest.Imagecache.Namespace).
-							List(context.TODO(), metav1.ListOptions{FieldSelector: fieldSelector})
-						if err != nil {
-							glog.Errorf("Error listing events for pod (%s): %v", pods[0].Name, err)
-							return err
-						}
-
-						for _, v := range eventlist.Items {
-							iwres.Message = iwres.Message + ":" + v.Message
-						}
-					}
-				}
-				m.imageworkstatus[job] = iwres
+	s, ok := m.syncs[syncID]
+	if !ok {
+		return
+	}
+	for job := range s.jobs {
+		iwres := m.imageworkstatus[job]
+		// The retry was not attempted before the deadline, report the last failure
+		if iwres.Status == ImageWorkResultStatusRetryScheduled {
+			klog.InfoS("Image pull retry not attempted before deadline", append(iwres.ImageWorkRequest.logValues(), "job", job)...)
+			iwres.Status = ImageWorkResultStatusFailed
+			iwres.NextRetryTime = nil
+			m.setResult(job, iwres)
+		}
+		if iwres.Status == ImageWorkResultStatusPinScheduled {
+			klog.InfoS("Image pin not attempted before deadline", append(iwres.ImageWorkRequest.logValues(), "job", job)...)
+			iwres.Status = ImageWorkResultStatusFailed
+			iwres.Reason = fledgedv1alpha3.ImageCacheReasonImagePinNotAttempted
+			iwres.Message = fledgedv1alpha3.ImageCacheMessageImagePinNotAttempted
+			m.setResult(job, iwres)
+		}
+		if iwres.Status == ImageWorkResultStatusQueued {
+			// The reason why the request was queued is reported as failure
+			klog.InfoS("Job not created before deadline, request still queued", append(iwres.ImageWorkRequest.logValues(),
+				"job", job, "reason", iwres.Reason)...)
+			iwres.Status = ImageWorkResultStatusFailed
+			m.setResult(job, iwres)
+		}
+		if iwres.Status == ImageWorkResultStatusJobCreated {
+			iwres, err := m.pullerOf(iwres).Status(job, iwres)
+			if err != nil {
+				klog.ErrorS(err, "Error getting status of job", append(iwres.ImageWorkRequest.logValues(), "job", job)...)
+				iwres.Status = ImageWorkResultStatusUnknown
+				iwres.Reason = fledgedv1alpha3.ImageCacheReasonImagePullStatusUnknown
+				iwres.Message = err.Error()
 			}
+			iwres.endSpan(nil)
+			m.setResult(job, iwres)
 		}
 	}
-	glog.V(4).Infof("imageworkstatus map: %+v", m.imageworkstatus)
-	return nil
+	klog.V(4).InfoS("Pending image work results updated", "syncID", syncID, "results", len(s.jobs))
 }
 
-func (m *ImageManager) updateImageCacheStatus(imageCache *fledgedv1alpha3.ImageCache, errCh chan<- error) {
-	wait.Poll(time.Second, m.imagePullDeadlineDuration,
-		func() (done bool, err error) {
-			m.lock.RLock()
-			defer m.lock.RUnlock()
-			done, err = true, nil
-			for _, iwres := range m.imageworkstatus {
-				if iwres.ImageWorkRequest.Imagecache.Name == imageCache.Name {
-					if iwres.Status == ImageWorkResultStatusJobCreated {
-						done, err = false, nil
-						return
-					}
-				}
-			}
-			return
-		})
-	glog.V(4).Info("wait.Poll exited successfully")
-	err := m.updatePendingImageWorkResults(imageCache.Name)
-	if err != nil {
-		glog.Errorf("Error from updatePendingImageWorkResults(): %v", err)
-		errCh <- err
-		return
-	}
-	glog.V(4).Info("m.updatePendingImageWorkResults exited successfully")
-	//m.lock.Lock()
+// updateImageCacheStatus sends the results of the sync action announced by
+// sentinel to the controller, once its jobs finished or ran out of time. The
+// results are always sent, so that the image cache does not stay under processing.
+func (m *ImageManager) updateImageCacheStatus(ctx context.Context, sentinel ImageWorkRequest) {
+	syncID, imageCache := sentinel.SyncID, sentinel.Imagecache
+	ctx, span := tracing.Tracer().Start(ctx, "ImageManager.updateImageCacheStatus", trace.WithAttributes(
+		tracing.AttrImageCache.String(imageCache.Name), tracing.AttrNamespace.String(imageCache.Namespace),
+		tracing.AttrSyncID.String(syncID)))
+	defer span.End()
+	klog.V(4).InfoS("Finished waiting for jobs", "imagecache", klog.KObj(imageCache), "syncID", syncID)
+	span.AddEvent("JobsCompleted")
+	m.updatePendingImageWorkResults(syncID)
+	klog.V(4).InfoS("Updated pending image work results", "imagecache", klog.KObj(imageCache))
 	iwstatus := map[string]ImageWorkResult{}
-	//m.lock.Unlock()
-	deletePropagation := metav1.DeletePropagationBackground
-	var iwstatusLock sync.RWMutex
 	m.lock.Lock()
-	for job, iwres := range m.imageworkstatus {
-		if iwres.ImageWorkRequest.Imagecache.Name == imageCache.Name {
-			iwstatusLock.Lock()
+	if c, ok := m.cancelled[syncID]; ok {
+		c.done = true
+	}
+	if s, ok := m.syncs[syncID]; ok {
+		for job := range s.jobs {
+			iwres := m.imageworkstatus[job]
 			iwstatus[job] = iwres
-			iwstatusLock.Unlock()
-			imageCache = iwres.ImageWorkRequest.Imagecache
-			delete(m.imageworkstatus, job)
-			// delete the job if RetentionPolicy is not Retain
-			if !strings.HasPrefix(job, fakeJobPrefix) && m.canDeleteJob {
-				if err := m.kubeclientset.BatchV1().Jobs(imageCache.Namespace).
-					Delete(context.TODO(), job, metav1.DeleteOptions{PropagationPolicy: &deletePropagation}); err != nil {
-					// if for some reason the job cannot be deleted, we'll not retry. rather we continue processing the remaining jobs
-					if strings.Contains(err.Error(), "not found") {
-						glog.Warningf("Error deleting job %s: %s", job, "not found")
-					} else {
-						glog.Errorf("Error deleting job %s: %v", job, err)
-					}
-					//m.lock.Unlock()
-					//errCh <- err
-					//return
-				}
+			if iwres.ImageWorkRequest.Imagecache != nil {
+				imageCache = iwres.ImageWorkRequest.Imagecache
 			}
+			m.removeResult(job)
+			// delete the job if RetentionPolicy is not Retain
+			m.deleteJob(imageCache.Namespace, job, iwres)
 		}
+		delete(m.syncs, syncID)
 	}
 	m.lock.Unlock()
-	if imageCache == nil {
-		glog.Errorf("Unable to obtain reference to image cache")
-		errCh <- fmt.Errorf("unable to obtain reference to image cache")
-		return
-	}
 	objKey, err := cache.MetaNamespaceKeyFunc(imageCache)
 	if err != nil {
-		glog.Errorf("Error from cache.MetaNamespaceKeyFunc(imageCache): %v", err)
-		errCh <- err
+		klog.ErrorS(err, "Error getting key of image cache", "imagecache", klog.KObj(imageCache))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return
 	}
-	m.workqueue.AddRateLimited(WorkQueueKey{
-		WorkType: ImageCacheStatusUpdate,
-		Status:   &iwstatus,
-		ObjKey:   objKey,
-	})
-
-	errCh <- nil
+	wqKey := WorkQueueKey{
+		WorkType:    ImageCacheStatusUpdate,
+		Status:      &iwstatus,
+		ObjKey:      objKey,
+		SyncID:      syncID,
+		TraceParent: tracing.Inject(ctx),
+	}
+	if sentinel.Plan {
+		wqKey.WorkType = ImageCachePlanStatusUpdate
+	}
+	if sentinel.WorkType == NodeWarmup {
+		// Warm-up results are accounted to the node, the image cache status is left as is
+		wqKey.WorkType = NodeWarmupStatusUpdate
+		wqKey.ObjKey = sentinel.Node.Name
+	}
+	m.workqueue.AddRateLimited(wqKey)
 }
 
 // Run starts the Image Manager go routine
 func (m *ImageManager) Run(stopCh <-chan struct{}) error {
 	defer runtime.HandleCrash()
-	glog.Info("Starting image manager")
+	klog.InfoS("Starting image manager")
 	go m.kubeInformerFactory.Start(stopCh)
+	cacheSyncs := []cache.InformerSynced{m.podsSynced, m.jobsSynced}
+	if agent, ok := m.puller.(*agentPuller); ok {
+		go agent.informerFactory.Start(stopCh)
+		cacheSyncs = append(cacheSyncs, agent.tasksSynced)
+	}
 	// Wait for the caches to be synced before starting workers
-	glog.Info("Waiting for informer caches to sync")
-	if ok := cache.WaitForCacheSync(stopCh, m.podsSynced); !ok {
+	klog.InfoS("Waiting for informer caches to sync")
+	if ok := cache.WaitForCacheSync(stopCh, cacheSyncs...); !ok {
 		return fmt.Errorf("failed to wait for caches to sync")
 	}
 	go wait.Until(m.runWorker, time.Second, stopCh)
-	glog.Info("Started image manager")
+	klog.InfoS("Started image manager")
 	<-stopCh
-	glog.Info("Shutting down image manager")
+	klog.InfoS("Shutting down image manager")
 	return nil
 }
 
@@ -406,7 +594,6 @@ func (m *ImageManager) runWorker() {
 // processNextWorkItem will read a single work item off the workqueue and
 // attempt to process it, by calling the syncHandler.
 func (m *ImageManager) processNextWorkItem() bool {
-	//glog.Info("processNextWorkItem::Beginning...")
 	obj, shutdown := m.imageworkqueue.Get()
 
 	if shutdown {
@@ -438,51 +625,144 @@ func (m *ImageManager) processNextWorkItem() bool {
 			return nil
 		}
 
-		// When both Image and Node fields are empty it indicates all image pull/delete requests
-		// have been placed in the workqueue by the controller. The controller is waiting for status update
-		if iwr.Image == "" && iwr.Node == nil {
+		syncCtx := tracing.Extract(context.Background(), iwr.TraceParent)
+		ctx, span := tracing.Tracer().Start(syncCtx, "ImageManager.processNextWorkItem",
+			trace.WithAttributes(iwr.spanAttributes()...))
+		defer span.End()
+
+		// When the Image field is empty it indicates all image pull/delete requests
+		// have been placed in the workqueue by the controller. The controller is waiting for status update.
+		// The Node field is only set for the requests of a node warm-up.
+		if iwr.Image == "" {
+			m.imageworkqueue.Forget(obj)
+			m.startSync(syncCtx, iwr)
+			return nil
+		}
+		if m.dropCancelled(iwr) {
+			m.imageworkqueue.Forget(obj)
+			return nil
+		}
+		if iwr.Supersedes != "" {
+			m.lock.RLock()
+			superseded, ok := m.imageworkstatus[iwr.Supersedes]
+			m.lock.RUnlock()
+			if !ok || (superseded.Status != ImageWorkResultStatusRetryScheduled && superseded.Status != ImageWorkResultStatusPinScheduled &&
+				superseded.Status != ImageWorkResultStatusQueued) {
+				// The sync action completed before the request was due
+				klog.InfoS("Request dropped, sync action already completed", append(iwr.logValues(), "job", iwr.Supersedes)...)
+				m.imageworkqueue.Forget(obj)
+				return nil
+			}
+			if superseded.Status == ImageWorkResultStatusRetryScheduled {
+				klog.InfoS("Retrying image pull", append(iwr.logValues(), "attempt", iwr.Attempts(), "failedJob", iwr.Supersedes)...)
+				span.SetAttributes(attribute.Int("kubefledged.attempt", int(iwr.Attempts())))
+			}
+		}
+		if iwr.Plan {
+			if err := m.planImageWork(iwr); err != nil {
+				return err
+			}
 			m.imageworkqueue.Forget(obj)
-			errCh := make(chan error)
-			go m.updateImageCacheStatus(iwr.Imagecache, errCh)
 			return nil
 		}
 		// Run the syncHandler, passing it the namespace/name string of the
 		// ImageCache resource to be synced.
-		var job *batchv1.Job
+		// job is the name of the work started by the image puller for the request
+		var job string
 		var err error
-		var pull, delete bool
-		if iwr.WorkType == ImageCachePurge {
-			delete = true
-			job, err = m.deleteImage(iwr)
+		var pull, remove bool
+		// queue reports whether the request had to be queued because of the
+		// maintenance windows or the limits
+		queue := func(pull bool) bool {
+			if delay := m.deferral(iwr); delay > 0 {
+				klog.InfoS("Request deferred until maintenance window opens", append(iwr.logValues(), "opensIn", delay)...)
+				m.queueRequest(iwr, delay, fledgedv1alpha3.ImageCacheReasonMaintenanceWindow,
+					fledgedv1alpha3.ImageCacheMessageMaintenanceWindowClosed)
+				m.imageworkqueue.Forget(obj)
+				return true
+			}
+			delay := m.throttle(iwr, pull)
+			if delay == 0 {
+				return false
+			}
+			klog.V(4).InfoS("Request queued", append(iwr.logValues(), "delay", delay)...)
+			m.queueRequest(iwr, delay, fledgedv1alpha3.ImageCacheReasonRateLimited, fledgedv1alpha3.ImageCacheMessageRateLimited)
+			m.imageworkqueue.Forget(obj)
+			return true
+		}
+		if iwr.Pin {
+			if queue(false) {
+				return nil
+			}
+			job, err = m.jobs.pin(ctx, iwr)
 			if err != nil {
-				return fmt.Errorf("error deleting image '%s' from node '%s': %s", iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"], err.Error())
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				return fmt.Errorf("error pinning image '%s' on node '%s': %s", iwr.Image, NodeHostname(iwr.Node), err.Error())
 			}
-			glog.Infof("Job %s created (delete:- %s --> %s, runtime: %s)", job.Name, iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"], iwr.ContainerRuntimeVersion)
+			klog.InfoS("Job created", append(iwr.logValues(), "job", job, "runtime", iwr.ContainerRuntimeVersion)...)
+		} else if iwr.WorkType == ImageCachePurge {
+			remove = true
+			if queue(false) {
+				return nil
+			}
+			job, err = m.pullerFor(iwr).Remove(ctx, iwr)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				return fmt.Errorf("error deleting image '%s' from node '%s': %s", iwr.Image, NodeHostname(iwr.Node), err.Error())
+			}
+			klog.InfoS("Job created", append(iwr.logValues(), "job", job, "runtime", iwr.ContainerRuntimeVersion)...)
 		} else {
 			pull = true
-			pull, err = checkIfImageNeedsToBePulled(m.imagePullPolicy, iwr.Image, iwr.Node)
+			pull, err = checkIfImageNeedsToBePulled(m.settings().ImagePullPolicy, iwr.Image, iwr.Node)
 			if err != nil {
-				glog.Errorf("Error from checkIfImageNeedsToBePulled(): %+v", err)
+				klog.ErrorS(err, "Error checking if image needs to be pulled", iwr.logValues()...)
 				return fmt.Errorf("error from checkIfImageNeedsToBePulled(): %+v", err)
 			}
 			if pull {
-				job, err = m.pullImage(iwr)
+				if queue(true) {
+					return nil
+				}
+				job, err = m.pullerFor(iwr).Pull(ctx, iwr)
 				if err != nil {
-					return fmt.Errorf("error pulling image '%s' to node '%s': %s", iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"], err.Error())
+					span.RecordError(err)
+					span.SetStatus(codes.Error, err.Error())
+					return fmt.Errorf("error pulling image '%s' to node '%s': %s", iwr.Image, NodeHostname(iwr.Node), err.Error())
 				}
-				glog.Infof("Job %s created (pull:- %s --> %s, runtime: %s)", job.Name, iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"], iwr.ContainerRuntimeVersion)
+				klog.InfoS("Job created", append(iwr.logValues(), "job", job, "runtime", iwr.ContainerRuntimeVersion)...)
+			} else if pinSupported(iwr) {
+				// The image is already present, it only needs to be pinned
+				iwr.Pin = true
+				if queue(false) {
+					return nil
+				}
+				job, err = m.jobs.pin(ctx, iwr)
+				if err != nil {
+					span.RecordError(err)
+					span.SetStatus(codes.Error, err.Error())
+					return fmt.Errorf("error pinning image '%s' on node '%s': %s", iwr.Image, NodeHostname(iwr.Node), err.Error())
+				}
+				klog.InfoS("Job created, image already present", append(iwr.logValues(), "job", job, "runtime", iwr.ContainerRuntimeVersion)...)
 			} else {
-				glog.Infof("Job not created (image-already-present:- %s --> %s, runtime: %s)", iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"], iwr.ContainerRuntimeVersion)
+				klog.InfoS("Job not created, image already present", append(iwr.logValues(), "runtime", iwr.ContainerRuntimeVersion)...)
 			}
 		}
 		// Finally, if no error occurs we Forget this item so it does not
 		// get queued again until another change happens.
 		m.lock.Lock()
-		if pull || delete {
-			m.imageworkstatus[job.Name] = ImageWorkResult{ImageWorkRequest: iwr, Status: ImageWorkResultStatusJobCreated}
+		if iwr.Supersedes != "" {
+			// The new request replaces the superseded one. Both entries are swapped under
+			// the same lock so that the sync action is never seen as completed in between.
+			go m.deleteJob(iwr.Imagecache.Namespace, iwr.Supersedes, m.imageworkstatus[iwr.Supersedes])
+		}
+		if pull || remove || iwr.Pin {
+			_, jobSpan := tracing.Tracer().Start(ctx, "ImageManager.job", trace.WithAttributes(tracing.AttrJob.String(job)))
+			m.recordResult(job, ImageWorkResult{ImageWorkRequest: iwr, Status: ImageWorkResultStatusJobCreated, span: jobSpan,
+				puller: m.pullerFor(iwr)})
 		} else {
 			// generate a random fake job name
-			m.imageworkstatus[names.SimpleNameGenerator.GenerateName(fakeJobPrefix)] = ImageWorkResult{ImageWorkRequest: iwr, Status: ImageWorkResultStatusAlreadyPulled}
+			m.recordResult(names.SimpleNameGenerator.GenerateName(fakeJobPrefix), ImageWorkResult{ImageWorkRequest: iwr, Status: ImageWorkResultStatusAlreadyPulled})
 		}
 		m.lock.Unlock()
 		m.imageworkqueue.Forget(obj)
@@ -490,6 +770,9 @@ func (m *ImageManager) processNextWorkItem() bool {
 	}(obj)
 
 	if err != nil {
+		if iwr, ok := obj.(ImageWorkRequest); ok {
+			m.dropRequest(iwr, err)
+		}
 		runtime.HandleError(err)
 		return true
 	}
@@ -497,38 +780,23 @@ func (m *ImageManager) processNextWorkItem() bool {
 	return true
 }
 
-// pullImage pulls the image to the node
-func (m *ImageManager) pullImage(iwr ImageWorkRequest) (*batchv1.Job, error) {
-	// Construct the Job manifest
-	newjob, err := newImagePullJob(iwr.Imagecache, iwr.Image, iwr.ForceFullCache, iwr.Node, m.imagePullPolicy,
-		m.busyboxImage, m.serviceAccountName, m.jobPriorityClassName)
-	if err != nil {
-		glog.Errorf("Error when constructing job manifest: %v", err)
-		return nil, err
-	}
-	// Create a Job to pull the image into the node
-	job, err := m.kubeclientset.BatchV1().Jobs(iwr.Imagecache.Namespace).Create(context.TODO(), newjob, metav1.CreateOptions{})
-	if err != nil {
-		glog.Errorf("Error creating job in node %s: %v", iwr.Node, err)
-		return nil, err
-	}
-	return job, nil
-}
-
-// deleteImage deletes the image from the node
-func (m *ImageManager) deleteImage(iwr ImageWorkRequest) (*batchv1.Job, error) {
-	// Construct the Job manifest
-	newjob, err := newImageDeleteJob(iwr.Imagecache, iwr.Image, iwr.Node, iwr.ContainerRuntimeVersion,
-		m.criClientImage, m.serviceAccountName, m.imageDeleteJobHostNetwork, m.jobPriorityClassName, m.criSocketPath)
-	if err != nil {
-		glog.Errorf("Error when constructing job manifest: %v", err)
-		return nil, err
-	}
-	// Create a Job to delete the image from the node
-	job, err := m.kubeclientset.BatchV1().Jobs(iwr.Imagecache.Namespace).Create(context.TODO(), newjob, metav1.CreateOptions{})
-	if err != nil {
-		glog.Errorf("Error creating job in node %s: %v", iwr.Node, err)
-		return nil, err
+// planImageWork records the result of a request without creating a job, i.e.
+// whether the image would be pulled, deleted or skipped
+func (m *ImageManager) planImageWork(iwr ImageWorkRequest) error {
+	result := ImageWorkResult{ImageWorkRequest: iwr, Status: ImageWorkResultStatusPlanned}
+	if iwr.WorkType != ImageCachePurge {
+		pull, err := checkIfImageNeedsToBePulled(m.settings().ImagePullPolicy, iwr.Image, iwr.Node)
+		if err != nil {
+			klog.ErrorS(err, "Error checking if image needs to be pulled", iwr.logValues()...)
+			return fmt.Errorf("error from checkIfImageNeedsToBePulled(): %+v", err)
+		}
+		if !pull {
+			result.Status = ImageWorkResultStatusAlreadyPulled
+		}
 	}
-	return job, nil
+	klog.V(4).InfoS("Image work planned", append(iwr.logValues(), "status", result.Status)...)
+	m.lock.Lock()
+	m.recordResult(names.SimpleNameGenerator.GenerateName(fakeJobPrefix), result)
+	m.lock.Unlock()
+	return nil
 }
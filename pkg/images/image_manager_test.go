@@ -17,6 +17,7 @@ limitations under the License.
 package images
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"strings"
@@ -24,11 +25,15 @@ import (
 	"time"
 
 	fledgedv1alpha3 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	fledgedfake "github.com/senthilrch/kube-fledged/pkg/client/clientset/versioned/fake"
+	"github.com/senthilrch/kube-fledged/pkg/config"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
 	coreinformers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
 	fakeclientset "k8s.io/client-go/kubernetes/fake"
@@ -47,26 +52,56 @@ var node = corev1.Node{
 func newTestImageManager(kubeclientset kubernetes.Interface, imagepullpolicy string,
 	serviceaccountname string, imagedeletejobhostnetwork bool,
 	jobpriorityclassname string, candeletejob bool, criSocketPath string) (*ImageManager, coreinformers.PodInformer) {
-	imagePullDeadlineDuration := time.Millisecond * 10
-	criClientImage := "senthilrch/fledged-docker-client:latest"
-	busyboxImage := "senthilrch/busybox:1.35.0"
-	imagePullPolicy := imagepullpolicy
-	serviceAccountName := serviceaccountname
-	imageDeleteJobHostNetwork := imagedeletejobhostnetwork
-	jobPriorityClassName := jobpriorityclassname
-	canDeleteJob := candeletejob
-	socketPath := criSocketPath
+	return newTestImageManagerWithPuller(kubeclientset, imagepullpolicy, serviceaccountname, imagedeletejobhostnetwork,
+		jobpriorityclassname, candeletejob, criSocketPath, nil)
+}
+
+// newTestImageManagerWithPuller returns an image manager which uses puller in
+// place of the job puller, unless it is nil
+func newTestImageManagerWithPuller(kubeclientset kubernetes.Interface, imagepullpolicy string,
+	serviceaccountname string, imagedeletejobhostnetwork bool,
+	jobpriorityclassname string, candeletejob bool, criSocketPath string,
+	puller ImagePuller) (*ImageManager, coreinformers.PodInformer) {
+	jobRetentionPolicy := config.JobRetentionPolicyDelete
+	if !candeletejob {
+		jobRetentionPolicy = config.JobRetentionPolicyRetain
+	}
+	cfg := &config.ControllerConfiguration{
+		Namespace:                 fledgedNameSpace,
+		ImagePullDeadlineDuration: metav1.Duration{Duration: time.Millisecond * 10},
+		CRIClientImage:            "senthilrch/fledged-docker-client:latest",
+		BusyboxImage:              "senthilrch/busybox:1.35.0",
+		ImagePullPolicy:           imagepullpolicy,
+		ServiceAccountName:        serviceaccountname,
+		ImageDeleteJobHostNetwork: imagedeletejobhostnetwork,
+		JobPriorityClassName:      jobpriorityclassname,
+		JobRetentionPolicy:        jobRetentionPolicy,
+		CRISocketPath:             criSocketPath,
+	}
 	imagecacheworkqueue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ImageCaches")
 	imageworkqueue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ImagePullerStatus")
 
 	imagemanager, podInformer := NewImageManager(imagecacheworkqueue, imageworkqueue, kubeclientset,
-		fledgedNameSpace, imagePullDeadlineDuration, criClientImage, busyboxImage, imagePullPolicy,
-		serviceAccountName, imageDeleteJobHostNetwork, jobPriorityClassName, canDeleteJob, socketPath)
+		fledgedfake.NewSimpleClientset(), cfg, puller)
 	imagemanager.podsSynced = func() bool { return true }
 
 	return imagemanager, podInformer
 }
 
+// finishJob adds the pod to the informer cache and reports its job as
+// completed or failed, depending on the phase of the pod
+func finishJob(imagemanager *ImageManager, pod *corev1.Pod) {
+	imagemanager.kubeInformerFactory.Core().V1().Pods().Informer().GetIndexer().Add(pod)
+	condition := batchv1.JobCondition{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}
+	if pod.Status.Phase == corev1.PodFailed {
+		condition.Type = batchv1.JobFailed
+	}
+	imagemanager.jobs.handleJobStatusChange(&batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: pod.Labels["job-name"], Namespace: pod.Namespace},
+		Status:     batchv1.JobStatus{Conditions: []batchv1.JobCondition{condition}},
+	})
+}
+
 func TestPullDeleteImage(t *testing.T) {
 	job := batchv1.Job{}
 	defaultImageCache := fledgedv1alpha3.ImageCache{
@@ -222,10 +257,10 @@ func TestPullDeleteImage(t *testing.T) {
 			"priority-class-kube-fledged", false, "")
 		var err error
 		if test.action == "pullimage" {
-			_, err = imagemanager.pullImage(test.iwr)
+			_, err = imagemanager.jobs.Pull(context.Background(), test.iwr)
 		}
 		if test.action == "deleteimage" {
-			_, err = imagemanager.deleteImage(test.iwr)
+			_, err = imagemanager.jobs.Remove(context.Background(), test.iwr)
 		}
 		if test.expectError {
 			if err == nil {
@@ -326,7 +361,7 @@ func TestHandlePodStatusChange(t *testing.T) {
 				Node:     &node,
 			},
 		}
-		imagemanager.handlePodStatusChange(&test.pod)
+		finishJob(imagemanager, &test.pod)
 
 		if test.pod.Status.Phase == corev1.PodSucceeded {
 			if !(imagemanager.imageworkstatus[test.pod.Labels["job-name"]].Status == ImageWorkResultStatusSucceeded) {
@@ -341,400 +376,1209 @@ func TestHandlePodStatusChange(t *testing.T) {
 	}
 }
 
-func TestUpdateImageCacheStatus(t *testing.T) {
-	imageCacheName := "fakeimagecache"
-	imageCache := &fledgedv1alpha3.ImageCache{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: imageCacheName,
-		}}
+func TestFinishJobRetry(t *testing.T) {
+	retryPolicy := &fledgedv1alpha3.RetryPolicy{
+		MaxAttempts:    2,
+		InitialBackoff: &metav1.Duration{Duration: time.Millisecond},
+	}
 	tests := []struct {
 		name                string
-		imageworkstatus     map[string]ImageWorkResult
-		pods                []corev1.Pod
-		eventListErr        bool
-		jobDeleteErr        bool
-		expectError         bool
-		expectedErrorString string
+		worktype            WorkType
+		retryPolicy         *fledgedv1alpha3.RetryPolicy
+		retry               int32
+		expectedStatus      string
+		expectedRetryQueued bool
 	}{
 		{
-			name: "#1: Successful",
-			imageworkstatus: map[string]ImageWorkResult{
-				"fakejob": {
-					ImageWorkRequest: ImageWorkRequest{
-						Imagecache: &fledgedv1alpha3.ImageCache{
-							ObjectMeta: metav1.ObjectMeta{
-								Name: imageCacheName,
-							},
-						},
-						Node: &node,
-					},
-					Status: ImageWorkResultStatusSucceeded,
-				},
-			},
-			pods:        []corev1.Pod{},
-			expectError: false,
+			name:           "#1: Create - No retry policy",
+			worktype:       ImageCacheCreate,
+			expectedStatus: ImageWorkResultStatusFailed,
 		},
 		{
-			name: "#2: Create - Successful",
-			imageworkstatus: map[string]ImageWorkResult{
-				"fakejob": {
-					ImageWorkRequest: ImageWorkRequest{
-						Imagecache: &fledgedv1alpha3.ImageCache{
-							ObjectMeta: metav1.ObjectMeta{
-								Name: imageCacheName,
-							},
-						},
-						Node: &node,
-					},
-					Status: ImageWorkResultStatusJobCreated,
-				},
-			},
-			pods: []corev1.Pod{
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Namespace: fledgedNameSpace,
-						Labels:    map[string]string{"job-name": "fakejob"},
-					},
-					Status: corev1.PodStatus{
-						Phase: corev1.PodPending,
-						ContainerStatuses: []corev1.ContainerStatus{
-							{
-								State: corev1.ContainerState{
-									Waiting: &corev1.ContainerStateWaiting{
-										Reason:  "fakereason",
-										Message: "fakemessage",
-									},
-								},
-							},
-						},
-					},
-				},
-			},
-			expectError: false,
+			name:                "#2: Create - Retry scheduled",
+			worktype:            ImageCacheCreate,
+			retryPolicy:         retryPolicy,
+			expectedStatus:      ImageWorkResultStatusRetryScheduled,
+			expectedRetryQueued: true,
 		},
 		{
-			name: "#3: Create - Successful (Node not ready, hence empty containerstatuses)",
-			imageworkstatus: map[string]ImageWorkResult{
-				"fakejob": {
-					ImageWorkRequest: ImageWorkRequest{
-						Imagecache: &fledgedv1alpha3.ImageCache{
-							ObjectMeta: metav1.ObjectMeta{
-								Name: imageCacheName,
-							},
-						},
-						Node: &node,
-					},
-					Status: ImageWorkResultStatusJobCreated,
-				},
-			},
-			pods: []corev1.Pod{
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Namespace: fledgedNameSpace,
-						Labels:    map[string]string{"job-name": "fakejob"},
-					},
-					Status: corev1.PodStatus{
-						Phase:             corev1.PodPending,
-						ContainerStatuses: []corev1.ContainerStatus{},
-					},
-				},
-			},
-			expectError: false,
+			name:           "#3: Create - Max attempts reached",
+			worktype:       ImageCacheCreate,
+			retryPolicy:    retryPolicy,
+			retry:          1,
+			expectedStatus: ImageWorkResultStatusFailed,
 		},
 		{
-			name: "#4: Purge - Successful",
-			imageworkstatus: map[string]ImageWorkResult{
-				"fakejob": {
-					ImageWorkRequest: ImageWorkRequest{
-						WorkType: ImageCachePurge,
-						Imagecache: &fledgedv1alpha3.ImageCache{
-							ObjectMeta: metav1.ObjectMeta{
-								Name: imageCacheName,
-							},
-						},
-						Node: &node,
-					},
-					Status: ImageWorkResultStatusJobCreated,
-				},
-			},
-			pods: []corev1.Pod{
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Namespace: fledgedNameSpace,
-						Labels:    map[string]string{"job-name": "fakejob"},
-					},
-					Status: corev1.PodStatus{
-						Phase: corev1.PodPending,
-						ContainerStatuses: []corev1.ContainerStatus{
-							{
-								State: corev1.ContainerState{
-									Waiting: &corev1.ContainerStateWaiting{
-										Reason:  "fakereason",
-										Message: "fakemessage",
-									},
-								},
-							},
-						},
-					},
-				},
+			name:           "#4: Purge - Deletes are not retried",
+			worktype:       ImageCachePurge,
+			retryPolicy:    retryPolicy,
+			expectedStatus: ImageWorkResultStatusFailed,
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		puller := NewFakeImagePuller()
+		imagemanager, _ := newTestImageManagerWithPuller(fakekubeclientset, "IfNotPresent", "sa-kube-fledged", false,
+			"priority-class-kube-fledged", false, "", puller)
+		imageCache := &fledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace},
+			Spec:       fledgedv1alpha3.ImageCacheSpec{RetryPolicy: test.retryPolicy},
+		}
+		imagemanager.imageworkstatus["fakejob"] = ImageWorkResult{
+			Status: ImageWorkResultStatusJobCreated,
+			ImageWorkRequest: ImageWorkRequest{
+				Image:      "foo",
+				WorkType:   test.worktype,
+				Node:       &node,
+				Imagecache: imageCache,
+				Retry:      test.retry,
 			},
-			expectError: false,
+			puller: puller,
+		}
+		puller.Fail("fakejob", "ErrImagePull", "pull failed")
+
+		iwres := imagemanager.imageworkstatus["fakejob"]
+		if iwres.Status != test.expectedStatus {
+			t.Errorf("Test: %s failed: expectedWorkResult=%s, actualWorkResult=%s", test.name, test.expectedStatus, iwres.Status)
+		}
+		if test.expectedRetryQueued {
+			if iwres.NextRetryTime == nil {
+				t.Errorf("Test: %s failed: next retry time not set", test.name)
+			}
+			if err := wait.PollImmediate(time.Millisecond, time.Second, func() (bool, error) {
+				return imagemanager.workqueue.Len() == 1, nil
+			}); err != nil {
+				t.Errorf("Test: %s failed: retry status update not queued", test.name)
+			}
+			if err := wait.PollImmediate(time.Millisecond, time.Second, func() (bool, error) {
+				return imagemanager.imageworkqueue.Len() == 1, nil
+			}); err != nil {
+				t.Errorf("Test: %s failed: retry request not queued", test.name)
+				continue
+			}
+			obj, _ := imagemanager.imageworkqueue.Get()
+			retry := obj.(ImageWorkRequest)
+			if retry.Attempts() != 2 || retry.Supersedes != "fakejob" {
+				t.Errorf("Test: %s failed: unexpected retry request attempts=%d, supersedes=%s", test.name, retry.Attempts(), retry.Supersedes)
+			}
+		} else if imagemanager.workqueue.Len() != 0 {
+			t.Errorf("Test: %s failed: unexpected retry status update", test.name)
+		}
+	}
+}
+
+func TestRetryPullFailed(t *testing.T) {
+	fakekubeclientset := &fakeclientset.Clientset{}
+	puller := NewFakeImagePuller()
+	imagemanager, _ := newTestImageManagerWithPuller(fakekubeclientset, "IfNotPresent", "sa-kube-fledged", false,
+		"priority-class-kube-fledged", false, "", puller)
+	imageCache := &fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace},
+		Spec: fledgedv1alpha3.ImageCacheSpec{RetryPolicy: &fledgedv1alpha3.RetryPolicy{
+			MaxAttempts:    2,
+			InitialBackoff: &metav1.Duration{Duration: time.Millisecond},
+		}},
+	}
+	imagemanager.lock.Lock()
+	imagemanager.recordResult("fakejob", ImageWorkResult{
+		Status:           ImageWorkResultStatusJobCreated,
+		ImageWorkRequest: ImageWorkRequest{Image: "foo", WorkType: ImageCacheCreate, Node: &node, Imagecache: imageCache},
+		puller:           puller,
+	})
+	imagemanager.lock.Unlock()
+	puller.Fail("fakejob", "ErrImagePull", "pull failed")
+	if err := wait.PollImmediate(time.Millisecond, time.Second, func() (bool, error) {
+		return imagemanager.imageworkqueue.Len() == 1, nil
+	}); err != nil {
+		t.Fatalf("Test: retry pull failed: retry request not queued")
+	}
+
+	// The retry cannot be started, its failure replaces the scheduled retry
+	puller.SetPullError(fmt.Errorf("fake error"))
+	imagemanager.processNextWorkItem()
+	iwres := imagemanager.imageworkstatus["fakejob"]
+	if iwres.Status != ImageWorkResultStatusFailed || iwres.Reason != fledgedv1alpha3.ImageCacheReasonJobCreationFailed ||
+		!strings.Contains(iwres.Message, "fake error") {
+		t.Errorf("Test: retry pull failed: unexpected result status=%s, reason=%s, message=%s", iwres.Status, iwres.Reason, iwres.Message)
+	}
+	if s := imagemanager.syncs[""]; s == nil || s.pending != 0 || s.placed != 1 {
+		t.Errorf("Test: retry pull failed: unexpected sync state %+v", s)
+	}
+}
+
+func TestHandleJobStatusChange(t *testing.T) {
+	failed := []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue,
+		Reason: "DeadlineExceeded", Message: "Job was active longer than specified deadline"}}
+	evictedPod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "fakejob-abcde", Labels: map[string]string{"job-name": "fakejob"}},
+		Status:     corev1.PodStatus{Phase: corev1.PodFailed, Reason: "Evicted", Message: "The node was low on resource: ephemeral-storage."},
+	}
+	tests := []struct {
+		name            string
+		conditions      []batchv1.JobCondition
+		pod             *corev1.Pod
+		deleted         bool
+		expectedStatus  string
+		expectedReason  string
+		expectedMessage string
+	}{
+		{
+			name:           "#1: Job active",
+			expectedStatus: ImageWorkResultStatusJobCreated,
 		},
 		{
-			name: "#5: Purge - Successful",
-			imageworkstatus: map[string]ImageWorkResult{
-				"fakejob": {
-					ImageWorkRequest: ImageWorkRequest{
-						WorkType: ImageCachePurge,
-						Imagecache: &fledgedv1alpha3.ImageCache{
-							ObjectMeta: metav1.ObjectMeta{
-								Name: imageCacheName,
-							},
-						},
-						Node: &node,
-					},
-					Status: ImageWorkResultStatusJobCreated,
-				},
-			},
-			pods: []corev1.Pod{
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Namespace: fledgedNameSpace,
-						Labels:    map[string]string{"job-name": "fakejob"},
-					},
-					Status: corev1.PodStatus{
-						Phase: corev1.PodPending,
-						ContainerStatuses: []corev1.ContainerStatus{
-							{
-								State: corev1.ContainerState{
-									Terminated: &corev1.ContainerStateTerminated{
-										Reason:  "fakereason",
-										Message: "fakemessage",
-									},
-								},
-							},
-						},
-					},
-				},
-			},
-			expectError: false,
+			name:            "#2: Deadline exceeded before the pod got scheduled",
+			conditions:      failed,
+			expectedStatus:  ImageWorkResultStatusFailed,
+			expectedReason:  "DeadlineExceeded",
+			expectedMessage: "Job was active longer than specified deadline",
 		},
 		{
-			name: "#6: Purge - Successful",
-			imageworkstatus: map[string]ImageWorkResult{
-				"fakejob": {
-					ImageWorkRequest: ImageWorkRequest{
-						WorkType: ImageCachePurge,
-						Imagecache: &fledgedv1alpha3.ImageCache{
-							ObjectMeta: metav1.ObjectMeta{
-								Name: imageCacheName,
-							},
-						},
-						Node: &node,
-					},
-					Status: ImageWorkResultStatusJobCreated,
-				},
-			},
-			pods: []corev1.Pod{
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Namespace: fledgedNameSpace,
-					},
-				},
-			},
-			expectError: false,
+			name:            "#3: Pod evicted",
+			conditions:      failed,
+			pod:             &evictedPod,
+			expectedStatus:  ImageWorkResultStatusFailed,
+			expectedReason:  "Evicted",
+			expectedMessage: "The node was low on resource: ephemeral-storage.",
 		},
 		{
-			name: "#7: Purge - Unsuccessful",
-			imageworkstatus: map[string]ImageWorkResult{
-				"fakejob": {
-					ImageWorkRequest: ImageWorkRequest{
-						WorkType: ImageCachePurge,
-						Imagecache: &fledgedv1alpha3.ImageCache{
-							ObjectMeta: metav1.ObjectMeta{
-								Name: imageCacheName,
-							},
-						},
-						Node: &node,
-					},
-					Status: ImageWorkResultStatusJobCreated,
-				},
-			},
-			pods: []corev1.Pod{
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Name:      "pod1",
-						Namespace: fledgedNameSpace,
-						Labels:    map[string]string{"job-name": "fakejob"},
-					},
-				},
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Name:      "pod2",
-						Namespace: fledgedNameSpace,
-						Labels:    map[string]string{"job-name": "fakejob"},
-					},
-				},
-			},
-			expectError:         true,
-			expectedErrorString: "more than one pod matched job",
+			name:            "#4: Job deleted before it finished",
+			deleted:         true,
+			expectedStatus:  ImageWorkResultStatusFailed,
+			expectedReason:  fledgedv1alpha3.ImageCacheReasonJobDeleted,
+			expectedMessage: fledgedv1alpha3.ImageCacheMessageJobDeleted,
 		},
 		{
-			name: "#8: Create - Successful",
-			imageworkstatus: map[string]ImageWorkResult{
-				"fakejob": {
-					ImageWorkRequest: ImageWorkRequest{
-						Imagecache: &fledgedv1alpha3.ImageCache{
-							ObjectMeta: metav1.ObjectMeta{
-								Name: imageCacheName,
-							},
-						},
-						Node: &node,
-					},
-					Status: ImageWorkResultStatusSucceeded,
-				},
-			},
-			pods: []corev1.Pod{
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Namespace: fledgedNameSpace,
-						Labels:    map[string]string{"job-name": "fakejob"},
-					},
-					Status: corev1.PodStatus{
-						Phase: corev1.PodPending,
-						ContainerStatuses: []corev1.ContainerStatus{
-							{
-								State: corev1.ContainerState{
-									Waiting: &corev1.ContainerStateWaiting{
-										Reason:  "fakereason",
-										Message: "fakemessage",
-									},
-								},
-							},
-						},
-					},
-				},
-			},
-			expectError: false,
+			name:           "#5: Job deleted after it completed",
+			conditions:     []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}},
+			deleted:        true,
+			expectedStatus: ImageWorkResultStatusSucceeded,
 		},
 	}
+	for _, test := range tests {
+		imagemanager, podInformer := newTestImageManager(&fakeclientset.Clientset{}, "IfNotPresent", "", false, "", false, "")
+		if test.pod != nil {
+			podInformer.Informer().GetIndexer().Add(test.pod)
+		}
+		imagemanager.setResult("fakejob", ImageWorkResult{
+			Status:           ImageWorkResultStatusJobCreated,
+			ImageWorkRequest: ImageWorkRequest{Image: "foo", WorkType: ImageCacheCreate, Node: &node},
+		})
+		job := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "fakejob"},
+			Status:     batchv1.JobStatus{Conditions: test.conditions},
+		}
+		if test.deleted {
+			imagemanager.jobs.handleJobDeleted(job)
+		} else {
+			imagemanager.jobs.handleJobStatusChange(job)
+		}
+
+		iwres := imagemanager.imageworkstatus["fakejob"]
+		if iwres.Status != test.expectedStatus || iwres.Reason != test.expectedReason || iwres.Message != test.expectedMessage {
+			t.Errorf("Test: %s failed: expected status=%s, reason=%s, message=%s, actual status=%s, reason=%s, message=%s",
+				test.name, test.expectedStatus, test.expectedReason, test.expectedMessage, iwres.Status, iwres.Reason, iwres.Message)
+		}
+	}
+}
 
+func TestHandleImageTaskStatusChange(t *testing.T) {
+	tests := []struct {
+		name            string
+		status          fledgedv1alpha3.ImageTaskStatus
+		deleted         bool
+		job             bool
+		expectedStatus  string
+		expectedReason  string
+		expectedMessage string
+	}{
+		{
+			name:           "#1: Image task not finished",
+			expectedStatus: ImageWorkResultStatusJobCreated,
+		},
+		{
+			name:           "#2: Image pulled by the agent",
+			status:         fledgedv1alpha3.ImageTaskStatus{Phase: fledgedv1alpha3.ImageTaskPhaseSucceeded},
+			expectedStatus: ImageWorkResultStatusSucceeded,
+		},
+		{
+			name: "#3: Image pull failed",
+			status: fledgedv1alpha3.ImageTaskStatus{Phase: fledgedv1alpha3.ImageTaskPhaseFailed,
+				Reason: "ErrImagePull", Message: "pull access denied"},
+			expectedStatus:  ImageWorkResultStatusFailed,
+			expectedReason:  "ErrImagePull",
+			expectedMessage: "pull access denied",
+		},
+		{
+			name:            "#4: Image task deleted before it finished",
+			deleted:         true,
+			expectedStatus:  ImageWorkResultStatusFailed,
+			expectedReason:  fledgedv1alpha3.ImageCacheReasonImageTaskDeleted,
+			expectedMessage: fledgedv1alpha3.ImageCacheMessageImageTaskDeleted,
+		},
+		{
+			name:           "#5: Job with the name of the image task completed",
+			job:            true,
+			expectedStatus: ImageWorkResultStatusJobCreated,
+		},
+	}
 	for _, test := range tests {
-		fakekubeclientset := &fakeclientset.Clientset{}
-		if test.eventListErr {
-			fakekubeclientset.AddReactor("list", "events", func(action core.Action) (handled bool, ret runtime.Object, err error) {
-				return true, nil, apierrors.NewInternalError(fmt.Errorf("fake error"))
+		imagemanager, _ := newTestImageManager(&fakeclientset.Clientset{}, "IfNotPresent", "", false, "", false, "")
+		agent := newAgentPuller(imagemanager, &imagemanager.cfg, labels.Everything())
+		imagemanager.setResult("faketask", ImageWorkResult{
+			Status:           ImageWorkResultStatusJobCreated,
+			ImageWorkRequest: ImageWorkRequest{Image: "foo", WorkType: ImageCacheCreate, Node: &node},
+			puller:           agent,
+		})
+		task := &fledgedv1alpha3.ImageTask{ObjectMeta: metav1.ObjectMeta{Name: "faketask"}, Status: test.status}
+		switch {
+		case test.job:
+			imagemanager.jobs.handleJobStatusChange(&batchv1.Job{
+				ObjectMeta: metav1.ObjectMeta{Name: "faketask"},
+				Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+					{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}},
 			})
+		case test.deleted:
+			agent.handleImageTaskDeleted(task)
+		default:
+			agent.handleImageTaskStatusChange(task)
 		}
-		if test.jobDeleteErr {
-			fakekubeclientset.AddReactor("delete", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
-				return true, nil, apierrors.NewInternalError(fmt.Errorf("fake error"))
-			})
+
+		iwres := imagemanager.imageworkstatus["faketask"]
+		if iwres.Status != test.expectedStatus || iwres.Reason != test.expectedReason || iwres.Message != test.expectedMessage {
+			t.Errorf("Test: %s failed: expected status=%s, reason=%s, message=%s, actual status=%s, reason=%s, message=%s",
+				test.name, test.expectedStatus, test.expectedReason, test.expectedMessage, iwres.Status, iwres.Reason, iwres.Message)
 		}
-		imagemanager, podInformer := newTestImageManager(fakekubeclientset, "IfNotPresent", "sa-kube-fledged", false,
-			"priority-class-kube-fledged", false, "")
-		for _, pod := range test.pods {
-			if !reflect.DeepEqual(pod, corev1.Pod{}) {
-				podInformer.Informer().GetIndexer().Add(&pod)
-			}
+	}
+}
+
+func TestAgentBackend(t *testing.T) {
+	imagecache := &fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace},
+		Spec: fledgedv1alpha3.ImageCacheSpec{
+			ImagePullSecrets: []corev1.LocalObjectReference{{Name: "regcred"}},
+		},
+	}
+	agentNode := corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1",
+		Labels: map[string]string{"kubernetes.io/hostname": "bar"}}}
+	tests := []struct {
+		name           string
+		iwr            ImageWorkRequest
+		expectedAction fledgedv1alpha3.ImageTaskAction
+		expectedPolicy corev1.PullPolicy
+	}{
+		{
+			name:           "#1: Image pulled by the agent",
+			iwr:            ImageWorkRequest{Image: "foo:1.0", Node: &agentNode, WorkType: ImageCacheCreate, Imagecache: imagecache},
+			expectedAction: fledgedv1alpha3.ImageTaskActionPull,
+			expectedPolicy: corev1.PullIfNotPresent,
+		},
+		{
+			name:           "#2: Image without tag always pulled by the agent",
+			iwr:            ImageWorkRequest{Image: "foo", Node: &agentNode, WorkType: ImageCacheCreate, Imagecache: imagecache},
+			expectedAction: fledgedv1alpha3.ImageTaskActionPull,
+			expectedPolicy: corev1.PullAlways,
+		},
+		{
+			name:           "#3: Image removed by the agent",
+			iwr:            ImageWorkRequest{Image: "foo:1.0", Node: &agentNode, WorkType: ImageCachePurge, Imagecache: imagecache},
+			expectedAction: fledgedv1alpha3.ImageTaskActionRemove,
+		},
+		{
+			name: "#4: Image pinned by a job",
+			iwr: ImageWorkRequest{Image: "foo:1.0", Node: &agentNode, WorkType: ImageCacheCreate, Imagecache: imagecache,
+				ContainerRuntimeVersion: "containerd://1.6.8", Pin: true},
+		},
+		{
+			name: "#5: Full cache pulled by a job",
+			iwr: ImageWorkRequest{Image: "foo:1.0", Node: &agentNode, WorkType: ImageCacheCreate, Imagecache: imagecache,
+				ForceFullCache: true},
+		},
+	}
+	for _, test := range tests {
+		kubeclientset := fakeclientset.NewSimpleClientset()
+		fledgedclientset := fledgedfake.NewSimpleClientset()
+		imagemanager, _ := newTestImageManager(kubeclientset, "IfNotPresent", "", false, "", true, "")
+		imagemanager.fledgedclientset = fledgedclientset
+		agent := newAgentPuller(imagemanager, &imagemanager.cfg, labels.Everything())
+		imagemanager.puller = agent
+
+		var name string
+		var err error
+		switch {
+		case test.iwr.Pin:
+			name, err = imagemanager.jobs.pin(context.Background(), test.iwr)
+		case test.iwr.WorkType == ImageCachePurge:
+			name, err = imagemanager.pullerFor(test.iwr).Remove(context.Background(), test.iwr)
+		default:
+			name, err = imagemanager.pullerFor(test.iwr).Pull(context.Background(), test.iwr)
 		}
-		imagemanager.imageworkstatus = test.imageworkstatus
-		errCh := make(chan error)
-		go imagemanager.updateImageCacheStatus(imageCache, errCh)
-		err := <-errCh
 		if err != nil {
-			t.Logf("err=%s", err.Error())
+			t.Errorf("Test: %s failed: err=%v", test.name, err)
+			continue
 		}
-		if test.expectError {
-			if err == nil {
-				t.Errorf("Test: %s failed: expectedError=%s, actualError=nil", test.name, test.expectedErrorString)
-			}
-			if err != nil && !strings.HasPrefix(err.Error(), test.expectedErrorString) {
-				t.Errorf("Test: %s failed: expectedError=%s, actualError=%s", test.name, test.expectedErrorString, err.Error())
+		tasks, _ := fledgedclientset.KubefledgedV1alpha3().ImageTasks(fledgedNameSpace).List(context.Background(), metav1.ListOptions{})
+		jobs, _ := kubeclientset.BatchV1().Jobs(fledgedNameSpace).List(context.Background(), metav1.ListOptions{})
+		if test.expectedAction == "" {
+			if len(tasks.Items) != 0 || len(jobs.Items) != 1 || imagemanager.pullerFor(test.iwr) == agent {
+				t.Errorf("Test: %s failed: expected a job, actual tasks=%d, jobs=%d", test.name, len(tasks.Items), len(jobs.Items))
 			}
-		} else if err != nil {
-			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		if len(tasks.Items) != 1 || len(jobs.Items) != 0 || imagemanager.pullerFor(test.iwr) != agent {
+			t.Errorf("Test: %s failed: expected an image task, actual tasks=%d, jobs=%d", test.name, len(tasks.Items), len(jobs.Items))
+			continue
+		}
+		task := tasks.Items[0]
+		if task.Name != name || task.Spec.NodeName != "node-1" || task.Labels[ImageTaskNodeLabel] != "bar" ||
+			task.Spec.Action != test.expectedAction || task.Spec.ImagePullPolicy != test.expectedPolicy ||
+			!reflect.DeepEqual(task.Spec.ImagePullSecrets, imagecache.Spec.ImagePullSecrets) {
+			t.Errorf("Test: %s failed: unexpected image task %+v", test.name, task)
+		}
+
+		// Finished image tasks are deleted like jobs
+		imagemanager.deleteJob(fledgedNameSpace, task.Name, ImageWorkResult{puller: agent})
+		tasks, _ = fledgedclientset.KubefledgedV1alpha3().ImageTasks(fledgedNameSpace).List(context.Background(), metav1.ListOptions{})
+		if len(tasks.Items) != 0 {
+			t.Errorf("Test: %s failed: image task not deleted", test.name)
 		}
 	}
 }
 
-func TestProcessNextWorkItem(t *testing.T) {
-	defaultImageCache := fledgedv1alpha3.ImageCache{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      "foo",
-			Namespace: "kube-fledged",
+func TestImagePuller(t *testing.T) {
+	imagecache := &fledgedv1alpha3.ImageCache{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace}}
+	tests := []struct {
+		name            string
+		iwr             ImageWorkRequest
+		expectedPulls   int
+		expectedRemoves int
+		expectedJobs    int
+	}{
+		{
+			name:          "#1: Image pulled by the selected puller",
+			iwr:           ImageWorkRequest{Image: "foo:1.0", Node: &node, WorkType: ImageCacheCreate, Imagecache: imagecache},
+			expectedPulls: 1,
 		},
-		Spec: fledgedv1alpha3.ImageCacheSpec{
-			CacheSpec: []fledgedv1alpha3.CacheSpecImages{
-				{
-					Images: []fledgedv1alpha3.Image{
-						{
-							Name:           "foo",
-							ForceFullCache: false,
-						},
-					},
-				},
-			},
+		{
+			name:            "#2: Image removed by the selected puller",
+			iwr:             ImageWorkRequest{Image: "foo:1.0", Node: &node, WorkType: ImageCachePurge, Imagecache: imagecache},
+			expectedRemoves: 1,
 		},
-	}
-	testnode := node
-	testnode.Status.Images = []corev1.ContainerImage{
 		{
-			Names: []string{"foo:v1"},
+			name: "#3: Image pinned by a job",
+			iwr: ImageWorkRequest{Image: "foo:1.0", Node: &node, WorkType: ImageCacheCreate, Imagecache: imagecache,
+				ContainerRuntimeVersion: "containerd://1.7.0", Pin: true},
+			expectedJobs: 1,
+		},
+		{
+			name: "#4: Full cache pulled by a job",
+			iwr: ImageWorkRequest{Image: "foo:1.0", Node: &node, WorkType: ImageCacheCreate, Imagecache: imagecache,
+				ForceFullCache: true},
+			expectedJobs: 1,
 		},
 	}
+	for _, test := range tests {
+		kubeclientset := fakeclientset.NewSimpleClientset()
+		puller := NewFakeImagePuller()
+		imagemanager, _ := newTestImageManagerWithPuller(kubeclientset, "IfNotPresent", "", false, "", true, "", puller)
+		imagemanager.imageworkqueue.Add(test.iwr)
+		imagemanager.processNextWorkItem()
+
+		jobs, _ := kubeclientset.BatchV1().Jobs(fledgedNameSpace).List(context.Background(), metav1.ListOptions{})
+		if len(puller.Pulls()) != test.expectedPulls || len(puller.Removes()) != test.expectedRemoves || len(jobs.Items) != test.expectedJobs {
+			t.Errorf("Test: %s failed: expected pulls=%d, removes=%d, jobs=%d, actual pulls=%d, removes=%d, jobs=%d", test.name,
+				test.expectedPulls, test.expectedRemoves, test.expectedJobs, len(puller.Pulls()), len(puller.Removes()), len(jobs.Items))
+			continue
+		}
+		if test.expectedJobs != 0 {
+			continue
+		}
+		name := append(puller.Pulls(), puller.Removes()...)[0]
+		if iwres := imagemanager.imageworkstatus[name]; iwres.Status != ImageWorkResultStatusJobCreated || iwres.puller != puller {
+			t.Errorf("Test: %s failed: unexpected result %+v", test.name, iwres)
+			continue
+		}
+		puller.Succeed(name)
+		iwres := imagemanager.imageworkstatus[name]
+		if iwres.Status != ImageWorkResultStatusSucceeded {
+			t.Errorf("Test: %s failed: expectedStatus=%s, actual=%s", test.name, ImageWorkResultStatusSucceeded, iwres.Status)
+		}
+		imagemanager.deleteJob(fledgedNameSpace, name, iwres)
+		if !reflect.DeepEqual(puller.Cleanups(), []string{name}) {
+			t.Errorf("Test: %s failed: expected cleanups=%v, actual=%v", test.name, []string{name}, puller.Cleanups())
+		}
+	}
+}
+
+func TestFinishJobPin(t *testing.T) {
 	tests := []struct {
-		name                string
-		iwr                 ImageWorkRequest
-		imageworkstatus     map[string]ImageWorkResult
-		pods                []corev1.Pod
-		imagepullpolicy     string
-		expectError         bool
-		expectedErrorString string
+		name              string
+		pinImages         bool
+		runtime           string
+		arch              string
+		pin               bool
+		expectedStatus    string
+		expectedPinQueued bool
 	}{
 		{
-			name: "#1: Create - Successful",
-			iwr: ImageWorkRequest{
-				Image:      "fakeimage",
-				Node:       &node,
-				WorkType:   ImageCacheCreate,
-				Imagecache: &defaultImageCache,
-			},
-			imageworkstatus: map[string]ImageWorkResult{
-				"fakejob": {
-					ImageWorkRequest: ImageWorkRequest{
-						Imagecache: &fledgedv1alpha3.ImageCache{
-							ObjectMeta: metav1.ObjectMeta{
-								Name: defaultImageCache.Name,
-							},
-						},
-					},
-					Status: ImageWorkResultStatusSucceeded,
-				},
+			name:           "#1: Pinning not requested",
+			runtime:        "containerd://1.7.0",
+			expectedStatus: ImageWorkResultStatusSucceeded,
+		},
+		{
+			name:              "#2: Pin scheduled",
+			pinImages:         true,
+			runtime:           "containerd://1.7.0",
+			expectedStatus:    ImageWorkResultStatusPinScheduled,
+			expectedPinQueued: true,
+		},
+		{
+			name:           "#3: Runtime does not support pinning",
+			pinImages:      true,
+			runtime:        "docker://20.10.0",
+			expectedStatus: ImageWorkResultStatusSucceeded,
+		},
+		{
+			name:           "#4: Image pinned",
+			pinImages:      true,
+			runtime:        "containerd://1.7.0",
+			pin:            true,
+			expectedStatus: ImageWorkResultStatusSucceeded,
+		},
+		{
+			name:           "#5: Node architecture does not support pinning",
+			pinImages:      true,
+			runtime:        "containerd://1.7.0",
+			arch:           "arm",
+			expectedStatus: ImageWorkResultStatusSucceeded,
+		},
+		{
+			name:              "#6: Pin scheduled (arm64 node)",
+			pinImages:         true,
+			runtime:           "containerd://1.7.0",
+			arch:              "arm64",
+			expectedStatus:    ImageWorkResultStatusPinScheduled,
+			expectedPinQueued: true,
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		puller := NewFakeImagePuller()
+		imagemanager, _ := newTestImageManagerWithPuller(fakekubeclientset, "IfNotPresent", "sa-kube-fledged", false,
+			"priority-class-kube-fledged", false, "", puller)
+		imageCache := &fledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace},
+			Spec:       fledgedv1alpha3.ImageCacheSpec{PinImages: test.pinImages},
+		}
+		pinNode := node.DeepCopy()
+		pinNode.Status.NodeInfo.Architecture = test.arch
+		imagemanager.imageworkstatus["fakejob"] = ImageWorkResult{
+			Status: ImageWorkResultStatusJobCreated,
+			ImageWorkRequest: ImageWorkRequest{
+				Image:                   "foo:v1",
+				WorkType:                ImageCacheCreate,
+				Node:                    pinNode,
+				ContainerRuntimeVersion: test.runtime,
+				Imagecache:              imageCache,
+				Pin:                     test.pin,
+			},
+			puller: puller,
+		}
+		puller.Succeed("fakejob")
+
+		if actual := imagemanager.imageworkstatus["fakejob"].Status; actual != test.expectedStatus {
+			t.Errorf("Test: %s failed: expectedWorkResult=%s, actualWorkResult=%s", test.name, test.expectedStatus, actual)
+		}
+		if !test.expectedPinQueued {
+			if imagemanager.imageworkqueue.Len() != 0 {
+				t.Errorf("Test: %s failed: unexpected pin request", test.name)
+			}
+			continue
+		}
+		if imagemanager.imageworkqueue.Len() != 1 {
+			t.Errorf("Test: %s failed: pin request not queued", test.name)
+			continue
+		}
+		obj, _ := imagemanager.imageworkqueue.Get()
+		if pin := obj.(ImageWorkRequest); !pin.Pin || pin.Supersedes != "fakejob" {
+			t.Errorf("Test: %s failed: unexpected pin request pin=%t, supersedes=%s", test.name, pin.Pin, pin.Supersedes)
+		}
+	}
+}
+
+func TestNewImagePinJob(t *testing.T) {
+	imageCache := &fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace},
+	}
+	tests := []struct {
+		name            string
+		image           string
+		expectedCommand string
+	}{
+		{
+			name:            "#1: Short name",
+			image:           "nginx:1.21",
+			expectedCommand: "exec /usr/bin/ctr --address /run/containerd/containerd.sock --namespace k8s.io images label docker.io/library/nginx:1.21 io.cri-containerd.pinned=pinned > /dev/termination-log 2>&1",
+		},
+		{
+			name:            "#2: Registry with domain and digest",
+			image:           "quay.io/org/app@sha256:abc",
+			expectedCommand: "exec /usr/bin/ctr --address /run/containerd/containerd.sock --namespace k8s.io images label quay.io/org/app@sha256:abc io.cri-containerd.pinned=pinned > /dev/termination-log 2>&1",
+		},
+	}
+	for _, test := range tests {
+		job, err := newImagePinJob(imageCache, test.image, &node, "senthilrch/kubefledged-cri-client:latest", "", false, "", "")
+		if err != nil {
+			t.Errorf("Test: %s failed: err=%v", test.name, err)
+			continue
+		}
+		if actual := job.Spec.Template.Spec.Containers[0].Args[1]; actual != test.expectedCommand {
+			t.Errorf("Test: %s failed: expectedCommand=%s, actualCommand=%s", test.name, test.expectedCommand, actual)
+		}
+	}
+}
+
+func TestPlanImageWork(t *testing.T) {
+	testnode := node
+	testnode.Status.Images = []corev1.ContainerImage{{Names: []string{"foo:v1"}}}
+	imageCache := &fledgedv1alpha3.ImageCache{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace}}
+	tests := []struct {
+		name           string
+		image          string
+		workType       WorkType
+		expectedStatus string
+	}{
+		{
+			name:           "#1: Pull planned",
+			image:          "foo:v2",
+			workType:       ImageCacheCreate,
+			expectedStatus: ImageWorkResultStatusPlanned,
+		},
+		{
+			name:           "#2: Image already present",
+			image:          "foo:v1",
+			workType:       ImageCacheUpdate,
+			expectedStatus: ImageWorkResultStatusAlreadyPulled,
+		},
+		{
+			name:           "#3: Delete planned",
+			image:          "foo:v1",
+			workType:       ImageCachePurge,
+			expectedStatus: ImageWorkResultStatusPlanned,
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent", "sa-kube-fledged", false,
+			"priority-class-kube-fledged", false, "")
+		imagemanager.imageworkqueue.Add(ImageWorkRequest{Image: test.image, Node: &testnode, WorkType: test.workType,
+			Imagecache: imageCache, Plan: true})
+		imagemanager.processNextWorkItem()
+		if len(imagemanager.imageworkstatus) != 1 {
+			t.Errorf("Test: %s failed: expected 1 work result, actual=%d", test.name, len(imagemanager.imageworkstatus))
+			continue
+		}
+		for _, iwres := range imagemanager.imageworkstatus {
+			if iwres.Status != test.expectedStatus {
+				t.Errorf("Test: %s failed: expectedWorkResult=%s, actualWorkResult=%s", test.name, test.expectedStatus, iwres.Status)
+			}
+		}
+		if actions := fakekubeclientset.Actions(); len(actions) != 0 {
+			t.Errorf("Test: %s failed: unexpected api calls %v", test.name, actions)
+		}
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	imageCache := &fledgedv1alpha3.ImageCache{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace}}
+	running := ImageWorkResult{ImageWorkRequest: ImageWorkRequest{Imagecache: imageCache}, Status: ImageWorkResultStatusJobCreated}
+	// A window opening in six hours is closed now
+	opens := time.Now().UTC().Add(6 * time.Hour)
+	closedWindows := []fledgedv1alpha3.MaintenanceWindow{{
+		Schedule: fmt.Sprintf("CRON_TZ=UTC %d %d * * *", opens.Minute(), opens.Hour()),
+		Duration: metav1.Duration{Duration: time.Minute},
+	}}
+	tests := []struct {
+		name              string
+		images            []string
+		workType          WorkType
+		maxConcurrentJobs int
+		registryPullQPS   float64
+		registryLimits    map[string]config.RegistryPullLimit
+		windows           []fledgedv1alpha3.MaintenanceWindow
+		urgent            bool
+		runningJobs       int
+		expectedJobs      int
+		expectedQueued    int
+	}{
+		{
+			name:         "#1: No limits",
+			images:       []string{"foo:v2", "bar:v2"},
+			workType:     ImageCacheCreate,
+			expectedJobs: 2,
+		},
+		{
+			name:              "#2: Job concurrency cap reached",
+			images:            []string{"foo:v2", "bar:v2"},
+			workType:          ImageCacheCreate,
+			maxConcurrentJobs: 2,
+			runningJobs:       1,
+			expectedJobs:      1,
+			expectedQueued:    1,
+		},
+		{
+			name:              "#3: Job concurrency cap applies to deletes",
+			images:            []string{"foo:v2"},
+			workType:          ImageCachePurge,
+			maxConcurrentJobs: 1,
+			runningJobs:       1,
+			expectedQueued:    1,
+		},
+		{
+			name:            "#4: Registry pull rate limit, other registry not limited",
+			images:          []string{"foo:v2", "docker.io/library/bar:v2", "quay.io/org/baz:v2"},
+			workType:        ImageCacheCreate,
+			registryPullQPS: 0.001,
+			registryLimits:  map[string]config.RegistryPullLimit{"quay.io": {}},
+			expectedJobs:    2,
+			expectedQueued:  1,
+		},
+		{
+			name:            "#5: Registry pull rate limit does not apply to deletes",
+			images:          []string{"foo:v2", "bar:v2"},
+			workType:        ImageCachePurge,
+			registryPullQPS: 0.001,
+			expectedJobs:    2,
+		},
+		{
+			name:           "#6: Maintenance window closed",
+			images:         []string{"foo:v2", "bar:v2"},
+			workType:       ImageCacheRefresh,
+			windows:        closedWindows,
+			expectedQueued: 2,
+		},
+		{
+			name:         "#7: Maintenance window closed, urgent request",
+			images:       []string{"foo:v2"},
+			workType:     ImageCacheCreate,
+			windows:      closedWindows,
+			urgent:       true,
+			expectedJobs: 1,
+		},
+		{
+			name:         "#8: Maintenance window closed, node warm-up",
+			images:       []string{"foo:v2"},
+			workType:     NodeWarmup,
+			windows:      closedWindows,
+			expectedJobs: 1,
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		created := 0
+		fakekubeclientset.AddReactor("create", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			job := action.(core.CreateAction).GetObject().(*batchv1.Job)
+			created++
+			job.Name = fmt.Sprintf("%s%d", job.GenerateName, created)
+			return true, job, nil
+		})
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent", "", false, "", false, "")
+		cfg := imagemanager.settings()
+		cfg.MaxConcurrentJobs = test.maxConcurrentJobs
+		cfg.RegistryPullQPS, cfg.RegistryPullBurst = test.registryPullQPS, 1
+		cfg.RegistryPullLimits = test.registryLimits
+		cfg.MaintenanceWindows = test.windows
+		imagemanager.UpdateConfiguration(&cfg)
+		for i := 0; i < test.runningJobs; i++ {
+			imagemanager.setResult(fmt.Sprintf("running-%d", i), running)
+		}
+		for _, image := range test.images {
+			imagemanager.imageworkqueue.Add(ImageWorkRequest{Image: image, Node: &node, WorkType: test.workType, Imagecache: imageCache,
+				Urgent: test.urgent})
+			imagemanager.processNextWorkItem()
+		}
+		jobs, queued := 0, 0
+		for _, iwres := range imagemanager.imageworkstatus {
+			switch iwres.Status {
+			case ImageWorkResultStatusJobCreated:
+				jobs++
+			case ImageWorkResultStatusQueued:
+				queued++
+				if iwres.ImageWorkRequest.Supersedes != "" {
+					t.Errorf("Test: %s failed: queued request supersedes %s", test.name, iwres.ImageWorkRequest.Supersedes)
+				}
+			}
+		}
+		if jobs -= test.runningJobs; jobs != test.expectedJobs || queued != test.expectedQueued {
+			t.Errorf("Test: %s failed: expectedJobs=%d, actual=%d, expectedQueued=%d, actual=%d",
+				test.name, test.expectedJobs, jobs, test.expectedQueued, queued)
+		}
+	}
+}
+
+func TestCancelSync(t *testing.T) {
+	imageCache := &fledgedv1alpha3.ImageCache{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace}}
+	fakekubeclientset := &fakeclientset.Clientset{}
+	deleted := make(chan string, 2)
+	fakekubeclientset.AddReactor("delete", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+		deleted <- action.(core.DeleteAction).GetName()
+		return true, nil, nil
+	})
+	created := 0
+	fakekubeclientset.AddReactor("create", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+		created++
+		return true, action.(core.CreateAction).GetObject(), nil
+	})
+	imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent", "", false, "", false, "")
+	request := func(syncID string) ImageWorkRequest {
+		return ImageWorkRequest{Image: "foo", Node: &node, WorkType: ImageCacheCreate, Imagecache: imageCache, SyncID: syncID}
+	}
+	for job, iwres := range map[string]ImageWorkResult{
+		"job1":                 {ImageWorkRequest: request("sync1"), Status: ImageWorkResultStatusJobCreated},
+		fakeJobPrefix + "job2": {ImageWorkRequest: request("sync1"), Status: ImageWorkResultStatusQueued},
+		"job3":                 {ImageWorkRequest: request("sync1"), Status: ImageWorkResultStatusSucceeded},
+		"job4":                 {ImageWorkRequest: request("sync2"), Status: ImageWorkResultStatusJobCreated},
+	} {
+		imagemanager.setResult(job, iwres)
+	}
+
+	if cancelled := imagemanager.CancelSync("sync1"); cancelled != 2 {
+		t.Errorf("Test: cancel sync failed: expected cancelled=2, actual=%d", cancelled)
+	}
+	expected := map[string]string{
+		"job1":                 ImageWorkResultStatusCancelled,
+		fakeJobPrefix + "job2": ImageWorkResultStatusCancelled,
+		"job3":                 ImageWorkResultStatusSucceeded,
+		"job4":                 ImageWorkResultStatusJobCreated,
+	}
+	for job, status := range expected {
+		if actual := imagemanager.imageworkstatus[job].Status; actual != status {
+			t.Errorf("Test: cancel sync failed: job %s expected status=%s, actual=%s", job, status, actual)
+		}
+	}
+	select {
+	case job := <-deleted:
+		if job != "job1" {
+			t.Errorf("Test: cancel sync failed: expected job1 deleted, actual=%s", job)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Test: cancel sync failed: running job not deleted")
+	}
+
+	// Requests of the cancelled sync action still in the work queue are dropped
+	imagemanager.imageworkqueue.Add(request("sync1"))
+	imagemanager.processNextWorkItem()
+	cancelled := 0
+	for _, iwres := range imagemanager.imageworkstatus {
+		if iwres.Status == ImageWorkResultStatusCancelled {
+			cancelled++
+		}
+	}
+	if created != 0 || cancelled != 3 {
+		t.Errorf("Test: cancel sync failed: expected jobs=0, cancelled=3, actual jobs=%d, cancelled=%d", created, cancelled)
+	}
+}
+
+func TestSyncCompletion(t *testing.T) {
+	tests := []struct {
+		name           string
+		pullDeadline   time.Duration
+		jobFinished    bool
+		expectedStatus string
+	}{
+		{
+			name:           "#1: Completed when the last job finished",
+			pullDeadline:   time.Hour,
+			jobFinished:    true,
+			expectedStatus: ImageWorkResultStatusSucceeded,
+		},
+		{
+			name:           "#2: Completed when the deadline passed",
+			pullDeadline:   10 * time.Millisecond,
+			expectedStatus: ImageWorkResultStatusUnknown,
+		},
+	}
+	for _, test := range tests {
+		puller := NewFakeImagePuller()
+		imagemanager, _ := newTestImageManagerWithPuller(&fakeclientset.Clientset{}, "IfNotPresent", "", false, "", false, "", puller)
+		imageCache := &fledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace},
+			Spec:       fledgedv1alpha3.ImageCacheSpec{PullDeadline: &metav1.Duration{Duration: test.pullDeadline}},
+		}
+		request := ImageWorkRequest{Image: "foo", Node: &node, WorkType: ImageCacheCreate, Imagecache: imageCache, SyncID: "sync1"}
+
+		imagemanager.lock.Lock()
+		imagemanager.recordResult("job1", ImageWorkResult{ImageWorkRequest: request, Status: ImageWorkResultStatusJobCreated, puller: puller})
+		imagemanager.lock.Unlock()
+		imagemanager.startSync(context.Background(), ImageWorkRequest{WorkType: ImageCacheCreate, Imagecache: imageCache,
+			SyncID: "sync1", Requests: 2})
+		// The sync action waits for the request which has not been processed yet
+		request.Image = "bar"
+		imagemanager.lock.Lock()
+		imagemanager.recordResult(fakeJobPrefix+"job2", ImageWorkResult{ImageWorkRequest: request, Status: ImageWorkResultStatusAlreadyPulled})
+		imagemanager.lock.Unlock()
+		if test.jobFinished {
+			if imagemanager.workqueue.Len() != 0 {
+				t.Errorf("Test: %s failed: sync completed before the job finished", test.name)
+			}
+			puller.Succeed("job1")
+		}
+
+		if err := wait.PollImmediate(time.Millisecond, time.Second, func() (bool, error) {
+			return imagemanager.workqueue.Len() == 1, nil
+		}); err != nil {
+			t.Errorf("Test: %s failed: results not sent", test.name)
+			continue
+		}
+		obj, _ := imagemanager.workqueue.Get()
+		wqKey := obj.(WorkQueueKey)
+		if wqKey.WorkType != ImageCacheStatusUpdate || len(*wqKey.Status) != 2 {
+			t.Errorf("Test: %s failed: unexpected status update %s with %d results", test.name, wqKey.WorkType, len(*wqKey.Status))
+		}
+		if actual := (*wqKey.Status)["job1"].Status; actual != test.expectedStatus {
+			t.Errorf("Test: %s failed: expectedStatus=%s, actual=%s", test.name, test.expectedStatus, actual)
+		}
+		imagemanager.lock.RLock()
+		if len(imagemanager.syncs) != 0 || len(imagemanager.imageworkstatus) != 0 || imagemanager.running != 0 {
+			t.Errorf("Test: %s failed: sync state not cleared, syncs=%d, results=%d, running=%d", test.name,
+				len(imagemanager.syncs), len(imagemanager.imageworkstatus), imagemanager.running)
+		}
+		imagemanager.lock.RUnlock()
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := &fledgedv1alpha3.RetryPolicy{
+		MaxAttempts:    4,
+		InitialBackoff: &metav1.Duration{Duration: 10 * time.Second},
+		MaxBackoff:     &metav1.Duration{Duration: 30 * time.Second},
+	}
+	for attempt, expected := range map[int32]time.Duration{1: 10 * time.Second, 2: 20 * time.Second, 3: 30 * time.Second} {
+		if actual := retryBackoff(policy, attempt); actual != expected {
+			t.Errorf("Test: retryBackoff failed for attempt %d: expected=%s, actual=%s", attempt, expected, actual)
+		}
+	}
+	// Every attempt gets the pull deadline, plus the backoffs of 10s, 20s and 30s
+	if actual := syncTimeout(time.Minute, policy); actual != 4*time.Minute+60*time.Second {
+		t.Errorf("Test: syncTimeout failed: actual=%s", actual)
+	}
+	if actual := syncTimeout(time.Minute, nil); actual != time.Minute {
+		t.Errorf("Test: syncTimeout without retry policy failed: actual=%s", actual)
+	}
+}
+
+func TestPullDeadline(t *testing.T) {
+	imageCache := &fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace},
+		Spec: fledgedv1alpha3.ImageCacheSpec{
+			CacheSpec: []fledgedv1alpha3.CacheSpecImages{{Images: []fledgedv1alpha3.Image{
+				{Name: "foo:v1"},
+				{Name: "model:v1", PullDeadline: &metav1.Duration{Duration: 3 * time.Hour}},
+				{Name: "model:v2", ForceFullCache: true, PullDeadline: &metav1.Duration{Duration: 2 * time.Hour}},
+			}}},
+		},
+	}
+	tests := []struct {
+		name                 string
+		image                string
+		forceFullCache       bool
+		cachePullDeadline    *metav1.Duration
+		expectedJobDeadline  int64
+		expectedSyncDeadline time.Duration
+	}{
+		{
+			name:                 "#1: No pull deadline, jobs keep the default of one hour",
+			image:                "foo:v1",
+			expectedJobDeadline:  3600,
+			expectedSyncDeadline: 3 * time.Hour,
+		},
+		{
+			name:                 "#2: Pull deadline of the image cache",
+			image:                "foo:v1",
+			cachePullDeadline:    &metav1.Duration{Duration: 30 * time.Second},
+			expectedJobDeadline:  30,
+			expectedSyncDeadline: 3 * time.Hour,
+		},
+		{
+			name:                 "#3: Pull deadline of the image overrides the image cache",
+			image:                "model:v1",
+			cachePullDeadline:    &metav1.Duration{Duration: 30 * time.Second},
+			expectedJobDeadline:  10800,
+			expectedSyncDeadline: 3 * time.Hour,
+		},
+		{
+			name:                 "#4: Pull deadline of a fully cached image",
+			image:                "model:v2",
+			forceFullCache:       true,
+			cachePullDeadline:    &metav1.Duration{Duration: 4 * time.Hour},
+			expectedJobDeadline:  7200,
+			expectedSyncDeadline: 4 * time.Hour,
+		},
+	}
+	for _, test := range tests {
+		ic := imageCache.DeepCopy()
+		ic.Spec.PullDeadline = test.cachePullDeadline
+		job, err := newImagePullJob(ic, test.image, test.forceFullCache, &node, "IfNotPresent", "busybox", "", "")
+		if err != nil {
+			t.Errorf("Test: %s failed: err=%v", test.name, err)
+			continue
+		}
+		if actual := *job.Spec.ActiveDeadlineSeconds; actual != test.expectedJobDeadline {
+			t.Errorf("Test: %s failed: expectedJobDeadline=%d, actual=%d", test.name, test.expectedJobDeadline, actual)
+		}
+		job, _ = newImageDeleteJob(ic, test.image, &node, "containerd://1.6.8", "", "", false, "", "")
+		if actual := *job.Spec.ActiveDeadlineSeconds; actual != test.expectedJobDeadline {
+			t.Errorf("Test: %s failed: expectedDeleteJobDeadline=%d, actual=%d", test.name, test.expectedJobDeadline, actual)
+		}
+		if actual := syncPullDeadline(ic, 5*time.Minute); actual != test.expectedSyncDeadline {
+			t.Errorf("Test: %s failed: expectedSyncDeadline=%s, actual=%s", test.name, test.expectedSyncDeadline, actual)
+		}
+	}
+}
+
+func TestJobPullerStatus(t *testing.T) {
+	pod := func(name string, status corev1.PodStatus) corev1.Pod {
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: fledgedNameSpace,
+				Labels:    map[string]string{"job-name": "fakejob"},
+			},
+			Status: status,
+		}
+	}
+	tests := []struct {
+		name                string
+		pods                []corev1.Pod
+		expectedStatus      string
+		expectedReason      string
+		expectError         bool
+		expectedErrorString string
+	}{
+		{
+			name:           "#1: No pod matched job",
+			expectedStatus: ImageWorkResultStatusUnknown,
+			expectedReason: "No pods matched job fakejob",
+		},
+		{
+			name: "#2: Pod pending, container waiting",
+			pods: []corev1.Pod{pod("pod1", corev1.PodStatus{
+				Phase: corev1.PodPending,
+				ContainerStatuses: []corev1.ContainerStatus{
+					{State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "fakereason", Message: "fakemessage"}}},
+				},
+			})},
+			expectedStatus: ImageWorkResultStatusFailed,
+			expectedReason: "fakereason",
+		},
+		{
+			name: "#3: Pod pending, container terminated",
+			pods: []corev1.Pod{pod("pod1", corev1.PodStatus{
+				Phase: corev1.PodPending,
+				ContainerStatuses: []corev1.ContainerStatus{
+					{State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "fakereason", Message: "fakemessage"}}},
+				},
+			})},
+			expectedStatus: ImageWorkResultStatusFailed,
+			expectedReason: "fakereason",
+		},
+		{
+			name:           "#4: Pod pending (Node not ready, hence empty containerstatuses)",
+			pods:           []corev1.Pod{pod("pod1", corev1.PodStatus{Phase: corev1.PodPending})},
+			expectedStatus: ImageWorkResultStatusFailed,
+			expectedReason: "Pending",
+		},
+		{
+			name:                "#5: More than one pod matched job",
+			pods:                []corev1.Pod{pod("pod1", corev1.PodStatus{}), pod("pod2", corev1.PodStatus{})},
+			expectError:         true,
+			expectedErrorString: "more than one pod matched job",
+		},
+	}
+	for _, test := range tests {
+		imagemanager, podInformer := newTestImageManager(&fakeclientset.Clientset{}, "IfNotPresent", "sa-kube-fledged", false,
+			"priority-class-kube-fledged", false, "")
+		for i := range test.pods {
+			podInformer.Informer().GetIndexer().Add(&test.pods[i])
+		}
+		iwres, err := imagemanager.jobs.Status("fakejob", ImageWorkResult{
+			ImageWorkRequest: ImageWorkRequest{
+				Imagecache: &fledgedv1alpha3.ImageCache{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace}},
+				Node:       &node,
 			},
-			pods: []corev1.Pod{
+			Status: ImageWorkResultStatusJobCreated,
+		})
+		if test.expectError {
+			if err == nil || !strings.HasPrefix(err.Error(), test.expectedErrorString) {
+				t.Errorf("Test: %s failed: expectedError=%s, actualError=%v", test.name, test.expectedErrorString, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		if iwres.Status != test.expectedStatus || iwres.Reason != test.expectedReason {
+			t.Errorf("Test: %s failed: expected status=%s, reason=%s, actual status=%s, reason=%s", test.name,
+				test.expectedStatus, test.expectedReason, iwres.Status, iwres.Reason)
+		}
+	}
+}
+
+func TestUpdateImageCacheStatus(t *testing.T) {
+	imageCacheName := "fakeimagecache"
+	imageCache := &fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: imageCacheName,
+		}}
+	running := ImageWorkResult{
+		ImageWorkRequest: ImageWorkRequest{
+			WorkType: ImageCacheCreate,
+			Imagecache: &fledgedv1alpha3.ImageCache{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: imageCacheName,
+				},
+			},
+			Node: &node,
+		},
+		Status: ImageWorkResultStatusJobCreated,
+	}
+	purging := running
+	purging.ImageWorkRequest.WorkType = ImageCachePurge
+	succeeded := running
+	succeeded.Status = ImageWorkResultStatusSucceeded
+	tests := []struct {
+		name                string
+		iwres               ImageWorkResult
+		status              *ImageWorkResult
+		statusErr           error
+		expectedStatus      string
+		expectedReason      string
+		expectedMessage     string
+	}{
+		{
+			name:           "#1: Successful",
+			iwres:          succeeded,
+			expectedStatus: ImageWorkResultStatusSucceeded,
+		},
+		{
+			name:  "#2: Create - Successful",
+			iwres: running,
+			status: &ImageWorkResult{Status: ImageWorkResultStatusFailed, Reason: "fakereason",
+				Message: "fakemessage"},
+			expectedStatus: ImageWorkResultStatusFailed,
+			expectedReason: "fakereason",
+		},
+		{
+			name:           "#3: Create - Successful (status of the work unknown)",
+			iwres:          running,
+			expectedStatus: ImageWorkResultStatusUnknown,
+		},
+		{
+			name:  "#4: Purge - Successful",
+			iwres: purging,
+			status: &ImageWorkResult{Status: ImageWorkResultStatusFailed, Reason: "fakereason",
+				Message: "fakemessage"},
+			expectedStatus: ImageWorkResultStatusFailed,
+			expectedReason: "fakereason",
+		},
+		{
+			name:           "#5: Purge - Successful (status of the work unknown)",
+			iwres:          purging,
+			expectedStatus: ImageWorkResultStatusUnknown,
+		},
+		{
+			name:            "#6: Purge - Successful (status of the work cannot be read)",
+			iwres:           purging,
+			statusErr:       fmt.Errorf("fake error"),
+			expectedStatus:  ImageWorkResultStatusUnknown,
+			expectedReason:  fledgedv1alpha3.ImageCacheReasonImagePullStatusUnknown,
+			expectedMessage: "fake error",
+		},
+		{
+			name:           "#7: Create - Successful (work finished before the deadline)",
+			iwres:          succeeded,
+			status:         &ImageWorkResult{Status: ImageWorkResultStatusFailed},
+			expectedStatus: ImageWorkResultStatusSucceeded,
+		},
+	}
+
+	for _, test := range tests {
+		puller := NewFakeImagePuller()
+		if test.status != nil {
+			puller.SetStatus(test.status.Status, test.status.Reason, test.status.Message)
+		}
+		puller.SetStatusError(test.statusErr)
+		imagemanager, _ := newTestImageManagerWithPuller(&fakeclientset.Clientset{}, "IfNotPresent", "sa-kube-fledged", false,
+			"priority-class-kube-fledged", false, "", puller)
+		iwres := test.iwres
+		iwres.puller = puller
+		imagemanager.setResult("fakejob", iwres)
+		imagemanager.updateImageCacheStatus(context.Background(), ImageWorkRequest{Imagecache: imageCache})
+		if err := wait.PollImmediate(time.Millisecond, time.Second, func() (bool, error) {
+			return imagemanager.workqueue.Len() == 1, nil
+		}); err != nil {
+			t.Errorf("Test: %s failed: status update not queued", test.name)
+			continue
+		}
+		obj, _ := imagemanager.workqueue.Get()
+		actual := (*obj.(WorkQueueKey).Status)["fakejob"]
+		if actual.Status != test.expectedStatus || actual.Reason != test.expectedReason {
+			t.Errorf("Test: %s failed: expected status=%s, reason=%s, actual status=%s, reason=%s", test.name,
+				test.expectedStatus, test.expectedReason, actual.Status, actual.Reason)
+		}
+		if !strings.Contains(actual.Message, test.expectedMessage) {
+			t.Errorf("Test: %s failed: expected message=%s, actual message=%s", test.name,
+				test.expectedMessage, actual.Message)
+		}
+	}
+}
+
+func TestProcessNextWorkItem(t *testing.T) {
+	defaultImageCache := fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+		Spec: fledgedv1alpha3.ImageCacheSpec{
+			CacheSpec: []fledgedv1alpha3.CacheSpecImages{
 				{
-					ObjectMeta: metav1.ObjectMeta{
-						Namespace: fledgedNameSpace,
-						Labels:    map[string]string{"job-name": "fakejob"},
-					},
-					Status: corev1.PodStatus{
-						Phase: corev1.PodPending,
-						ContainerStatuses: []corev1.ContainerStatus{
-							{
-								State: corev1.ContainerState{
-									Terminated: &corev1.ContainerStateTerminated{
-										Reason:  "fakereason",
-										Message: "fakemessage",
-									},
-								},
-							},
+					Images: []fledgedv1alpha3.Image{
+						{
+							Name:           "foo",
+							ForceFullCache: false,
 						},
 					},
 				},
 			},
+		},
+	}
+	testnode := node
+	testnode.Status.Images = []corev1.ContainerImage{
+		{
+			Names: []string{"foo:v1"},
+		},
+	}
+	tests := []struct {
+		name            string
+		iwr             ImageWorkRequest
+		unexpectedType  bool
+		imagepullpolicy string
+		expectedPulls   int
+		expectedRemoves int
+		expectedStatus  string
+	}{
+		{
+			name: "#1: Create - Successful",
+			iwr: ImageWorkRequest{
+				Image:      "fakeimage",
+				Node:       &node,
+				WorkType:   ImageCacheCreate,
+				Imagecache: &defaultImageCache,
+			},
 			imagepullpolicy: "IfNotPresent",
-			expectError:     false,
+			expectedPulls:   1,
+			expectedStatus:  ImageWorkResultStatusJobCreated,
 		},
 		{
 			name: "#2: Purge - Successful",
@@ -744,40 +1588,8 @@ func TestProcessNextWorkItem(t *testing.T) {
 				WorkType:   ImageCachePurge,
 				Imagecache: &defaultImageCache,
 			},
-			imageworkstatus: map[string]ImageWorkResult{
-				"fakejob": {
-					ImageWorkRequest: ImageWorkRequest{
-						Imagecache: &fledgedv1alpha3.ImageCache{
-							ObjectMeta: metav1.ObjectMeta{
-								Name: defaultImageCache.Name,
-							},
-						},
-					},
-					Status: ImageWorkResultStatusSucceeded,
-				},
-			},
-			pods: []corev1.Pod{
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Namespace: fledgedNameSpace,
-						Labels:    map[string]string{"job-name": "fakejob"},
-					},
-					Status: corev1.PodStatus{
-						Phase: corev1.PodPending,
-						ContainerStatuses: []corev1.ContainerStatus{
-							{
-								State: corev1.ContainerState{
-									Terminated: &corev1.ContainerStateTerminated{
-										Reason:  "fakereason",
-										Message: "fakemessage",
-									},
-								},
-							},
-						},
-					},
-				},
-			},
-			expectError: false,
+			expectedRemoves: 1,
+			expectedStatus:  ImageWorkResultStatusJobCreated,
 		},
 		{
 			name: "#3: Statusupdate - Successful",
@@ -785,45 +1597,10 @@ func TestProcessNextWorkItem(t *testing.T) {
 				WorkType:   ImageCacheCreate,
 				Imagecache: &defaultImageCache,
 			},
-			imageworkstatus: map[string]ImageWorkResult{
-				"fakejob": {
-					ImageWorkRequest: ImageWorkRequest{
-						Imagecache: &fledgedv1alpha3.ImageCache{
-							ObjectMeta: metav1.ObjectMeta{
-								Name: defaultImageCache.Name,
-							},
-						},
-					},
-					Status: ImageWorkResultStatusSucceeded,
-				},
-			},
-			pods: []corev1.Pod{
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Namespace: fledgedNameSpace,
-						Labels:    map[string]string{"job-name": "fakejob"},
-					},
-					Status: corev1.PodStatus{
-						Phase: corev1.PodPending,
-						ContainerStatuses: []corev1.ContainerStatus{
-							{
-								State: corev1.ContainerState{
-									Terminated: &corev1.ContainerStateTerminated{
-										Reason:  "fakereason",
-										Message: "fakemessage",
-									},
-								},
-							},
-						},
-					},
-				},
-			},
-			expectError: false,
 		},
 		{
-			name:                "#4: Create - Unsuccessful",
-			expectError:         false,
-			expectedErrorString: "Unexpected type in workqueue",
+			name:           "#4: Create - Unsuccessful",
+			unexpectedType: true,
 		},
 		{
 			name: "#5: Create - Successful (Image not present in Node)",
@@ -833,41 +1610,9 @@ func TestProcessNextWorkItem(t *testing.T) {
 				WorkType:   ImageCacheCreate,
 				Imagecache: &defaultImageCache,
 			},
-			imageworkstatus: map[string]ImageWorkResult{
-				"fakejob": {
-					ImageWorkRequest: ImageWorkRequest{
-						Imagecache: &fledgedv1alpha3.ImageCache{
-							ObjectMeta: metav1.ObjectMeta{
-								Name: defaultImageCache.Name,
-							},
-						},
-					},
-					Status: ImageWorkResultStatusSucceeded,
-				},
-			},
-			pods: []corev1.Pod{
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Namespace: fledgedNameSpace,
-						Labels:    map[string]string{"job-name": "fakejob"},
-					},
-					Status: corev1.PodStatus{
-						Phase: corev1.PodPending,
-						ContainerStatuses: []corev1.ContainerStatus{
-							{
-								State: corev1.ContainerState{
-									Terminated: &corev1.ContainerStateTerminated{
-										Reason:  "fakereason",
-										Message: "fakemessage",
-									},
-								},
-							},
-						},
-					},
-				},
-			},
 			imagepullpolicy: "IfNotPresent",
-			expectError:     false,
+			expectedPulls:   1,
+			expectedStatus:  ImageWorkResultStatusJobCreated,
 		},
 		{
 			name: "#6: Create - Successful (Image already present in Node)",
@@ -877,68 +1622,44 @@ func TestProcessNextWorkItem(t *testing.T) {
 				WorkType:   ImageCacheCreate,
 				Imagecache: &defaultImageCache,
 			},
-			imageworkstatus: map[string]ImageWorkResult{
-				"fakejob": {
-					ImageWorkRequest: ImageWorkRequest{
-						Imagecache: &fledgedv1alpha3.ImageCache{
-							ObjectMeta: metav1.ObjectMeta{
-								Name: defaultImageCache.Name,
-							},
-						},
-					},
-					Status: ImageWorkResultStatusSucceeded,
-				},
-			},
-			pods: []corev1.Pod{
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Namespace: fledgedNameSpace,
-						Labels:    map[string]string{"job-name": "fakejob"},
-					},
-					Status: corev1.PodStatus{
-						Phase: corev1.PodPending,
-						ContainerStatuses: []corev1.ContainerStatus{
-							{
-								State: corev1.ContainerState{
-									Terminated: &corev1.ContainerStateTerminated{
-										Reason:  "fakereason",
-										Message: "fakemessage",
-									},
-								},
-							},
-						},
-					},
-				},
-			},
 			imagepullpolicy: "IfNotPresent",
-			expectError:     false,
+			expectedStatus:  ImageWorkResultStatusAlreadyPulled,
 		},
 	}
 	for _, test := range tests {
-		fakekubeclientset := &fakeclientset.Clientset{}
-		imagemanager, podInformer := newTestImageManager(fakekubeclientset, test.imagepullpolicy, "sa-kube-fledged", false,
-			"priority-class-kube-fledged", false, "")
-		for _, pod := range test.pods {
-			if !reflect.DeepEqual(pod, corev1.Pod{}) {
-				podInformer.Informer().GetIndexer().Add(&pod)
-			}
-		}
-		imagemanager.imageworkstatus = test.imageworkstatus
-		if test.expectedErrorString == "Unexpected type in workqueue" {
+		puller := NewFakeImagePuller()
+		imagemanager, _ := newTestImageManagerWithPuller(&fakeclientset.Clientset{}, test.imagepullpolicy, "sa-kube-fledged", false,
+			"priority-class-kube-fledged", false, "", puller)
+		if test.unexpectedType {
 			imagemanager.imageworkqueue.Add(struct{}{})
+		} else {
+			imagemanager.imageworkqueue.Add(test.iwr)
 		}
-		imagemanager.imageworkqueue.Add(test.iwr)
 		imagemanager.processNextWorkItem()
-		var err error
-		if test.expectError {
-			if err == nil {
-				t.Errorf("Test: %s failed: expectedError=%s, actualError=nil", test.name, test.expectedErrorString)
+
+		pulls, removes := puller.Pulls(), puller.Removes()
+		if len(pulls) != test.expectedPulls || len(removes) != test.expectedRemoves {
+			t.Errorf("Test: %s failed: expected pulls=%d, removes=%d, actual pulls=%d, removes=%d", test.name,
+				test.expectedPulls, test.expectedRemoves, len(pulls), len(removes))
+			continue
+		}
+		if test.expectedStatus == "" {
+			if len(imagemanager.imageworkstatus) != 0 {
+				t.Errorf("Test: %s failed: unexpected results %+v", test.name, imagemanager.imageworkstatus)
 			}
-			if err != nil && !strings.HasPrefix(err.Error(), test.expectedErrorString) {
-				t.Errorf("Test: %s failed: expectedError=%s, actualError=%s", test.name, test.expectedErrorString, err.Error())
+			continue
+		}
+		if len(imagemanager.imageworkstatus) != 1 {
+			t.Errorf("Test: %s failed: expected 1 result, actual=%d", test.name, len(imagemanager.imageworkstatus))
+			continue
+		}
+		for job, iwres := range imagemanager.imageworkstatus {
+			if iwres.Status != test.expectedStatus {
+				t.Errorf("Test: %s failed: expectedStatus=%s, actual=%s", test.name, test.expectedStatus, iwres.Status)
+			}
+			if iwres.Status == ImageWorkResultStatusJobCreated && !reflect.DeepEqual(append(pulls, removes...), []string{job}) {
+				t.Errorf("Test: %s failed: unexpected job %s", test.name, job)
 			}
-		} else if err != nil {
-			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
 		}
 	}
 }
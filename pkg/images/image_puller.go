@@ -0,0 +1,74 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"context"
+	"strings"
+)
+
+// ImagePuller pulls images to and removes images from the nodes. Pull and
+// Remove start the work and return its name, by which the result is recorded.
+// The puller records the result with finishJob once the work finished.
+type ImagePuller interface {
+	// Pull starts pulling the image of the request to its node
+	Pull(ctx context.Context, iwr ImageWorkRequest) (string, error)
+	// Remove starts removing the image of the request from its node
+	Remove(ctx context.Context, iwr ImageWorkRequest) (string, error)
+	// Status returns the result of work which did not finish before the
+	// deadline of its sync action
+	Status(name string, iwres ImageWorkResult) (ImageWorkResult, error)
+	// Cleanup deletes what was created for the work
+	Cleanup(namespace, name string)
+}
+
+// imageManagerBinder is implemented by the image pullers passed to
+// NewImageManager, which record their results with the image manager
+type imageManagerBinder interface {
+	bind(m *ImageManager)
+}
+
+// pullerFor returns the image puller which carries out the request. Pins and
+// the pulls which copy image content to the node need a job.
+func (m *ImageManager) pullerFor(iwr ImageWorkRequest) ImagePuller {
+	if iwr.Pin || iwr.ForceFullCache || strings.Contains(iwr.Image, "modelzai") {
+		return m.jobs
+	}
+	return m.puller
+}
+
+// pullerOf returns the image puller which carries out the work of the result,
+// the job puller if none was recorded
+func (m *ImageManager) pullerOf(iwres ImageWorkResult) ImagePuller {
+	if iwres.puller == nil {
+		return m.jobs
+	}
+	return iwres.puller
+}
+
+// runningWork returns the result of the work the puller carries out, false if
+// there is none or the work is not running any more, e.g. when it has been
+// recorded already or cancelled. Work of another puller may have the same name.
+func (m *ImageManager) runningWork(p ImagePuller, name string) (ImageWorkResult, bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	iwres, ok := m.imageworkstatus[name]
+	if !ok || m.pullerOf(iwres) != p || iwres.Status != ImageWorkResultStatusJobCreated {
+		return ImageWorkResult{}, false
+	}
+	return iwres, true
+}
@@ -0,0 +1,225 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	fledgedv1alpha3 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	informers "github.com/senthilrch/kube-fledged/pkg/client/informers/externalversions"
+	"github.com/senthilrch/kube-fledged/pkg/config"
+	"github.com/senthilrch/kube-fledged/pkg/tracing"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// ImageTaskNodeLabel is set on image tasks to the hostname of their node, so
+// that the agent on the node only watches its own tasks
+const ImageTaskNodeLabel = "kubefledged.io/node"
+
+// agentPuller hands image pulls and deletes to kubefledged-agent on the
+// nodes through image tasks, whose status tells the result
+type agentPuller struct {
+	m               *ImageManager
+	informerFactory informers.SharedInformerFactory
+	tasksSynced     cache.InformerSynced
+}
+
+// newAgentPuller returns an agent puller which watches the image tasks
+func newAgentPuller(m *ImageManager, cfg *config.ControllerConfiguration, labelSelector labels.Selector) *agentPuller {
+	p := &agentPuller{m: m}
+	p.informerFactory = informers.NewSharedInformerFactoryWithOptions(
+		m.fledgedclientset,
+		time.Second*30,
+		informers.WithNamespace(cfg.SingleWatchNamespace()),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = labelSelector.String()
+		}))
+	taskInformer := p.informerFactory.Kubefledged().V1alpha3().ImageTasks()
+	p.tasksSynced = taskInformer.Informer().HasSynced
+	taskInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			p.handleImageTaskStatusChange(obj.(*fledgedv1alpha3.ImageTask))
+		},
+		UpdateFunc: func(old, new interface{}) {
+			newTask := new.(*fledgedv1alpha3.ImageTask)
+			if newTask.ResourceVersion == old.(*fledgedv1alpha3.ImageTask).ResourceVersion {
+				return
+			}
+			p.handleImageTaskStatusChange(newTask)
+		},
+		DeleteFunc: func(obj interface{}) {
+			task, ok := obj.(*fledgedv1alpha3.ImageTask)
+			if !ok {
+				tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+				if !ok {
+					return
+				}
+				if task, ok = tombstone.Obj.(*fledgedv1alpha3.ImageTask); !ok {
+					return
+				}
+			}
+			p.handleImageTaskDeleted(task)
+		},
+	})
+	return p
+}
+
+// newImageTask constructs an image task asking the agent on the node to pull
+// or remove the image
+func newImageTask(imagecache *fledgedv1alpha3.ImageCache, image string, node *corev1.Node,
+	action fledgedv1alpha3.ImageTaskAction, imagePullPolicy string) (*fledgedv1alpha3.ImageTask, error) {
+	if imagecache == nil {
+		klog.ErrorS(nil, "imagecache pointer is nil", "image", image)
+		return nil, fmt.Errorf("imagecache pointer is nil")
+	}
+	activeDeadlineSeconds := jobActiveDeadlineSeconds(imagecache, image)
+	task := &fledgedv1alpha3.ImageTask{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: imagecache.Name + "-",
+			Namespace:    imagecache.Namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(imagecache, schema.GroupVersionKind{
+					Group:   fledgedv1alpha3.SchemeGroupVersion.Group,
+					Version: fledgedv1alpha3.SchemeGroupVersion.Version,
+					Kind:    "ImageCache",
+				}),
+			},
+			Labels: map[string]string{
+				"app":              "kubefledged",
+				"kubefledged":      "kubefledged-image-manager",
+				"imagecache":       imagecache.Name,
+				"controller":       controllerAgentName,
+				ImageTaskNodeLabel: NodeHostname(node),
+			},
+		},
+		Spec: fledgedv1alpha3.ImageTaskSpec{
+			NodeName:              node.Name,
+			Action:                action,
+			Image:                 image,
+			ImagePullSecrets:      imagecache.Spec.ImagePullSecrets,
+			ActiveDeadlineSeconds: &activeDeadlineSeconds,
+		},
+	}
+	if action == fledgedv1alpha3.ImageTaskActionPull {
+		task.Spec.ImagePullPolicy = pullPolicy(imagePullPolicy, image)
+	}
+	return task, nil
+}
+
+// createImageTask creates an image task for the request and returns its name
+func (p *agentPuller) createImageTask(ctx context.Context, iwr ImageWorkRequest,
+	action fledgedv1alpha3.ImageTaskAction) (string, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "ImageManager.createImageTask", trace.WithAttributes(iwr.spanAttributes()...))
+	defer span.End()
+	newtask, err := newImageTask(iwr.Imagecache, iwr.Image, iwr.Node, action, p.m.settings().ImagePullPolicy)
+	if err != nil {
+		klog.ErrorS(err, "Error constructing image task", iwr.logValues()...)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return "", err
+	}
+	task, err := p.m.fledgedclientset.KubefledgedV1alpha3().ImageTasks(iwr.Imagecache.Namespace).Create(ctx, newtask, metav1.CreateOptions{})
+	if err != nil {
+		klog.ErrorS(err, "Error creating image task", iwr.logValues()...)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return "", err
+	}
+	span.SetAttributes(tracing.AttrJob.String(task.Name))
+	return task.Name, nil
+}
+
+// Pull creates an image task to pull the image into the node
+func (p *agentPuller) Pull(ctx context.Context, iwr ImageWorkRequest) (string, error) {
+	return p.createImageTask(ctx, iwr, fledgedv1alpha3.ImageTaskActionPull)
+}
+
+// Remove creates an image task to remove the image from the node
+func (p *agentPuller) Remove(ctx context.Context, iwr ImageWorkRequest) (string, error) {
+	return p.createImageTask(ctx, iwr, fledgedv1alpha3.ImageTaskActionRemove)
+}
+
+// Status reports an image task which the agent did not finish in time as
+// failed, e.g. because no agent runs on the node
+func (p *agentPuller) Status(task string, iwres ImageWorkResult) (ImageWorkResult, error) {
+	klog.InfoS("Image task not finished before deadline", append(iwres.ImageWorkRequest.logValues(), "task", task)...)
+	iwres.Status = ImageWorkResultStatusFailed
+	iwres.Reason = fledgedv1alpha3.ImageCacheReasonImageTaskNotFinished
+	iwres.Message = fledgedv1alpha3.ImageCacheMessageImageTaskNotFinished
+	return iwres, nil
+}
+
+// handleImageTaskStatusChange records the result of an image task once the
+// agent finished it
+func (p *agentPuller) handleImageTaskStatusChange(task *fledgedv1alpha3.ImageTask) {
+	if task.Status.Phase == "" {
+		return
+	}
+	iwres, ok := p.m.runningWork(p, task.Name)
+	if !ok {
+		return
+	}
+	if task.Status.Phase == fledgedv1alpha3.ImageTaskPhaseSucceeded {
+		iwres.Status = ImageWorkResultStatusSucceeded
+		klog.InfoS("Image task succeeded", append(iwres.ImageWorkRequest.logValues(), "task", task.Name,
+			"reason", task.Status.Reason)...)
+	} else {
+		iwres.Status = ImageWorkResultStatusFailed
+		iwres.Reason, iwres.Message = task.Status.Reason, task.Status.Message
+		klog.InfoS("Image task failed", append(iwres.ImageWorkRequest.logValues(), "task", task.Name,
+			"reason", iwres.Reason)...)
+	}
+	p.m.finishJob(task.Name, iwres, nil)
+}
+
+// handleImageTaskDeleted records an image task which was deleted before the
+// agent finished it as failed
+func (p *agentPuller) handleImageTaskDeleted(task *fledgedv1alpha3.ImageTask) {
+	if task.Status.Phase != "" {
+		p.handleImageTaskStatusChange(task)
+		return
+	}
+	iwres, ok := p.m.runningWork(p, task.Name)
+	if !ok {
+		return
+	}
+	iwres.Status = ImageWorkResultStatusFailed
+	iwres.Reason = fledgedv1alpha3.ImageCacheReasonImageTaskDeleted
+	iwres.Message = fledgedv1alpha3.ImageCacheMessageImageTaskDeleted
+	klog.InfoS("Image task deleted before it finished", append(iwres.ImageWorkRequest.logValues(), "task", task.Name)...)
+	p.m.finishJob(task.Name, iwres, nil)
+}
+
+// Cleanup deletes the image task
+func (p *agentPuller) Cleanup(namespace, task string) {
+	err := p.m.fledgedclientset.KubefledgedV1alpha3().ImageTasks(namespace).Delete(context.TODO(), task, metav1.DeleteOptions{})
+	if apierrors.IsNotFound(err) {
+		klog.InfoS("Image task to be deleted not found", "task", task, "namespace", namespace)
+	} else if err != nil {
+		klog.ErrorS(err, "Error deleting image task", "task", task, "namespace", namespace)
+	}
+}
@@ -0,0 +1,271 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	fledgedv1alpha3 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	"github.com/senthilrch/kube-fledged/pkg/tracing"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	batchinformers "k8s.io/client-go/informers/batch/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// jobPuller pulls and removes images with a job per image and node. It is the
+// default image puller, and pins images whichever puller is selected.
+type jobPuller struct {
+	m *ImageManager
+}
+
+// newJobPuller returns a job puller which records the results of the jobs
+// watched by the informer
+func newJobPuller(m *ImageManager, jobInformer batchinformers.JobInformer) *jobPuller {
+	p := &jobPuller{m: m}
+	// The conditions of the jobs tell whether images were pulled or deleted, the
+	// pods of the jobs are only looked up for the reason of a failure
+	jobInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			p.handleJobStatusChange(obj.(*batchv1.Job))
+		},
+		UpdateFunc: func(old, new interface{}) {
+			newJob := new.(*batchv1.Job)
+			oldJob := old.(*batchv1.Job)
+			if newJob.ResourceVersion == oldJob.ResourceVersion {
+				// Periodic resync will send update events for all known Jobs.
+				// Two different versions of the same Job will always have different RVs.
+				return
+			}
+			p.handleJobStatusChange(newJob)
+		},
+		DeleteFunc: func(obj interface{}) {
+			job, ok := obj.(*batchv1.Job)
+			if !ok {
+				tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+				if !ok {
+					return
+				}
+				if job, ok = tombstone.Obj.(*batchv1.Job); !ok {
+					return
+				}
+			}
+			p.handleJobDeleted(job)
+		},
+	})
+	return p
+}
+
+// finishedCondition returns the Complete or Failed condition of the job, nil
+// while the job is active
+func finishedCondition(job *batchv1.Job) *batchv1.JobCondition {
+	for i := range job.Status.Conditions {
+		condition := &job.Status.Conditions[i]
+		if (condition.Type == batchv1.JobComplete || condition.Type == batchv1.JobFailed) &&
+			condition.Status == corev1.ConditionTrue {
+			return condition
+		}
+	}
+	return nil
+}
+
+// jobPod returns the pod of the job from the informer cache, nil if there is none
+func (p *jobPuller) jobPod(job *batchv1.Job) *corev1.Pod {
+	pods, err := p.m.podsLister.Pods(job.Namespace).List(labels.Set(map[string]string{"job-name": job.Name}).AsSelector())
+	if err != nil || len(pods) == 0 {
+		return nil
+	}
+	return pods[0]
+}
+
+// jobFailure returns the reason and message of a failed job. The state of the
+// container tells why the image could not be pulled or deleted, the pod why it
+// did not run, e.g. when it was evicted, otherwise the condition of the job
+// tells, e.g. when the deadline was exceeded before the pod got scheduled.
+func jobFailure(condition *batchv1.JobCondition, pod *corev1.Pod) (string, string) {
+	if pod != nil && len(pod.Status.ContainerStatuses) == 1 {
+		state := pod.Status.ContainerStatuses[0].State
+		if state.Terminated != nil {
+			return state.Terminated.Reason, state.Terminated.Message
+		}
+		if state.Waiting != nil {
+			return state.Waiting.Reason, state.Waiting.Message
+		}
+	}
+	if pod != nil && pod.Status.Reason != "" {
+		return pod.Status.Reason, pod.Status.Message
+	}
+	if condition.Reason != "" {
+		return condition.Reason, condition.Message
+	}
+	return fledgedv1alpha3.ImageCacheReasonImagePullStatusUnknown, fledgedv1alpha3.ImageCacheMessageImagePullStatusUnknown
+}
+
+// handleJobStatusChange records the result of a job once it completed or failed
+func (p *jobPuller) handleJobStatusChange(job *batchv1.Job) {
+	condition := finishedCondition(job)
+	if condition == nil {
+		return
+	}
+	// Corresponding job might have expired and got deleted, or been recorded
+	// already. Ignore status changes of such jobs, and of jobs deleted on cancel.
+	iwres, ok := p.m.runningWork(p, job.Name)
+	if !ok {
+		return
+	}
+	klog.V(4).InfoS("Job finished", "job", klog.KObj(job), "condition", condition.Type)
+
+	pod := p.jobPod(job)
+	if condition.Type == batchv1.JobComplete {
+		iwres.Status = ImageWorkResultStatusSucceeded
+		klog.InfoS("Job succeeded", append(iwres.ImageWorkRequest.logValues(), "job", job.Name,
+			"runtime", iwres.ImageWorkRequest.ContainerRuntimeVersion)...)
+	} else {
+		iwres.Status = ImageWorkResultStatusFailed
+		iwres.Reason, iwres.Message = jobFailure(condition, pod)
+		klog.InfoS("Job failed", append(iwres.ImageWorkRequest.logValues(), "job", job.Name,
+			"reason", iwres.Reason)...)
+	}
+	p.m.finishJob(job.Name, iwres, pod)
+}
+
+// handleJobDeleted records a job which was deleted before it finished as failed
+func (p *jobPuller) handleJobDeleted(job *batchv1.Job) {
+	if finishedCondition(job) != nil {
+		// The last status change of the job might not have been seen
+		p.handleJobStatusChange(job)
+		return
+	}
+	iwres, ok := p.m.runningWork(p, job.Name)
+	if !ok {
+		return
+	}
+	iwres.Status = ImageWorkResultStatusFailed
+	iwres.Reason = fledgedv1alpha3.ImageCacheReasonJobDeleted
+	iwres.Message = fledgedv1alpha3.ImageCacheMessageJobDeleted
+	klog.InfoS("Job deleted before it finished", append(iwres.ImageWorkRequest.logValues(), "job", job.Name)...)
+	p.m.finishJob(job.Name, iwres, nil)
+}
+
+// createJob creates the job and returns its name
+func (p *jobPuller) createJob(ctx context.Context, iwr ImageWorkRequest, newjob *batchv1.Job, err error) (string, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "ImageManager.createJob", trace.WithAttributes(iwr.spanAttributes()...))
+	defer span.End()
+	if err != nil {
+		klog.ErrorS(err, "Error constructing job manifest", iwr.logValues()...)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return "", err
+	}
+	job, err := p.m.kubeclientset.BatchV1().Jobs(iwr.Imagecache.Namespace).Create(ctx, newjob, metav1.CreateOptions{})
+	if err != nil {
+		klog.ErrorS(err, "Error creating job", iwr.logValues()...)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return "", err
+	}
+	span.SetAttributes(tracing.AttrJob.String(job.Name))
+	return job.Name, nil
+}
+
+// Pull creates a job to pull the image into the node
+func (p *jobPuller) Pull(ctx context.Context, iwr ImageWorkRequest) (string, error) {
+	cfg := p.m.settings()
+	newjob, err := newImagePullJob(iwr.Imagecache, iwr.Image, iwr.ForceFullCache, iwr.Node, cfg.ImagePullPolicy,
+		cfg.BusyboxImage, cfg.ServiceAccountName, cfg.JobPriorityClassName)
+	return p.createJob(ctx, iwr, newjob, err)
+}
+
+// pin creates a job to pin the image on the node, protecting it from image
+// garbage collection
+func (p *jobPuller) pin(ctx context.Context, iwr ImageWorkRequest) (string, error) {
+	cfg := p.m.settings()
+	newjob, err := newImagePinJob(iwr.Imagecache, iwr.Image, iwr.Node, cfg.CRIClientImage, cfg.ServiceAccountName,
+		cfg.ImageDeleteJobHostNetwork, cfg.JobPriorityClassName, cfg.CRISocketPath)
+	return p.createJob(ctx, iwr, newjob, err)
+}
+
+// Remove creates a job to delete the image from the node
+func (p *jobPuller) Remove(ctx context.Context, iwr ImageWorkRequest) (string, error) {
+	cfg := p.m.settings()
+	newjob, err := newImageDeleteJob(iwr.Imagecache, iwr.Image, iwr.Node, iwr.ContainerRuntimeVersion,
+		cfg.CRIClientImage, cfg.ServiceAccountName, cfg.ImageDeleteJobHostNetwork, cfg.JobPriorityClassName, cfg.CRISocketPath)
+	return p.createJob(ctx, iwr, newjob, err)
+}
+
+// Status tells from the pod of a job which did not finish in time why it did
+// not. A job without a pod has an unknown status.
+func (p *jobPuller) Status(job string, iwres ImageWorkResult) (ImageWorkResult, error) {
+	pods, err := p.m.podsLister.Pods(iwres.ImageWorkRequest.Imagecache.Namespace).
+		List(labels.Set(map[string]string{"job-name": job}).AsSelector())
+	if err != nil {
+		klog.ErrorS(err, "Error listing pods", "job", job)
+		return iwres, err
+	}
+	if len(pods) > 1 {
+		klog.ErrorS(nil, "More than one pod matched job", "job", job)
+		return iwres, fmt.Errorf("more than one pod matched job %s", job)
+	}
+	if len(pods) == 0 {
+		klog.InfoS("No pods matched job, job status unknown", append(iwres.ImageWorkRequest.logValues(), "job", job)...)
+		iwres.Status = ImageWorkResultStatusUnknown
+		iwres.Reason = fmt.Sprintf("No pods matched job %s", job)
+		iwres.Message = fmt.Sprintf("No pods matched job %s", job)
+	}
+	if len(pods) == 1 {
+		iwres.Status = ImageWorkResultStatusFailed
+		klog.InfoS("Job expired", append(iwres.ImageWorkRequest.logValues(), "job", job)...)
+		if pods[0].Status.Phase == corev1.PodPending {
+			if len(pods[0].Status.ContainerStatuses) == 1 {
+				if pods[0].Status.ContainerStatuses[0].State.Waiting != nil {
+					iwres.Reason = pods[0].Status.ContainerStatuses[0].State.Waiting.Reason
+					iwres.Message = pods[0].Status.ContainerStatuses[0].State.Waiting.Message
+				}
+				if pods[0].Status.ContainerStatuses[0].State.Terminated != nil {
+					iwres.Reason = pods[0].Status.ContainerStatuses[0].State.Terminated.Reason
+					iwres.Message = pods[0].Status.ContainerStatuses[0].State.Terminated.Message
+				}
+			} else {
+				iwres.Reason = "Pending"
+				iwres.Message = "Check if node is ready"
+			}
+		}
+		iwres.endSpan(pods[0])
+	}
+	return iwres, nil
+}
+
+// Cleanup deletes the job and its pod
+func (p *jobPuller) Cleanup(namespace, job string) {
+	deletePropagation := metav1.DeletePropagationBackground
+	if err := p.m.kubeclientset.BatchV1().Jobs(namespace).
+		Delete(context.TODO(), job, metav1.DeleteOptions{PropagationPolicy: &deletePropagation}); err != nil {
+		// if for some reason the job cannot be deleted, we'll not retry. rather we continue processing the remaining jobs
+		if strings.Contains(err.Error(), "not found") {
+			klog.InfoS("Job to be deleted not found", "job", job, "namespace", namespace)
+		} else {
+			klog.ErrorS(err, "Error deleting job", "job", job, "namespace", namespace)
+		}
+	}
+}
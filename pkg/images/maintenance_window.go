@@ -0,0 +1,57 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"time"
+
+	fledgedv1alpha3 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	"github.com/senthilrch/kube-fledged/pkg/config"
+	"github.com/senthilrch/kube-fledged/pkg/maintenance"
+	"k8s.io/klog/v2"
+)
+
+// MaintenanceWindows returns the maintenance windows of the image cache, which
+// default to the maintenance windows of the configuration
+func MaintenanceWindows(imageCache *fledgedv1alpha3.ImageCache, cfg config.ControllerConfiguration) []fledgedv1alpha3.MaintenanceWindow {
+	if len(imageCache.Spec.MaintenanceWindows) > 0 {
+		return imageCache.Spec.MaintenanceWindows
+	}
+	return cfg.MaintenanceWindows
+}
+
+// MaintenanceWindowOpensIn returns how long the syncs of the image cache have
+// to wait for the next maintenance window, 0 if a window is open. Invalid
+// windows are logged and do not hold back syncs.
+func MaintenanceWindowOpensIn(imageCache *fledgedv1alpha3.ImageCache, cfg config.ControllerConfiguration, now time.Time) time.Duration {
+	opensIn, err := maintenance.OpensIn(MaintenanceWindows(imageCache, cfg), now)
+	if err != nil {
+		klog.ErrorS(err, "Ignoring maintenance windows of image cache", "imagecache", klog.KObj(imageCache))
+		return 0
+	}
+	return opensIn
+}
+
+// deferral returns how long the job of the request has to wait for the next
+// maintenance window. Urgent requests and warm-ups are not deferred, neither
+// are pins, which do not pull from the registry.
+func (m *ImageManager) deferral(iwr ImageWorkRequest) time.Duration {
+	if iwr.Urgent || iwr.Pin || iwr.WorkType == NodeWarmup || iwr.Imagecache == nil {
+		return 0
+	}
+	return MaintenanceWindowOpensIn(iwr.Imagecache, m.settings(), time.Now())
+}
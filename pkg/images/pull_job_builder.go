@@ -7,7 +7,6 @@ package images
 import (
 	"fmt"
 	"strings"
-	"time"
 
 	fledgedv1alpha3 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha3"
 	batchv1 "k8s.io/api/batch/v1"
@@ -20,7 +19,7 @@ import (
 func commonJob(imagecache *fledgedv1alpha3.ImageCache, image string, pullPolicy corev1.PullPolicy,
 	hostname string, labels map[string]string, busyboxImage string) *batchv1.Job {
 	backoffLimit := int32(0)
-	activeDeadlineSeconds := int64((time.Hour).Seconds())
+	activeDeadlineSeconds := jobActiveDeadlineSeconds(imagecache, image)
 
 	return &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
@@ -100,7 +99,7 @@ func commonJob(imagecache *fledgedv1alpha3.ImageCache, image string, pullPolicy
 func dirCacheJob(imagecache *fledgedv1alpha3.ImageCache, image string, pullPolicy corev1.PullPolicy,
 	hostname string, labels map[string]string, cacheDir []string) *batchv1.Job {
 	backoffLimit := int32(0)
-	activeDeadlineSeconds := int64((time.Hour).Seconds())
+	activeDeadlineSeconds := jobActiveDeadlineSeconds(imagecache, image)
 
 	return &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
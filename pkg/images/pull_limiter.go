@@ -0,0 +1,113 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/senthilrch/kube-fledged/pkg/config"
+	"golang.org/x/time/rate"
+	"k8s.io/apiserver/pkg/storage/names"
+)
+
+// queuedRequestDelay is how long a request waits for a free job slot before
+// it is looked at again
+const queuedRequestDelay = time.Second
+
+// pullLimiter holds a token bucket per registry host, limiting the rate at
+// which pull jobs are created for images of the registry
+type pullLimiter struct {
+	lock     sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+func newPullLimiter() *pullLimiter {
+	return &pullLimiter{limiters: map[string]*rate.Limiter{}}
+}
+
+// reserve takes a token for pulling the image if one is available and returns
+// 0. Otherwise it returns how long to wait for the next token, without taking it.
+func (l *pullLimiter) reserve(cfg config.ControllerConfiguration, image string) time.Duration {
+	registry := imageRegistry(image)
+	limit := cfg.RegistryPullLimit(registry)
+	if limit.QPS <= 0 {
+		return 0
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	limiter, ok := l.limiters[registry]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Limit(limit.QPS), limit.Burst)
+		l.limiters[registry] = limiter
+	}
+	// The limits can change when the configuration is reloaded
+	now := time.Now()
+	if limiter.Limit() != rate.Limit(limit.QPS) {
+		limiter.SetLimitAt(now, rate.Limit(limit.QPS))
+	}
+	if limiter.Burst() != limit.Burst {
+		limiter.SetBurstAt(now, limit.Burst)
+	}
+	r := limiter.ReserveN(now, 1)
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return delay
+	}
+	return 0
+}
+
+// imageRegistry returns the registry host of the image, e.g. docker.io
+func imageRegistry(image string) string {
+	name, _, _ := NormalizeImageName(image)
+	return name[:strings.Index(name, "/")]
+}
+
+// throttle returns how long the job of the request has to wait because of the
+// job concurrency cap or the pull rate limit of the registry, 0 if it may be
+// created now. Only pulls take a token of the registry.
+func (m *ImageManager) throttle(iwr ImageWorkRequest, pull bool) time.Duration {
+	cfg := m.settings()
+	if cfg.MaxConcurrentJobs > 0 {
+		m.lock.RLock()
+		running := m.running
+		m.lock.RUnlock()
+		if running >= cfg.MaxConcurrentJobs {
+			return queuedRequestDelay
+		}
+	}
+	if !pull {
+		return 0
+	}
+	return m.pullLimiter.reserve(cfg, iwr.Image)
+}
+
+// queueRequest records the request as queued, in place of the request it
+// supersedes, and adds it to the work queue again after the delay. The reason
+// is reported if the job is not created before the deadline.
+func (m *ImageManager) queueRequest(iwr ImageWorkRequest, delay time.Duration, reason, message string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if iwr.Supersedes != "" {
+		go m.deleteJob(iwr.Imagecache.Namespace, iwr.Supersedes, m.imageworkstatus[iwr.Supersedes])
+	}
+	job := names.SimpleNameGenerator.GenerateName(fakeJobPrefix)
+	m.recordResult(job, ImageWorkResult{ImageWorkRequest: iwr, Status: ImageWorkResultStatusQueued, Reason: reason, Message: message})
+	iwr.Supersedes = job
+	m.imageworkqueue.AddAfter(iwr, delay)
+}
@@ -0,0 +1,235 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"context"
+	"time"
+
+	fledgedv1alpha3 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	"k8s.io/klog/v2"
+)
+
+// progressReportInterval is the minimum time between two reports of the
+// progress of a sync action
+const progressReportInterval = time.Second
+
+// syncProgress counts the results of a sync action in progress
+type syncProgress struct {
+	queued, succeeded, failed int
+}
+
+// add counts the result n times, a negative n uncounts it
+func (p *syncProgress) add(iwres ImageWorkResult, n int) {
+	switch iwres.Status {
+	case ImageWorkResultStatusQueued:
+		p.queued += n
+	case ImageWorkResultStatusSucceeded, ImageWorkResultStatusAlreadyPulled:
+		p.succeeded += n
+	case ImageWorkResultStatusFailed, ImageWorkResultStatusUnknown, ImageWorkResultStatusCancelled:
+		p.failed += n
+	}
+}
+
+// syncState tracks the results of a sync action, so that its completion is
+// known without scanning the results of all sync actions
+type syncState struct {
+	// jobs are the keys of the results of the sync action in imageworkstatus
+	jobs map[string]bool
+	// placed is the number of requests of the sync action which have been
+	// processed, a request superseding another one is not counted again
+	placed int
+	// pending is the number of results which wait for a job, retry, pin or
+	// for the limits
+	pending  int
+	progress syncProgress
+	reported syncProgress
+	// sentinel is set once all requests of the sync action have been placed
+	sentinel *ImageWorkRequest
+	ctx      context.Context
+	// deadline completes the sync action once its jobs ran out of time
+	deadline *time.Timer
+	// report sends the progress to the controller, at most once per interval
+	report *time.Timer
+	// completing is set once the results are being sent to the controller
+	completing bool
+}
+
+// pendingStatus reports whether the result still waits for a job, retry, pin or
+// for the limits
+func pendingStatus(status string) bool {
+	return status == ImageWorkResultStatusJobCreated || status == ImageWorkResultStatusRetryScheduled ||
+		status == ImageWorkResultStatusPinScheduled || status == ImageWorkResultStatusQueued
+}
+
+// syncState returns the state of the sync action, which is created when its
+// first result is recorded. The caller holds the lock.
+func (m *ImageManager) syncState(syncID string) *syncState {
+	s, ok := m.syncs[syncID]
+	if !ok {
+		s = &syncState{jobs: map[string]bool{}}
+		m.syncs[syncID] = s
+	}
+	return s
+}
+
+// count adds the result to the counters of its sync action, n is 1 or -1
+func (m *ImageManager) count(s *syncState, iwres ImageWorkResult, n int) {
+	if pendingStatus(iwres.Status) {
+		s.pending += n
+	}
+	if iwres.Status == ImageWorkResultStatusJobCreated {
+		m.running += n
+	}
+	s.progress.add(iwres, n)
+}
+
+// setResult records the result of a job, or replaces it. The caller holds the lock.
+func (m *ImageManager) setResult(job string, iwres ImageWorkResult) {
+	s := m.syncState(iwres.ImageWorkRequest.SyncID)
+	if old, ok := m.imageworkstatus[job]; ok && s.jobs[job] {
+		m.count(s, old, -1)
+	}
+	m.imageworkstatus[job] = iwres
+	s.jobs[job] = true
+	m.count(s, iwres, 1)
+	m.checkSync(iwres.ImageWorkRequest.SyncID, s)
+}
+
+// recordResult records the result of a request, in place of the result of the
+// request it supersedes. The caller holds the lock.
+func (m *ImageManager) recordResult(job string, iwres ImageWorkResult) {
+	if superseded := iwres.ImageWorkRequest.Supersedes; superseded != "" {
+		m.removeResult(superseded)
+	} else {
+		m.syncState(iwres.ImageWorkRequest.SyncID).placed++
+	}
+	m.setResult(job, iwres)
+}
+
+// removeResult forgets the result of a job. The caller holds the lock.
+func (m *ImageManager) removeResult(job string) {
+	iwres, ok := m.imageworkstatus[job]
+	if !ok {
+		return
+	}
+	delete(m.imageworkstatus, job)
+	if s, ok := m.syncs[iwres.ImageWorkRequest.SyncID]; ok && s.jobs[job] {
+		m.count(s, iwres, -1)
+		delete(s.jobs, job)
+	}
+}
+
+// dropRequest accounts a request which could not be processed, so that its
+// sync action does not wait for it. The result a request supersedes, e.g. of
+// the failed job of a retry, is replaced by the failure.
+func (m *ImageManager) dropRequest(iwr ImageWorkRequest, err error) {
+	if iwr.Image == "" {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if iwr.Supersedes != "" {
+		superseded, ok := m.imageworkstatus[iwr.Supersedes]
+		if !ok || (superseded.Status != ImageWorkResultStatusRetryScheduled && superseded.Status != ImageWorkResultStatusPinScheduled &&
+			superseded.Status != ImageWorkResultStatusQueued) {
+			return
+		}
+		m.setResult(iwr.Supersedes, ImageWorkResult{ImageWorkRequest: iwr, Status: ImageWorkResultStatusFailed,
+			Reason: fledgedv1alpha3.ImageCacheReasonJobCreationFailed, Message: err.Error(), puller: superseded.puller})
+		return
+	}
+	s := m.syncState(iwr.SyncID)
+	s.placed++
+	m.checkSync(iwr.SyncID, s)
+}
+
+// startSync is called once all requests of the sync action announced by the
+// sentinel have been placed. The sync action completes once the results of all
+// requests are in, or when its jobs ran out of time.
+func (m *ImageManager) startSync(ctx context.Context, sentinel ImageWorkRequest) {
+	syncID := sentinel.SyncID
+	timeout := syncTimeout(syncPullDeadline(sentinel.Imagecache, m.settings().ImagePullDeadlineDuration.Duration),
+		sentinel.Imagecache.Spec.RetryPolicy)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	s := m.syncState(syncID)
+	s.sentinel, s.ctx = &sentinel, ctx
+	s.deadline = time.AfterFunc(timeout, func() {
+		m.lock.Lock()
+		defer m.lock.Unlock()
+		if s, ok := m.syncs[syncID]; ok {
+			klog.V(4).InfoS("Sync deadline passed", "imagecache", klog.KObj(sentinel.Imagecache), "syncID", syncID,
+				"pending", s.pending)
+			m.completeSync(s)
+		}
+	})
+	m.checkSync(syncID, s)
+}
+
+// checkSync completes the sync action once all its requests have a final
+// result, otherwise it schedules a report of the progress. The caller holds the lock.
+func (m *ImageManager) checkSync(syncID string, s *syncState) {
+	if s.sentinel == nil || s.completing {
+		return
+	}
+	if s.pending == 0 && s.placed >= s.sentinel.Requests {
+		m.completeSync(s)
+		return
+	}
+	if s.progress != s.reported && s.report == nil {
+		s.report = time.AfterFunc(progressReportInterval, func() { m.reportSyncProgress(syncID) })
+	}
+}
+
+// completeSync sends the results of the sync action to the controller. The
+// caller holds the lock.
+func (m *ImageManager) completeSync(s *syncState) {
+	if s.completing {
+		return
+	}
+	s.completing = true
+	s.deadline.Stop()
+	if s.report != nil {
+		s.report.Stop()
+	}
+	go m.updateImageCacheStatus(s.ctx, *s.sentinel)
+}
+
+// reportSyncProgress reports the results of the sync action so far, if they
+// changed since the last report
+func (m *ImageManager) reportSyncProgress(syncID string) {
+	m.lock.Lock()
+	s, ok := m.syncs[syncID]
+	if !ok || s.completing {
+		m.lock.Unlock()
+		return
+	}
+	s.report = nil
+	if s.progress == s.reported {
+		m.lock.Unlock()
+		return
+	}
+	s.reported = s.progress
+	results := make(map[string]ImageWorkResult, len(s.jobs))
+	for job := range s.jobs {
+		results[job] = m.imageworkstatus[job]
+	}
+	sentinel := *s.sentinel
+	m.lock.Unlock()
+	m.reportProgress(sentinel, results)
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package maintenance evaluates the maintenance windows in which image caches
+// are synced
+package maintenance
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	fledgedv1alpha3 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+)
+
+// Validate checks the cron schedules and durations of the windows
+func Validate(windows []fledgedv1alpha3.MaintenanceWindow) error {
+	for _, w := range windows {
+		if _, err := cron.ParseStandard(w.Schedule); err != nil {
+			return fmt.Errorf("invalid maintenance window schedule %q: %v", w.Schedule, err)
+		}
+		if w.Duration.Duration <= 0 {
+			return fmt.Errorf("duration of maintenance window %q must be positive", w.Schedule)
+		}
+	}
+	return nil
+}
+
+// OpensIn returns 0 if one of the windows is open at now, or if there are no
+// windows. Otherwise it returns how long it takes until the next window opens.
+func OpensIn(windows []fledgedv1alpha3.MaintenanceWindow, now time.Time) (time.Duration, error) {
+	if len(windows) == 0 {
+		return 0, nil
+	}
+	var next time.Time
+	for _, w := range windows {
+		schedule, err := cron.ParseStandard(w.Schedule)
+		if err != nil {
+			return 0, fmt.Errorf("invalid maintenance window schedule %q: %v", w.Schedule, err)
+		}
+		// The first start after now-duration is either within the window or the next start
+		start := schedule.Next(now.Add(-w.Duration.Duration))
+		if start.IsZero() {
+			continue
+		}
+		if !start.After(now) {
+			return 0, nil
+		}
+		if next.IsZero() || start.Before(next) {
+			next = start
+		}
+	}
+	if next.IsZero() {
+		return 0, fmt.Errorf("no maintenance window opens")
+	}
+	return next.Sub(now), nil
+}
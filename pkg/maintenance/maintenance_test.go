@@ -0,0 +1,94 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package maintenance
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	fledgedv1alpha3 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func window(schedule string, duration time.Duration) fledgedv1alpha3.MaintenanceWindow {
+	return fledgedv1alpha3.MaintenanceWindow{Schedule: schedule, Duration: metav1.Duration{Duration: duration}}
+}
+
+func TestOpensIn(t *testing.T) {
+	// Wednesday
+	now := time.Date(2022, time.November, 16, 23, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name                string
+		windows             []fledgedv1alpha3.MaintenanceWindow
+		expected            time.Duration
+		expectedErrorString string
+	}{
+		{
+			name:     "#1: No windows",
+			expected: 0,
+		},
+		{
+			name:     "#2: Window open",
+			windows:  []fledgedv1alpha3.MaintenanceWindow{window("CRON_TZ=UTC 0 22 * * *", 2*time.Hour)},
+			expected: 0,
+		},
+		{
+			name:     "#3: Window opening across midnight",
+			windows:  []fledgedv1alpha3.MaintenanceWindow{window("CRON_TZ=UTC 0 22 * * *", time.Hour)},
+			expected: 22*time.Hour + 30*time.Minute,
+		},
+		{
+			name: "#4: Earliest of several windows",
+			windows: []fledgedv1alpha3.MaintenanceWindow{
+				window("CRON_TZ=UTC 0 2 * * 6", 4*time.Hour),
+				window("CRON_TZ=UTC 0 1 * * 4", time.Hour),
+			},
+			expected: 90 * time.Minute,
+		},
+		{
+			name:                "#5: Invalid schedule",
+			windows:             []fledgedv1alpha3.MaintenanceWindow{window("0 22 * *", time.Hour)},
+			expectedErrorString: "invalid maintenance window schedule",
+		},
+	}
+	for _, test := range tests {
+		opensIn, err := OpensIn(test.windows, now)
+		if test.expectedErrorString != "" {
+			if err == nil || !strings.Contains(err.Error(), test.expectedErrorString) {
+				t.Errorf("Test: %s failed: expectedError=%s, actualError=%v", test.name, test.expectedErrorString, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test: %s failed: err=%v", test.name, err)
+			continue
+		}
+		if opensIn != test.expected {
+			t.Errorf("Test: %s failed: expected=%s, actual=%s", test.name, test.expected, opensIn)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Validate([]fledgedv1alpha3.MaintenanceWindow{window("0 22 * * 1-5", 8*time.Hour)}); err != nil {
+		t.Errorf("Test: valid window failed: err=%v", err)
+	}
+	if err := Validate([]fledgedv1alpha3.MaintenanceWindow{window("0 22 * * 1-5", 0)}); err == nil {
+		t.Errorf("Test: window without duration failed: expected error")
+	}
+}
@@ -0,0 +1,247 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package notify pushes the final status of image cache syncs to
+// notification sinks: generic HTTP webhooks, CloudEvents and Slack-compatible
+// webhooks
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	fledgedv1alpha3 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Types of notification sinks
+const (
+	SinkTypeWebhook     = "webhook"
+	SinkTypeCloudEvents = "cloudevents"
+	SinkTypeSlack       = "slack"
+)
+
+// Severity of a notification
+type Severity string
+
+// List of constants for Severity, from the lowest to the highest
+const (
+	SeverityInfo    Severity = "info"
+	SeverityWarning Severity = "warning"
+	SeverityError   Severity = "error"
+)
+
+var severityLevels = map[Severity]int{SeverityInfo: 0, SeverityWarning: 1, SeverityError: 2}
+
+// DefaultTimeout is how long a sink is given to accept a notification
+const DefaultTimeout = 10 * time.Second
+
+// cloudEventType is the type of the CloudEvents sent for image cache syncs
+const cloudEventType = "io.kubefledged.imagecache.sync.completed"
+
+// SinkConfig configures a notification sink and the notifications sent to it
+type SinkConfig struct {
+	// Name identifies the sink in logs
+	Name string `json:"name"`
+	// Type is either webhook, cloudevents or slack
+	Type string `json:"type"`
+	// URL to which notifications are posted
+	URL string `json:"url"`
+	// Namespaces restricts the notifications to image caches of these namespaces. Empty means all namespaces.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// ImageCaches restricts the notifications to image caches with these names. Empty means all image caches.
+	ImageCaches []string `json:"imageCaches,omitempty"`
+	// MinSeverity is the lowest severity notified, either info, warning or error. Defaults to warning.
+	MinSeverity Severity `json:"minSeverity,omitempty"`
+	// Timeout is how long the sink is given to accept a notification. Defaults to 10s.
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// Notification has the final status of a sync of an image cache
+type Notification struct {
+	Namespace      string                                           `json:"namespace"`
+	ImageCache     string                                           `json:"imageCache"`
+	SyncID         string                                           `json:"syncID,omitempty"`
+	Severity       Severity                                         `json:"severity"`
+	Status         fledgedv1alpha3.ImageCacheActionStatus           `json:"status"`
+	Reason         string                                           `json:"reason"`
+	Message        string                                           `json:"message"`
+	StartTime      *metav1.Time                                     `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time                                     `json:"completionTime,omitempty"`
+	Failures       map[string]fledgedv1alpha3.NodeReasonMessageList `json:"failures,omitempty"`
+}
+
+// StatusSeverity returns the severity of a final image cache status
+func StatusSeverity(status fledgedv1alpha3.ImageCacheActionStatus) Severity {
+	switch status {
+	case fledgedv1alpha3.ImageCacheActionStatusSucceeded, fledgedv1alpha3.ImageCacheActioneNoImagesPulledOrDeleted:
+		return SeverityInfo
+	case fledgedv1alpha3.ImageCacheActionStatusAborted:
+		return SeverityWarning
+	default:
+		return SeverityError
+	}
+}
+
+// Validate checks the types, URLs and filters of the sinks
+func Validate(sinks []SinkConfig) error {
+	for _, s := range sinks {
+		if s.Name == "" {
+			return fmt.Errorf("name of notification sink must not be empty")
+		}
+		if s.Type != SinkTypeWebhook && s.Type != SinkTypeCloudEvents && s.Type != SinkTypeSlack {
+			return fmt.Errorf("unsupported type %q of notification sink %q, possible values are 'webhook', 'cloudevents' and 'slack'", s.Type, s.Name)
+		}
+		u, err := url.Parse(s.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid url of notification sink %q, an absolute http or https url is expected", s.Name)
+		}
+		if _, ok := severityLevels[s.MinSeverity]; s.MinSeverity != "" && !ok {
+			return fmt.Errorf("unsupported minSeverity %q of notification sink %q, possible values are 'info', 'warning' and 'error'", s.MinSeverity, s.Name)
+		}
+		if s.Timeout != nil && s.Timeout.Duration <= 0 {
+			return fmt.Errorf("timeout of notification sink %q must be positive", s.Name)
+		}
+	}
+	return nil
+}
+
+// Matches reports whether the notification passes the filters of the sink
+func (s SinkConfig) Matches(n Notification) bool {
+	if len(s.Namespaces) > 0 && !contains(s.Namespaces, n.Namespace) {
+		return false
+	}
+	if len(s.ImageCaches) > 0 && !contains(s.ImageCaches, n.ImageCache) {
+		return false
+	}
+	minSeverity := s.MinSeverity
+	if minSeverity == "" {
+		minSeverity = SeverityWarning
+	}
+	return severityLevels[n.Severity] >= severityLevels[minSeverity]
+}
+
+// Notifier posts notifications to sinks
+type Notifier struct {
+	client *http.Client
+}
+
+// NewNotifier returns a notifier posting with the http client
+func NewNotifier(client *http.Client) *Notifier {
+	return &Notifier{client: client}
+}
+
+// Notify posts the notification to every sink whose filters it passes. It
+// returns the errors of the sinks which failed, the other sinks are still notified.
+func (n *Notifier) Notify(ctx context.Context, sinks []SinkConfig, notification Notification) []error {
+	var errs []error
+	for _, s := range sinks {
+		if !s.Matches(notification) {
+			continue
+		}
+		if err := n.send(ctx, s, notification); err != nil {
+			errs = append(errs, fmt.Errorf("notification sink %q: %v", s.Name, err))
+		}
+	}
+	return errs
+}
+
+// send posts the notification to the sink in the payload format of its type
+func (n *Notifier) send(ctx context.Context, s SinkConfig, notification Notification) error {
+	contentType := "application/json"
+	var payload interface{} = notification
+	switch s.Type {
+	case SinkTypeCloudEvents:
+		contentType = "application/cloudevents+json"
+		payload = cloudEvent(notification)
+	case SinkTypeSlack:
+		payload = map[string]string{"text": slackText(notification)}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	timeout := DefaultTimeout
+	if s.Timeout != nil {
+		timeout = s.Timeout.Duration
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected response status %s", resp.Status)
+	}
+	return nil
+}
+
+// cloudEvent wraps the notification in a CloudEvent of the structured content mode
+func cloudEvent(n Notification) map[string]interface{} {
+	event := map[string]interface{}{
+		"specversion":     "1.0",
+		"id":              fmt.Sprintf("%s/%s/%s/%s", n.Namespace, n.ImageCache, n.SyncID, n.Status),
+		"source":          fmt.Sprintf("/apis/%s/namespaces/%s/imagecaches/%s", fledgedv1alpha3.SchemeGroupVersion, n.Namespace, n.ImageCache),
+		"type":            cloudEventType,
+		"subject":         n.ImageCache,
+		"datacontenttype": "application/json",
+		"data":            n,
+	}
+	if n.CompletionTime != nil {
+		event["time"] = n.CompletionTime.UTC().Format(time.RFC3339)
+	}
+	return event
+}
+
+// slackText formats the notification as the text of a Slack message
+func slackText(n Notification) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*Image cache %s/%s %s*: %s", n.Namespace, n.ImageCache, n.Status, n.Message)
+	images := make([]string, 0, len(n.Failures))
+	for image := range n.Failures {
+		images = append(images, image)
+	}
+	sort.Strings(images)
+	for _, image := range images {
+		for _, f := range n.Failures[image] {
+			fmt.Fprintf(&b, "\n• `%s` on node %s: %s", image, f.Node, strings.TrimSpace(f.Reason+" "+f.Message))
+		}
+	}
+	return b.String()
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,216 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	fledgedv1alpha3 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// received is a request received by the test server
+type received struct {
+	contentType string
+	body        map[string]interface{}
+}
+
+func newTestServer(t *testing.T, status int) (*httptest.Server, chan received) {
+	requests := make(chan received, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body := map[string]interface{}{}
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Errorf("Test: invalid JSON payload: %v", err)
+		}
+		requests <- received{contentType: r.Header.Get("Content-Type"), body: body}
+		w.WriteHeader(status)
+	}))
+	return server, requests
+}
+
+func failedNotification() Notification {
+	completionTime := metav1.NewTime(time.Date(2022, time.November, 16, 23, 30, 0, 0, time.UTC))
+	return Notification{
+		Namespace:      "kube-fledged",
+		ImageCache:     "foo",
+		SyncID:         "sync1",
+		Severity:       StatusSeverity(fledgedv1alpha3.ImageCacheActionStatusFailed),
+		Status:         fledgedv1alpha3.ImageCacheActionStatusFailed,
+		Reason:         fledgedv1alpha3.ImageCacheReasonImageCacheRefresh,
+		Message:        fledgedv1alpha3.ImageCacheMessageImagePullFailedForSomeImages,
+		CompletionTime: &completionTime,
+		Failures: map[string]fledgedv1alpha3.NodeReasonMessageList{
+			"nginx:1.23": {{Node: "worker1", Reason: "ErrImagePull", Message: "not found"}},
+		},
+	}
+}
+
+func TestNotify(t *testing.T) {
+	tests := []struct {
+		name                string
+		sink                SinkConfig
+		notification        Notification
+		status              int
+		expectedContentType string
+		expected            map[string]string
+		expectedErrorString string
+	}{
+		{
+			name:                "#1: Webhook",
+			sink:                SinkConfig{Name: "ops", Type: SinkTypeWebhook},
+			notification:        failedNotification(),
+			expectedContentType: "application/json",
+			expected:            map[string]string{"imageCache": "foo", "status": "Failed", "severity": "error"},
+		},
+		{
+			name:                "#2: CloudEvents",
+			sink:                SinkConfig{Name: "events", Type: SinkTypeCloudEvents},
+			notification:        failedNotification(),
+			expectedContentType: "application/cloudevents+json",
+			expected: map[string]string{"specversion": "1.0", "type": cloudEventType, "subject": "foo",
+				"source": "/apis/kubefledged.io/v1alpha3/namespaces/kube-fledged/imagecaches/foo", "time": "2022-11-16T23:30:00Z"},
+		},
+		{
+			name:                "#3: Slack",
+			sink:                SinkConfig{Name: "slack", Type: SinkTypeSlack},
+			notification:        failedNotification(),
+			expectedContentType: "application/json",
+			expected: map[string]string{"text": "*Image cache kube-fledged/foo Failed*: " + fledgedv1alpha3.ImageCacheMessageImagePullFailedForSomeImages +
+				"\n• `nginx:1.23` on node worker1: ErrImagePull not found"},
+		},
+		{
+			name:         "#4: Filtered by namespace",
+			sink:         SinkConfig{Name: "ops", Type: SinkTypeWebhook, Namespaces: []string{"tenant-a"}},
+			notification: failedNotification(),
+		},
+		{
+			name:         "#5: Filtered by image cache",
+			sink:         SinkConfig{Name: "ops", Type: SinkTypeWebhook, ImageCaches: []string{"bar"}},
+			notification: failedNotification(),
+		},
+		{
+			name: "#6: Filtered by default severity",
+			sink: SinkConfig{Name: "ops", Type: SinkTypeWebhook},
+			notification: Notification{Namespace: "kube-fledged", ImageCache: "foo",
+				Severity: StatusSeverity(fledgedv1alpha3.ImageCacheActionStatusSucceeded)},
+		},
+		{
+			name: "#7: Succeeded with severity info",
+			sink: SinkConfig{Name: "ops", Type: SinkTypeWebhook, MinSeverity: SeverityInfo, Namespaces: []string{"kube-fledged"}},
+			notification: Notification{Namespace: "kube-fledged", ImageCache: "foo", Status: fledgedv1alpha3.ImageCacheActionStatusSucceeded,
+				Severity: StatusSeverity(fledgedv1alpha3.ImageCacheActionStatusSucceeded)},
+			expectedContentType: "application/json",
+			expected:            map[string]string{"status": "Succeeded", "severity": "info"},
+		},
+		{
+			name:                "#8: Sink responds with an error",
+			sink:                SinkConfig{Name: "ops", Type: SinkTypeWebhook},
+			notification:        failedNotification(),
+			status:              http.StatusInternalServerError,
+			expectedContentType: "application/json",
+			expected:            map[string]string{"imageCache": "foo"},
+			expectedErrorString: "unexpected response status 500",
+		},
+	}
+	for _, test := range tests {
+		status := test.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		server, requests := newTestServer(t, status)
+		test.sink.URL = server.URL
+		errs := NewNotifier(server.Client()).Notify(context.Background(), []SinkConfig{test.sink}, test.notification)
+		server.Close()
+		close(requests)
+
+		if test.expectedErrorString == "" && len(errs) > 0 {
+			t.Errorf("Test: %s failed: unexpected errors %v", test.name, errs)
+		}
+		if test.expectedErrorString != "" && (len(errs) != 1 || !strings.Contains(errs[0].Error(), test.expectedErrorString)) {
+			t.Errorf("Test: %s failed: expected error %q, actual %v", test.name, test.expectedErrorString, errs)
+		}
+		r, ok := <-requests
+		if test.expected == nil {
+			if ok {
+				t.Errorf("Test: %s failed: notification sent although filtered", test.name)
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("Test: %s failed: no notification sent", test.name)
+			continue
+		}
+		if r.contentType != test.expectedContentType {
+			t.Errorf("Test: %s failed: expected content type %s, actual %s", test.name, test.expectedContentType, r.contentType)
+		}
+		for key, value := range test.expected {
+			if r.body[key] != value {
+				t.Errorf("Test: %s failed: expected %s=%q, actual %q", test.name, key, value, r.body[key])
+			}
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name                string
+		sink                SinkConfig
+		expectedErrorString string
+	}{
+		{
+			name: "#1: Valid sink",
+			sink: SinkConfig{Name: "ops", Type: SinkTypeSlack, URL: "https://hooks.slack.com/services/T0/B0/X", MinSeverity: SeverityError},
+		},
+		{
+			name:                "#2: Name missing",
+			sink:                SinkConfig{Type: SinkTypeWebhook, URL: "https://example.com"},
+			expectedErrorString: "name of notification sink must not be empty",
+		},
+		{
+			name:                "#3: Unsupported type",
+			sink:                SinkConfig{Name: "ops", Type: "email", URL: "https://example.com"},
+			expectedErrorString: "unsupported type",
+		},
+		{
+			name:                "#4: Relative url",
+			sink:                SinkConfig{Name: "ops", Type: SinkTypeWebhook, URL: "/hooks"},
+			expectedErrorString: "invalid url",
+		},
+		{
+			name:                "#5: Unsupported severity",
+			sink:                SinkConfig{Name: "ops", Type: SinkTypeWebhook, URL: "https://example.com", MinSeverity: "critical"},
+			expectedErrorString: "unsupported minSeverity",
+		},
+	}
+	for _, test := range tests {
+		err := Validate([]SinkConfig{test.sink})
+		if test.expectedErrorString == "" && err != nil {
+			t.Errorf("Test: %s failed: unexpected error %v", test.name, err)
+		}
+		if test.expectedErrorString != "" && (err == nil || !strings.Contains(err.Error(), test.expectedErrorString)) {
+			t.Errorf("Test: %s failed: expected error %q, actual %v", test.name, test.expectedErrorString, err)
+		}
+	}
+}
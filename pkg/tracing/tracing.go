@@ -0,0 +1,94 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/senthilrch/kube-fledged"
+
+// Span attribute keys shared by the controller and the image manager
+const (
+	AttrImageCache = attribute.Key("kubefledged.imagecache")
+	AttrNamespace  = attribute.Key("kubefledged.namespace")
+	AttrSyncID     = attribute.Key("kubefledged.sync_id")
+	AttrWorkType   = attribute.Key("kubefledged.work_type")
+	AttrNode       = attribute.Key("kubefledged.node")
+	AttrImage      = attribute.Key("kubefledged.image")
+	AttrJob        = attribute.Key("kubefledged.job")
+)
+
+// traceContext is used to carry span contexts across the work queues. Queue
+// items must be comparable, so the span context travels as a W3C traceparent string.
+var traceContext = propagation.TraceContext{}
+
+// Setup installs the global tracer provider. When endpoint is empty the
+// no-op provider is left in place and no spans are exported. The returned
+// function flushes and stops the exporter.
+func Setup(ctx context.Context, serviceName, endpoint string, insecure bool) (func(context.Context) error, error) {
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(endpoint)}
+	if insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceNameKey.String(serviceName)))
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(traceContext)
+	return tp.Shutdown, nil
+}
+
+// Tracer returns the tracer used across kube-fledged
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Inject returns the traceparent of the span held in ctx. It returns an
+// empty string if ctx holds no valid span.
+func Inject(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	traceContext.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+// Extract returns a copy of ctx carrying the span context encoded in traceParent
+func Extract(ctx context.Context, traceParent string) context.Context {
+	if traceParent == "" {
+		return ctx
+	}
+	return traceContext.Extract(ctx, propagation.MapCarrier{"traceparent": traceParent})
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestInjectExtract(t *testing.T) {
+	tp := sdktrace.NewTracerProvider()
+	defer tp.Shutdown(context.Background())
+	ctx, span := tp.Tracer(instrumentationName).Start(context.Background(), "sync")
+	defer span.End()
+
+	tests := []struct {
+		name        string
+		ctx         context.Context
+		expectValid bool
+	}{
+		{
+			name:        "#1: Span context round-trips through the traceparent",
+			ctx:         ctx,
+			expectValid: true,
+		},
+		{
+			name: "#2: No span, empty traceparent",
+			ctx:  context.Background(),
+		},
+	}
+	for _, test := range tests {
+		traceParent := Inject(test.ctx)
+		if test.expectValid == (traceParent == "") {
+			t.Errorf("Test: %s failed: unexpected traceparent %q", test.name, traceParent)
+			continue
+		}
+		extracted := trace.SpanContextFromContext(Extract(context.Background(), traceParent))
+		if extracted.IsValid() != test.expectValid {
+			t.Errorf("Test: %s failed: expected valid=%t, actual=%t", test.name, test.expectValid, extracted.IsValid())
+			continue
+		}
+		if !test.expectValid {
+			continue
+		}
+		expected := span.SpanContext()
+		if extracted.TraceID() != expected.TraceID() || extracted.SpanID() != expected.SpanID() || !extracted.IsRemote() {
+			t.Errorf("Test: %s failed: expected trace=%s, span=%s, actual trace=%s, span=%s, remote=%t", test.name,
+				expected.TraceID(), expected.SpanID(), extracted.TraceID(), extracted.SpanID(), extracted.IsRemote())
+		}
+	}
+}
+
+func TestExtractEmpty(t *testing.T) {
+	ctx := context.WithValue(context.Background(), struct{}{}, "foo")
+	if Extract(ctx, "") != ctx {
+		t.Errorf("Test: empty traceparent failed: context replaced")
+	}
+}
+
+func TestSetupNoEndpoint(t *testing.T) {
+	before := otel.GetTracerProvider()
+	shutdown, err := Setup(context.Background(), "kubefledged-controller", "", false)
+	if err != nil {
+		t.Fatalf("Test: no endpoint failed: err=%v", err)
+	}
+	if otel.GetTracerProvider() != before {
+		t.Errorf("Test: no endpoint failed: tracer provider replaced")
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("Test: no endpoint failed: shutdown err=%v", err)
+	}
+	_, span := Tracer().Start(context.Background(), "sync")
+	defer span.End()
+	if span.SpanContext().IsValid() || span.IsRecording() {
+		t.Errorf("Test: no endpoint failed: span recorded")
+	}
+}